@@ -3,16 +3,23 @@ package main
 import (
 	"GoBot/internal/bot"
 	"GoBot/internal/config"
+	"flag"
 	"log"
 )
 
 func main() {
-	// load env variables
-	config := config.New()
+	configPath := flag.String("config", "config.yaml", "path to the configuration file")
+	flag.Parse()
 
 	// add line numbers and file to logger
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
+	// load config file and env variables
+	configs, err := config.NewManager(*configPath)
+	if err != nil {
+		log.Fatalln("Invalid configuration: ", err)
+	}
+
 	// start bot
-	bot.Start(&config)
+	bot.Start(configs)
 }
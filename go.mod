@@ -21,8 +21,11 @@ require (
 )
 
 require (
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/wcharczuk/go-chart v2.0.1+incompatible
+	go.etcd.io/bbolt v1.4.0
 	google.golang.org/api v0.230.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
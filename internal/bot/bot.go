@@ -2,7 +2,9 @@ package bot
 
 import (
 	"GoBot/internal/bot/commands"
+	"GoBot/internal/bot/router"
 	"GoBot/internal/config"
+	"GoBot/internal/storage"
 	"log"
 	"os"
 	"os/signal"
@@ -11,7 +13,9 @@ import (
 	"github.com/bwmarrin/discordgo"
 )
 
-func Start(config *config.Config) {
+func Start(configs *config.Manager) {
+	config := configs.Current()
+
 	// create bot
 	bot, err := discordgo.New("Bot " + config.Token)
 
@@ -27,11 +31,29 @@ func Start(config *config.Config) {
 	bot.ShouldReconnectOnError = true
 	bot.Client.Timeout = 0
 
+	// open database
+	store, err := storage.OpenBolt(config.DatabasePath)
+	if err != nil {
+		log.Println("error opening database,", err)
+		return
+	}
+
+	defer func() {
+		err := store.Close()
+		if err != nil {
+			log.Println("Failed to close database: ", err)
+		}
+	}()
+
 	// register commands
-	cleanup := commands.Register(bot, config)
+	r := router.New()
+	cleanup := commands.Register(bot, r, configs, store)
 
-	// register appCommands
-	bot.AddHandler(initializeCommands)
+	// dispatch interactions and sync appCommands
+	bot.AddHandler(r.Handle)
+	commandSync := &commandSync{router: r, config: configs}
+	bot.AddHandler(commandSync.onReady)
+	bot.AddHandler(commandSync.onGuildCreate)
 
 	// close bot after everything is cleaned up
 	defer func() {
@@ -53,137 +75,13 @@ func Start(config *config.Config) {
 		return
 	}
 
+	// reload config on SIGHUP and file changes
+	stopWatching := make(chan struct{})
+	defer close(stopWatching)
+	go configs.Watch(stopWatching)
+
 	log.Println("Bot is now running. Press CTRL + C to exit.")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	<-sc
 }
-
-func initializeCommands(s *discordgo.Session, g *discordgo.GuildCreate) {
-	for _, command := range appCommands {
-		_, err := s.ApplicationCommandCreate(s.State.User.ID, g.ID, command)
-
-		if err != nil {
-			log.Fatalf("Could not create command (%s): %s", command.Name, err)
-		}
-	}
-}
-
-var appCommands []*discordgo.ApplicationCommand = []*discordgo.ApplicationCommand{
-	{
-		Name:        "refreshai",
-		Description: "Refreshes the system prompt of the ai",
-	},
-	{
-		Name:        "timer",
-		Description: "The bot will answer the message after the requested time.",
-		Options: []*discordgo.ApplicationCommandOption{
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "message",
-				Description: "inform the bot:",
-			},
-			{
-				Type:        discordgo.ApplicationCommandOptionInteger,
-				Name:        "seconds",
-				Description: "seconds to wait:",
-			},
-			{
-				Type:        discordgo.ApplicationCommandOptionInteger,
-				Name:        "minutes",
-				Description: "minutes to wait:",
-			},
-			{
-				Type:        discordgo.ApplicationCommandOptionInteger,
-				Name:        "hours",
-				Description: "hours to wait:",
-			},
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "time",
-				Description: "send message on specific time at todays day. Format: HH:mm:ss",
-			},
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "date",
-				Description: "send message at given date at 0a.m. Format: Year-Month-Day",
-			},
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "dateandtime",
-				Description: "send message at given date and time. Format: Year-Month-Day HH:mm:ss",
-			},
-		},
-	},
-	{
-		Name:        "kokcount",
-		Description: "Outputs how many times you have sent :kok:.",
-		Options: []*discordgo.ApplicationCommandOption{
-			{
-				Type:        discordgo.ApplicationCommandOptionMentionable,
-				Name:        "user",
-				Description: "user:",
-			},
-		},
-	},
-	{
-		Name:        "updatecolor",
-		Description: "Creates, updates or removes your color role",
-		Options: []*discordgo.ApplicationCommandOption{
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "color",
-				Description: "the hex color value the role should have",
-				Required:    false,
-			},
-		},
-	},
-	{
-		Name:        "setcolororderrole",
-		Description: "The color roles will be added below this role. Set this to the desired role.",
-		Options: []*discordgo.ApplicationCommandOption{
-			{
-				Type:        discordgo.ApplicationCommandOptionRole,
-				Name:        "role",
-				Description: "The order role",
-				Required:    true,
-			},
-		},
-	},
-	{
-		Name:        "setcolororderrole",
-		Description: "The color roles will be added below this role. Set this to the desired role.",
-		Options: []*discordgo.ApplicationCommandOption{
-			{
-				Type:        discordgo.ApplicationCommandOptionRole,
-				Name:        "role",
-				Description: "The order role",
-				Required:    true,
-			},
-		},
-	},
-	{
-		Name:        "currentplayers",
-		Description: "Outputs the current players of the minecraft server.",
-	},
-	{
-		Name:        "mcreconnect",
-		Description: "Reconnect to the minecraft server.",
-	},
-	{
-		Name:        "rheinmetall",
-		Description: "Show rheinmetall stock information.",
-	},
-	{
-		Name:        "stock",
-		Description: "Show values of the specified stock",
-		Options: []*discordgo.ApplicationCommandOption{
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "stock",
-				Description: "The stock you want to query",
-				Required:    true,
-			},
-		},
-	},
-}
@@ -0,0 +1,505 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/config"
+	"GoBot/internal/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const accessBucket = "access"
+
+// permissionNames are the names of the permissions used by the commands of
+// the bot, for error messages.
+var permissionNames = map[int64]string{
+	discordgo.PermissionAdministrator:  "Administrator",
+	discordgo.PermissionManageServer:   "Manage Server",
+	discordgo.PermissionManageRoles:    "Manage Roles",
+	discordgo.PermissionManageMessages: "Manage Messages",
+}
+
+// access decides who may use which command. Per guild, roles and users can be
+// allowed or denied a command with /access. Rules only narrow the default
+// member permissions of a command: discord doesn't send commands to members
+// without them, so an allow rule can't grant a command to them.
+type access struct {
+	store  storage.Store
+	config *config.Manager
+	router *router.Router
+	// mu guards appOwners.
+	mu        sync.RWMutex
+	appOwners []string
+}
+
+// accessRule is the rule of a single command in a guild.
+type accessRule struct {
+	AllowRoles []string `json:"allowRoles,omitempty"`
+	DenyRoles  []string `json:"denyRoles,omitempty"`
+	AllowUsers []string `json:"allowUsers,omitempty"`
+	DenyUsers  []string `json:"denyUsers,omitempty"`
+}
+
+func newAccess(store storage.Store, config *config.Manager, r *router.Router) *access {
+	return &access{
+		store:  store,
+		config: config,
+		router: r,
+	}
+}
+
+func (access *access) register(bot *discordgo.Session, r *router.Router) {
+	// add handlers
+	bot.AddHandler(access.loadAppOwners)
+	r.SetAuthorizer(access.authorize)
+
+	manageGuild := int64(discordgo.PermissionManageServer)
+
+	commandOption := &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         "command",
+		Description:  "The command",
+		Required:     true,
+		Autocomplete: true,
+	}
+	targetOption := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionMentionable,
+		Name:        "target",
+		Description: "The role or user",
+		Required:    true,
+	}
+
+	// add commands
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:                     "access",
+			Description:              "Controls who may use the commands of the bot.",
+			DefaultMemberPermissions: &manageGuild,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "allow",
+					Description: "Limits a command to the allowed roles and users. They still need its default permissions.",
+					Options:     []*discordgo.ApplicationCommandOption{commandOption, targetOption},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "deny",
+					Description: "Denies a role or user the use of a command.",
+					Options:     []*discordgo.ApplicationCommandOption{commandOption, targetOption},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "clear",
+					Description: "Removes a role or user (or the whole rule) from a command.",
+					Options: []*discordgo.ApplicationCommandOption{
+						commandOption,
+						{
+							Type:        discordgo.ApplicationCommandOptionMentionable,
+							Name:        "target",
+							Description: "The role or user",
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "Shows the access rules of this server.",
+				},
+			},
+		},
+		Subcommands: map[string]router.Handler{
+			"allow": access.allowCommand,
+			"deny":  access.denyCommand,
+			"clear": access.clearCommand,
+			"list":  access.listCommand,
+		},
+		Autocomplete: access.autocompleteCommand,
+	})
+}
+
+// loadAppOwners remembers the owners of the application, who are the owners
+// of the bot if the config file doesn't name any.
+func (access *access) loadAppOwners(s *discordgo.Session, r *discordgo.Ready) {
+	app, err := s.Application("@me")
+	if err != nil {
+		log.Println("Failed to fetch application: ", err)
+		return
+	}
+
+	owners := []string{}
+	if app.Team != nil {
+		for _, member := range app.Team.Members {
+			owners = append(owners, member.User.ID)
+		}
+	} else if app.Owner != nil {
+		owners = append(owners, app.Owner.ID)
+	}
+
+	access.mu.Lock()
+	access.appOwners = owners
+	access.mu.Unlock()
+}
+
+func (access *access) isOwner(userID string) bool {
+	if owners := access.config.Current().Owners; len(owners) > 0 {
+		return slices.Contains(owners, userID)
+	}
+
+	access.mu.RLock()
+	defer access.mu.RUnlock()
+
+	return slices.Contains(access.appOwners, userID)
+}
+
+// authorize is the authorizer of the router.
+func (access *access) authorize(s *discordgo.Session, i *discordgo.InteractionCreate, command *router.Command) error {
+	user := interactionUser(i)
+	if user == nil {
+		return errors.New("Could not identify you.")
+	}
+
+	// owners may use everything
+	if access.isOwner(user.ID) {
+		return nil
+	}
+	if command.OwnerOnly {
+		return errors.New("Only the owner of the bot can use this command.")
+	}
+
+	// there are no rules or member permissions in DMs
+	if i.Member == nil {
+		if command.Definition.DefaultMemberPermissions != nil && *command.Definition.DefaultMemberPermissions != 0 {
+			return errors.New("This command can only be used in a server.")
+		}
+		return nil
+	}
+
+	rule, err := access.rule(i.GuildID, command.Definition.Name)
+	if err != nil {
+		log.Println("Failed to read access rule: ", err)
+	}
+
+	// @everyone has the ID of the guild and is never in the member's roles
+	roles := append(slices.Clone(i.Member.Roles), i.GuildID)
+	if allowed, decided := rule.decide(user.ID, roles); decided && !allowed {
+		return fmt.Errorf("You are not allowed to use /%s.", command.Definition.Name)
+	}
+
+	return checkPermissions(i.Member, command.Definition.DefaultMemberPermissions)
+}
+
+// decide applies the rule to a member. decided is false if the rule doesn't
+// say anything about the member.
+func (rule accessRule) decide(userID string, roles []string) (allowed bool, decided bool) {
+	hasRole := func(list []string) bool {
+		return slices.ContainsFunc(roles, func(role string) bool {
+			return slices.Contains(list, role)
+		})
+	}
+
+	switch {
+	case slices.Contains(rule.DenyUsers, userID):
+		return false, true
+	case slices.Contains(rule.AllowUsers, userID):
+		return true, true
+	case hasRole(rule.DenyRoles):
+		return false, true
+	case hasRole(rule.AllowRoles):
+		return true, true
+	case len(rule.AllowRoles) > 0 || len(rule.AllowUsers) > 0:
+		// an allow list excludes everyone else
+		return false, true
+	}
+	return false, false
+}
+
+func (rule accessRule) isEmpty() bool {
+	return len(rule.AllowRoles) == 0 && len(rule.DenyRoles) == 0 && len(rule.AllowUsers) == 0 && len(rule.DenyUsers) == 0
+}
+
+// checkPermissions checks the default member permissions of a command, as
+// discord does before sending the interaction.
+func checkPermissions(member *discordgo.Member, required *int64) error {
+	if required == nil || *required == 0 {
+		return nil
+	}
+	if member.Permissions&discordgo.PermissionAdministrator != 0 || member.Permissions&*required == *required {
+		return nil
+	}
+
+	var missing []string
+	for permission, name := range permissionNames {
+		if *required&permission != 0 && member.Permissions&permission == 0 {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+
+	if len(missing) == 0 {
+		return errors.New("You don't have the permissions to use this command.")
+	}
+	return fmt.Errorf("You need the %s permission to use this command.", strings.Join(missing, ", "))
+}
+
+func (access *access) rule(guildID string, command string) (accessRule, error) {
+	var rule accessRule
+
+	err := access.store.View(func(tx storage.Tx) error {
+		return storage.GetJSON(tx, accessBucket, storage.Key(guildID, command), &rule)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return accessRule{}, nil
+	}
+	return rule, err
+}
+
+// updateRule changes the rule of a command. Empty rules are deleted.
+func (access *access) updateRule(guildID string, command string, change func(rule *accessRule)) error {
+	key := storage.Key(guildID, command)
+
+	return access.store.Update(func(tx storage.Tx) error {
+		var rule accessRule
+		err := storage.GetJSON(tx, accessBucket, key, &rule)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+
+		change(&rule)
+
+		if rule.isEmpty() {
+			return tx.Delete(accessBucket, key)
+		}
+		return storage.PutJSON(tx, accessBucket, key, rule)
+	})
+}
+
+// accessTarget is the role or user given as the target option.
+type accessTarget struct {
+	id     string
+	isRole bool
+}
+
+func (target accessTarget) String() string {
+	if target.isRole {
+		return "<@&" + target.id + ">"
+	}
+	return "<@" + target.id + ">"
+}
+
+// accessOptions returns the command and target options of an /access
+// subcommand. The command is empty if it doesn't exist.
+func (access *access) accessOptions(i *discordgo.InteractionCreate) (string, *accessTarget) {
+	data := i.ApplicationCommandData()
+	_, options := router.SubcommandPath(data.Options)
+	byName := router.Options(options)
+
+	command := strings.TrimPrefix(byName["command"].StringValue(), "/")
+	if !slices.ContainsFunc(access.router.Commands(), func(c *router.Command) bool {
+		return c.Definition.Name == command
+	}) {
+		command = ""
+	}
+
+	option, exists := byName["target"]
+	if !exists {
+		return command, nil
+	}
+
+	id, _ := option.Value.(string)
+	_, isRole := data.Resolved.Roles[id]
+	return command, &accessTarget{id: id, isRole: isRole}
+}
+
+// without returns list without id.
+func without(list []string, id string) []string {
+	return slices.DeleteFunc(slices.Clone(list), func(value string) bool {
+		return value == id
+	})
+}
+
+// withID returns list with id added once.
+func withID(list []string, id string) []string {
+	if slices.Contains(list, id) {
+		return list
+	}
+	return append(list, id)
+}
+
+func (access *access) allowCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	access.changeCommand(s, i, true)
+}
+
+func (access *access) denyCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	access.changeCommand(s, i, false)
+}
+
+// changeCommand allows or denies the target the use of a command.
+func (access *access) changeCommand(s *discordgo.Session, i *discordgo.InteractionCreate, allow bool) {
+	command, target := access.accessOptions(i)
+	if command == "" {
+		respond(s, i, "This command doesn't exist.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	err := access.updateRule(i.GuildID, command, func(rule *accessRule) {
+		// a target is either allowed or denied
+		if target.isRole {
+			rule.AllowRoles = without(rule.AllowRoles, target.id)
+			rule.DenyRoles = without(rule.DenyRoles, target.id)
+			if allow {
+				rule.AllowRoles = withID(rule.AllowRoles, target.id)
+			} else {
+				rule.DenyRoles = withID(rule.DenyRoles, target.id)
+			}
+		} else {
+			rule.AllowUsers = without(rule.AllowUsers, target.id)
+			rule.DenyUsers = without(rule.DenyUsers, target.id)
+			if allow {
+				rule.AllowUsers = withID(rule.AllowUsers, target.id)
+			} else {
+				rule.DenyUsers = withID(rule.DenyUsers, target.id)
+			}
+		}
+	})
+	if err != nil {
+		log.Println("Failed to save access rule: ", err)
+		respond(s, i, "Could not save the rule.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	if allow {
+		respond(s, i, fmt.Sprintf("%s may now use /%s.", target, command), discordgo.MessageFlagsEphemeral)
+	} else {
+		respond(s, i, fmt.Sprintf("%s may no longer use /%s.", target, command), discordgo.MessageFlagsEphemeral)
+	}
+}
+
+func (access *access) clearCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	command, target := access.accessOptions(i)
+	if command == "" {
+		respond(s, i, "This command doesn't exist.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	err := access.updateRule(i.GuildID, command, func(rule *accessRule) {
+		if target == nil {
+			*rule = accessRule{}
+			return
+		}
+
+		rule.AllowRoles = without(rule.AllowRoles, target.id)
+		rule.DenyRoles = without(rule.DenyRoles, target.id)
+		rule.AllowUsers = without(rule.AllowUsers, target.id)
+		rule.DenyUsers = without(rule.DenyUsers, target.id)
+	})
+	if err != nil {
+		log.Println("Failed to save access rule: ", err)
+		respond(s, i, "Could not save the rule.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	if target == nil {
+		respond(s, i, fmt.Sprintf("Removed the rule of /%s.", command), discordgo.MessageFlagsEphemeral)
+	} else {
+		respond(s, i, fmt.Sprintf("Removed %s from the rule of /%s.", target, command), discordgo.MessageFlagsEphemeral)
+	}
+}
+
+func formatMentions(ids []string, prefix string) string {
+	mentions := make([]string, 0, len(ids))
+	for _, id := range ids {
+		mentions = append(mentions, "<"+prefix+id+">")
+	}
+	return strings.Join(mentions, ", ")
+}
+
+func (access *access) listCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	fields := []*discordgo.MessageEmbedField{}
+
+	err := access.store.View(func(tx storage.Tx) error {
+		return tx.ForEach(accessBucket, storage.Prefix(i.GuildID), func(key string, value []byte) error {
+			var rule accessRule
+			if err := json.Unmarshal(value, &rule); err != nil {
+				return err
+			}
+
+			var lines []string
+			if len(rule.AllowRoles)+len(rule.AllowUsers) > 0 {
+				lines = append(lines, "Allowed: "+formatMentions(rule.AllowRoles, "@&")+" "+formatMentions(rule.AllowUsers, "@"))
+			}
+			if len(rule.DenyRoles)+len(rule.DenyUsers) > 0 {
+				lines = append(lines, "Denied: "+formatMentions(rule.DenyRoles, "@&")+" "+formatMentions(rule.DenyUsers, "@"))
+			}
+
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:  "/" + strings.TrimPrefix(key, storage.Prefix(i.GuildID)),
+				Value: strings.Join(lines, "\n"),
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println("Failed to read access rules: ", err)
+		respond(s, i, "Could not read the rules.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	if len(fields) == 0 {
+		respond(s, i, "There are no access rules. Every command uses its default permissions.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:  "Access rules",
+					Fields: fields,
+					Color:  convertHexColorToInt("F4B8E4"),
+				},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send interaction response: ", rErr)
+	}
+}
+
+// autocompleteCommand suggests the commands of the bot.
+func (access *access) autocompleteCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	focused := router.Focused(i.ApplicationCommandData().Options)
+	input := ""
+	if focused != nil {
+		input = strings.ToLower(focused.StringValue())
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, command := range access.router.Commands() {
+		name := command.Definition.Name
+		if !strings.Contains(name, input) || len(choices) == 25 {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: "/" + name, Value: name})
+	}
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send autocomplete response: ", rErr)
+	}
+}
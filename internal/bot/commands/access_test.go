@@ -0,0 +1,173 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"fmt"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// accessCommand is an /access subcommand with target as a resolved user or
+// role, the way discord sends mentionables.
+func accessCommand(member *discordgo.Member, name string, commandName string, target string, isRole bool) *discordgo.InteractionCreate {
+	i := command(member, "access", subcommand(name,
+		stringOption("command", commandName), &dataOption{Type: discordgo.ApplicationCommandOptionMentionable, Name: "target", Value: target}))
+
+	data := i.ApplicationCommandData()
+	data.Resolved = &discordgo.ApplicationCommandInteractionDataResolved{}
+	if isRole {
+		data.Resolved.Roles = map[string]*discordgo.Role{target: {ID: target}}
+	} else {
+		data.Resolved.Users = map[string]*discordgo.User{target: {ID: target}}
+	}
+	i.Data = data
+	return i
+}
+
+func TestAccessConcurrently(t *testing.T) {
+	bot := newTestBot(t)
+	access := newAccess(bot.store, bot.config, bot.router)
+	access.register(bot.session, bot.router)
+	newCounter(bot.store, newSettings(bot.store, bot.config)).register(bot.session, bot.router)
+	admin := bot.member(testAdminID)
+
+	// even users end up denied /count, odd users are denied and cleared again
+	concurrently(testUsers, func(n int) {
+		userID := testUserID(n)
+		member := bot.member(userID)
+
+		for range 5 {
+			deny := bot.handle(accessCommand(admin, "deny", "count", userID, false))
+			if content := bot.api.content(t, deny); content != fmt.Sprintf("<@%s> may no longer use /count.", userID) {
+				t.Errorf("/access deny = %q", content)
+			}
+			if n%2 == 1 {
+				bot.handle(accessCommand(admin, "clear", "count", userID, false))
+			}
+
+			bot.handle(accessCommand(admin, "deny", "leaderboard", testRoleA, true))
+			bot.handle(command(admin, "access", subcommand("list")))
+			bot.handle(autocomplete(admin, "access", subcommand("deny", focused(stringOption("command", "co")))))
+
+			// plain members may neither change the rules nor list the trackers
+			if content := bot.api.content(t, bot.handle(accessCommand(member, "clear", "count", userID, false))); content != "You need the Manage Server permission to use this command." {
+				t.Errorf("/access clear by a member = %q", content)
+			}
+			bot.handle(command(member, "count", subcommand("show", stringOption("tracker", "kok"))))
+		}
+	})
+
+	rule, err := access.rule(testGuildID, "count")
+	if err != nil {
+		t.Fatal("failed to read rule: ", err)
+	}
+	if len(rule.DenyUsers) != testUsers/2 {
+		t.Errorf("/count denies %d users, want %d", len(rule.DenyUsers), testUsers/2)
+	}
+
+	for n := range testUsers {
+		i := bot.handle(command(bot.member(testUserID(n)), "count", subcommand("show", stringOption("tracker", "kok"))))
+		denied := bot.api.content(t, i) == "You are not allowed to use /count."
+		if denied != (n%2 == 0) {
+			t.Errorf("user %d denied = %v, want %v", n, denied, n%2 == 0)
+		}
+	}
+
+	rule, _ = access.rule(testGuildID, "leaderboard")
+	if len(rule.DenyRoles) != 1 {
+		t.Errorf("/leaderboard denies %d roles, want 1", len(rule.DenyRoles))
+	}
+}
+
+func TestAccessRules(t *testing.T) {
+	bot := newTestBot(t)
+	newAccess(bot.store, bot.config, bot.router).register(bot.session, bot.router)
+	newCounter(bot.store, newSettings(bot.store, bot.config)).register(bot.session, bot.router)
+	admin := bot.member(testAdminID)
+	member := bot.member(testUserID(0))
+
+	// allowing a member doesn't grant the default permissions of a command
+	bot.handle(accessCommand(admin, "allow", "counter", member.User.ID, false))
+	if content := bot.api.content(t, bot.handle(command(member, "counter", subcommand("list")))); content != "You need the Manage Server permission to use this command." {
+		t.Errorf("/counter list by an allowed member = %q", content)
+	}
+
+	// @everyone is every member
+	bot.handle(accessCommand(admin, "deny", "leaderboard", testGuildID, true))
+	if content := bot.api.content(t, bot.handle(command(member, "leaderboard", stringOption("tracker", "kok")))); content != "You are not allowed to use /leaderboard." {
+		t.Errorf("/leaderboard with @everyone denied = %q", content)
+	}
+
+	// and the buttons of a command are denied with it
+	if content := bot.api.content(t, bot.handle(button(member, "leaderboard:kok:1"))); content != "You are not allowed to use /leaderboard." {
+		t.Errorf("leaderboard button with @everyone denied = %q", content)
+	}
+}
+
+func TestAccessDecisions(t *testing.T) {
+	bot := newTestBot(t)
+	bot.setConfig(fmt.Sprintf("owners: [%q]\n", testOwnerID))
+	newAccess(bot.store, bot.config, bot.router).register(bot.session, bot.router)
+
+	pong := func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		respond(s, i, "pong", 0)
+	}
+	manageGuild := int64(discordgo.PermissionManageServer)
+	bot.router.Add(&router.Command{Definition: &discordgo.ApplicationCommand{Name: "ping"}, Handler: pong})
+	bot.router.Add(&router.Command{Definition: &discordgo.ApplicationCommand{Name: "shutdown"}, Handler: pong, OwnerOnly: true})
+	bot.router.Add(&router.Command{Definition: &discordgo.ApplicationCommand{Name: "manage", DefaultMemberPermissions: &manageGuild}, Handler: pong})
+
+	admin := bot.member(testAdminID)
+	withRoles := func(n int, roles ...string) *discordgo.Member {
+		member := bot.member(testUserID(n))
+		member.Roles = roles
+		return member
+	}
+	plain, roleA, bothRoles := withRoles(0), withRoles(1, testRoleA), withRoles(2, testRoleA, testRoleB)
+
+	dm := command(nil, "manage")
+	dm.GuildID = ""
+	dm.User = plain.User
+
+	const denied = "You are not allowed to use /ping."
+	steps := []struct {
+		i    *discordgo.InteractionCreate
+		want string
+	}{
+		{command(plain, "ping"), "pong"},
+		{command(bot.member(testOwnerID), "shutdown"), "pong"},
+		{command(admin, "shutdown"), "Only the owner of the bot can use this command."},
+		{dm, "This command can only be used in a server."},
+		{accessCommand(admin, "allow", "unknown", testRoleA, true), "This command doesn't exist."},
+
+		// an allowed role excludes everyone else
+		{accessCommand(admin, "allow", "ping", testRoleA, true), "<@&" + testRoleA + "> may now use /ping."},
+		{command(plain, "ping"), denied},
+		{command(roleA, "ping"), "pong"},
+		// owners aren't bound by rules
+		{command(bot.member(testOwnerID), "ping"), "pong"},
+
+		// a denied role wins over an allowed one
+		{accessCommand(admin, "deny", "ping", testRoleB, true), "<@&" + testRoleB + "> may no longer use /ping."},
+		{command(bothRoles, "ping"), denied},
+
+		// users win over roles
+		{accessCommand(admin, "allow", "ping", bothRoles.User.ID, false), "<@" + bothRoles.User.ID + "> may now use /ping."},
+		{command(bothRoles, "ping"), "pong"},
+		{accessCommand(admin, "deny", "ping", roleA.User.ID, false), "<@" + roleA.User.ID + "> may no longer use /ping."},
+		{command(roleA, "ping"), denied},
+
+		// clearing a target or the whole rule
+		{accessCommand(admin, "clear", "ping", roleA.User.ID, false), "Removed <@" + roleA.User.ID + "> from the rule of /ping."},
+		{command(roleA, "ping"), "pong"},
+		{command(admin, "access", subcommand("clear", stringOption("command", "/ping"))), "Removed the rule of /ping."},
+		{command(plain, "ping"), "pong"},
+		{command(bothRoles, "ping"), "pong"},
+	}
+	for index, step := range steps {
+		if content := bot.api.content(t, bot.handle(step.i)); content != step.want {
+			t.Errorf("step %d = %q, want %q", index, content, step.want)
+		}
+	}
+}
@@ -0,0 +1,527 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	autoReactionBucket = "autoReactionRules"
+	// maxAutoReactions is how many emojis a single rule may add.
+	maxAutoReactions = 5
+)
+
+// Kinds of message triggers.
+const (
+	triggerKeyword = "keyword" // the message contains the pattern, ignoring case
+	triggerRegex   = "regex"   // a case insensitive regular expression
+	triggerAny     = "any"     // every message in the scope of the rule
+)
+
+// messageTrigger matches the content of messages.
+type messageTrigger struct {
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern,omitempty"`
+
+	regex *regexp.Regexp
+}
+
+func newMessageTrigger(kind string, pattern string) (messageTrigger, error) {
+	pattern = strings.TrimSpace(pattern)
+
+	switch kind {
+	case triggerKeyword:
+		if pattern == "" {
+			return messageTrigger{}, errors.New("the keyword is empty")
+		}
+	case triggerRegex:
+		if pattern == "" {
+			return messageTrigger{}, errors.New("the regular expression is empty")
+		}
+		if len(pattern) > 200 {
+			return messageTrigger{}, errors.New("the regular expression is too long")
+		}
+	case triggerAny:
+		pattern = ""
+	default:
+		return messageTrigger{}, fmt.Errorf("unknown trigger %q", kind)
+	}
+
+	trigger := messageTrigger{Kind: kind, Pattern: pattern}
+	if err := trigger.compile(); err != nil {
+		return messageTrigger{}, err
+	}
+	return trigger, nil
+}
+
+func (trigger *messageTrigger) compile() error {
+	if trigger.Kind != triggerRegex {
+		return nil
+	}
+
+	regex, err := regexp.Compile("(?i)" + trigger.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid regular expression: %w", err)
+	}
+	trigger.regex = regex
+	return nil
+}
+
+func (trigger messageTrigger) matches(content string) bool {
+	switch trigger.Kind {
+	case triggerKeyword:
+		return strings.Contains(strings.ToLower(content), strings.ToLower(trigger.Pattern))
+	case triggerRegex:
+		return trigger.regex.MatchString(content)
+	case triggerAny:
+		return true
+	}
+	return false
+}
+
+func (trigger messageTrigger) String() string {
+	switch trigger.Kind {
+	case triggerKeyword:
+		return fmt.Sprintf("%q", trigger.Pattern)
+	case triggerRegex:
+		return "`" + trigger.Pattern + "`"
+	}
+	return "every message"
+}
+
+// autoReactionRule reacts to messages that match its trigger.
+type autoReactionRule struct {
+	ID      string         `json:"id"`
+	Trigger messageTrigger `json:"trigger"`
+	ruleScope
+	Authors []string `json:"authors,omitempty"`
+	Emojis  []string `json:"emojis"` // in the format of the API
+	// Cooldown is the time between two reactions of the rule in a channel.
+	Cooldown time.Duration `json:"cooldown,omitempty"`
+	// Limit is how often the rule reacts per channel and hour, 0 means no
+	// limit.
+	Limit int `json:"limit,omitempty"`
+}
+
+func (rule *autoReactionRule) String() string {
+	emojis := make([]string, 0, len(rule.Emojis))
+	for _, emoji := range rule.Emojis {
+		emojis = append(emojis, formatAPIEmoji(emoji))
+	}
+
+	text := fmt.Sprintf("**#%s** %s: %s", rule.ID, rule.Trigger, strings.Join(emojis, " "))
+	if scope := rule.ruleScope.String(); scope != "" {
+		text += " " + scope
+	}
+	for _, author := range rule.Authors {
+		text += " from <@" + author + ">"
+	}
+	if rule.Cooldown > 0 {
+		text += ", cooldown " + rule.Cooldown.String()
+	}
+	if rule.Limit > 0 {
+		text += fmt.Sprintf(", %d per hour", rule.Limit)
+	}
+	return text
+}
+
+// parseEmojis turns a list of emojis separated by spaces or commas into the
+// format of the API.
+func parseEmojis(input string) ([]string, error) {
+	var emojis []string
+	for _, field := range strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		if match := customEmojiRegex.FindStringSubmatch(field); match != nil {
+			emojis = append(emojis, match[2]+":"+match[3])
+		} else if strings.HasPrefix(field, "<") || strings.HasPrefix(field, ":") {
+			return nil, fmt.Errorf("%q is not an emoji", field)
+		} else {
+			emojis = append(emojis, field)
+		}
+	}
+
+	if len(emojis) == 0 {
+		return nil, errors.New("no emojis given")
+	}
+	if len(emojis) > maxAutoReactions {
+		return nil, fmt.Errorf("a rule can add up to %d emojis", maxAutoReactions)
+	}
+	return slices.Compact(emojis), nil
+}
+
+// formatAPIEmoji turns an emoji in the format of the API back into one that
+// shows up in messages.
+func formatAPIEmoji(emoji string) string {
+	if name, id, custom := strings.Cut(emoji, ":"); custom {
+		return "<:" + name + ":" + id + ">"
+	}
+	return emoji
+}
+
+func (reactions *reactions) registerAutoReactions(bot *discordgo.Session, r *router.Router) {
+	// add handlers
+	bot.AddHandler(reactions.autoReactionListener)
+
+	manageGuild := int64(discordgo.PermissionManageServer)
+	minLimit := float64(1)
+
+	// add commands
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:                     "autoreact",
+			Description:              "Manages reactions the bot adds to messages.",
+			DefaultMemberPermissions: &manageGuild,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "add",
+					Description: "Adds a rule that reacts to messages.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "trigger",
+							Description: "Which messages get reactions",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "containing a keyword", Value: triggerKeyword},
+								{Name: "matching a regular expression", Value: triggerRegex},
+								{Name: "every message", Value: triggerAny},
+							},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "emojis",
+							Description: "The emojis to react with, separated by spaces",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "pattern",
+							Description: "The keyword or regular expression",
+						},
+						{
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							Name:         "channel",
+							Description:  "Only react in this channel",
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Name:        "role",
+							Description: "Only react to members with this role",
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Name:        "author",
+							Description: "Only react to this user",
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "cooldown",
+							Description: "Time between two reactions in a channel, like 30s or 5m",
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "limit",
+							Description: "How often the rule may react per channel and hour",
+							MinValue:    &minLimit,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove",
+					Description: "Removes a rule.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "rule",
+							Description:  "The rule",
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "Shows the auto reaction rules of this server.",
+				},
+			},
+		},
+		Subcommands: map[string]router.Handler{
+			"add":    reactions.addAutoReactionCommand,
+			"remove": reactions.removeAutoReactionCommand,
+			"list":   reactions.listAutoReactionsCommand,
+		},
+		Autocomplete: reactions.autocompleteAutoReaction,
+	})
+}
+
+func (reactions *reactions) readAutoReactions() {
+	err := reactions.store.View(func(tx storage.Tx) error {
+		return tx.ForEach(autoReactionBucket, "", func(key string, value []byte) error {
+			guildID, _, _ := strings.Cut(key, "/")
+
+			rule := &autoReactionRule{}
+			if err := json.Unmarshal(value, rule); err != nil {
+				return err
+			}
+			if err := rule.Trigger.compile(); err != nil {
+				log.Printf("Skipping auto reaction rule %s: %s", key, err)
+				return nil
+			}
+
+			reactions.autoRules[guildID] = append(reactions.autoRules[guildID], rule)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println("Failed to read auto reaction rules: ", err)
+	}
+
+	for _, rules := range reactions.autoRules {
+		sortAutoRules(rules)
+	}
+}
+
+// sortAutoRules orders the auto reaction rules of a guild by ID.
+func sortAutoRules(rules []*autoReactionRule) {
+	slices.SortFunc(rules, func(a, b *autoReactionRule) int {
+		return compareRuleIDs(a.ID, b.ID)
+	})
+}
+
+// guildAutoRules returns the auto reaction rules of a guild.
+func (reactions *reactions) guildAutoRules(guildID string) []*autoReactionRule {
+	reactions.mu.RLock()
+	defer reactions.mu.RUnlock()
+
+	return slices.Clone(reactions.autoRules[guildID])
+}
+
+// autoReactionHistory holds the recent reactions of a rule in a channel.
+type autoReactionHistory struct {
+	last time.Time   // for the cooldown, which may be longer than an hour
+	hour []time.Time // for the limit
+}
+
+// allowAutoReaction reports whether a rule may react in a channel now and
+// remembers the reaction if so.
+func (reactions *reactions) allowAutoReaction(guildID string, rule *autoReactionRule, channelID string, now time.Time) bool {
+	if rule.Cooldown <= 0 && rule.Limit <= 0 {
+		return true
+	}
+
+	key := storage.Key(guildID, rule.ID, channelID)
+
+	reactions.mu.Lock()
+	defer reactions.mu.Unlock()
+
+	reacted, exists := reactions.autoReacted[key]
+	if !exists {
+		reacted = &autoReactionHistory{}
+		reactions.autoReacted[key] = reacted
+	}
+
+	// only the last hour counts towards the limit
+	reacted.hour = slices.DeleteFunc(reacted.hour, func(t time.Time) bool {
+		return now.Sub(t) >= time.Hour
+	})
+
+	if !reacted.last.IsZero() && now.Sub(reacted.last) < rule.Cooldown {
+		return false
+	}
+	if rule.Limit > 0 && len(reacted.hour) >= rule.Limit {
+		return false
+	}
+
+	reacted.last = now
+	reacted.hour = append(reacted.hour, now)
+	return true
+}
+
+func (reactions *reactions) autoReactionListener(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if m.GuildID == "" || m.Author == nil || m.Author.Bot {
+		return
+	}
+
+	var roles []string
+	if m.Member != nil {
+		roles = m.Member.Roles
+	}
+
+	for _, rule := range reactions.guildAutoRules(m.GuildID) {
+		if !rule.applies(m.ChannelID, roles) {
+			continue
+		}
+		if len(rule.Authors) > 0 && !slices.Contains(rule.Authors, m.Author.ID) {
+			continue
+		}
+		if !rule.Trigger.matches(m.Content) || !reactions.allowAutoReaction(m.GuildID, rule, m.ChannelID, time.Now()) {
+			continue
+		}
+
+		for _, emoji := range rule.Emojis {
+			if err := s.MessageReactionAdd(m.ChannelID, m.ID, emoji); err != nil {
+				log.Println("Failed to add auto reaction: ", err)
+			}
+		}
+	}
+}
+
+func (reactions *reactions) addAutoReactionCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+
+	pattern := ""
+	if option, exists := byName["pattern"]; exists {
+		pattern = option.StringValue()
+	}
+
+	trigger, err := newMessageTrigger(byName["trigger"].StringValue(), pattern)
+	if err != nil {
+		respond(s, i, fmt.Sprintf("Could not add the rule: %s", err), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	emojis, err := parseEmojis(byName["emojis"].StringValue())
+	if err != nil {
+		respond(s, i, fmt.Sprintf("Could not add the rule: %s", err), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	rule := &autoReactionRule{Trigger: trigger, ruleScope: scopeFromOptions(byName), Emojis: emojis}
+	if option, exists := byName["author"]; exists {
+		rule.Authors = []string{option.Value.(string)}
+	}
+	if option, exists := byName["cooldown"]; exists {
+		rule.Cooldown, err = time.ParseDuration(strings.TrimSpace(option.StringValue()))
+		if err != nil || rule.Cooldown < 0 {
+			respond(s, i, fmt.Sprintf("%q is not a duration. Use something like 30s or 5m.", option.StringValue()), discordgo.MessageFlagsEphemeral)
+			return
+		}
+	}
+	if option, exists := byName["limit"]; exists {
+		rule.Limit = int(option.IntValue())
+	}
+	if rule.Trigger.Kind == triggerAny && len(rule.Channels) == 0 && len(rule.Roles) == 0 && len(rule.Authors) == 0 {
+		respond(s, i, "A rule for every message needs a channel, role or author.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	reactions.mu.Lock()
+	ids := []string{}
+	for _, existing := range reactions.autoRules[i.GuildID] {
+		ids = append(ids, existing.ID)
+	}
+
+	err = reactions.store.Update(func(tx storage.Tx) error {
+		var err error
+		if rule.ID, err = nextRuleID(tx, autoReactionBucket, i.GuildID, ids); err != nil {
+			return err
+		}
+		return storage.PutJSON(tx, autoReactionBucket, storage.Key(i.GuildID, rule.ID), rule)
+	})
+	if err == nil {
+		reactions.autoRules[i.GuildID] = append(reactions.autoRules[i.GuildID], rule)
+		sortAutoRules(reactions.autoRules[i.GuildID])
+	}
+	reactions.mu.Unlock()
+
+	if err != nil {
+		log.Println("Failed to save auto reaction rule: ", err)
+		respond(s, i, "Could not save the rule.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	respond(s, i, "Added the rule "+rule.String(), discordgo.MessageFlagsEphemeral)
+}
+
+func (reactions *reactions) removeAutoReactionCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	id := strings.TrimPrefix(router.Options(options)["rule"].StringValue(), "#")
+
+	reactions.mu.Lock()
+	defer reactions.mu.Unlock()
+
+	if !slices.ContainsFunc(reactions.autoRules[i.GuildID], func(rule *autoReactionRule) bool {
+		return rule.ID == id
+	}) {
+		respond(s, i, "There is no such rule.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	err := reactions.store.Update(func(tx storage.Tx) error {
+		return tx.Delete(autoReactionBucket, storage.Key(i.GuildID, id))
+	})
+	if err != nil {
+		log.Println("Failed to remove auto reaction rule: ", err)
+		respond(s, i, "Could not remove the rule.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	reactions.autoRules[i.GuildID] = slices.DeleteFunc(reactions.autoRules[i.GuildID], func(rule *autoReactionRule) bool {
+		return rule.ID == id
+	})
+	for key := range reactions.autoReacted {
+		if strings.HasPrefix(key, storage.Prefix(i.GuildID, id)) {
+			delete(reactions.autoReacted, key)
+		}
+	}
+
+	respond(s, i, fmt.Sprintf("Removed the rule #%s.", id), discordgo.MessageFlagsEphemeral)
+}
+
+func (reactions *reactions) listAutoReactionsCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	rules := reactions.guildAutoRules(i.GuildID)
+	if len(rules) == 0 {
+		respond(s, i, "There are no auto reaction rules. Add one with /autoreact add.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	lines := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		lines = append(lines, rule.String())
+	}
+
+	respond(s, i, truncate(strings.Join(lines, "\n"), 2000), discordgo.MessageFlagsEphemeral)
+}
+
+// autocompleteAutoReaction suggests the auto reaction rules of the guild.
+func (reactions *reactions) autocompleteAutoReaction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	focused := router.Focused(i.ApplicationCommandData().Options)
+	input := ""
+	if focused != nil {
+		input = strings.ToLower(focused.StringValue())
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, rule := range reactions.guildAutoRules(i.GuildID) {
+		name := fmt.Sprintf("#%s %s: %s", rule.ID, rule.Trigger, strings.Join(rule.Emojis, " "))
+		if strings.Contains(strings.ToLower(name), input) && len(choices) < 25 {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: truncate(name, 100), Value: rule.ID})
+		}
+	}
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send autocomplete response: ", rErr)
+	}
+}
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"GoBot/internal/storage"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestAutoReactions(t *testing.T) {
+	bot := newTestBot(t)
+	reactions := newReactions(bot.store, newSettings(bot.store, bot.config))
+	reactions.register(bot.session, bot.router)
+	admin := bot.member(testAdminID)
+
+	add := func(options ...*dataOption) string {
+		i := bot.handle(command(admin, "autoreact", subcommand("add", options...)))
+		return bot.api.content(t, i)
+	}
+	for _, options := range [][]*dataOption{
+		{stringOption("trigger", triggerKeyword), stringOption("pattern", "hello"), stringOption("emojis", "👋")},
+		{stringOption("trigger", triggerRegex), stringOption("pattern", `^gm\b`), stringOption("emojis", "☀️ <:kok:1324540733222289490>"), channelOption("channel", testChannel)},
+		{stringOption("trigger", triggerAny), stringOption("emojis", "⭐"), userOption("author", testUserID(1))},
+		{stringOption("trigger", triggerKeyword), stringOption("pattern", "spam"), stringOption("emojis", "🥫"), stringOption("cooldown", "6h")},
+		{stringOption("trigger", triggerKeyword), stringOption("pattern", "limit"), stringOption("emojis", "🔢"), intOption("limit", 2)},
+	} {
+		if content := add(options...); !strings.HasPrefix(content, "Added the rule") {
+			t.Fatalf("/autoreact add = %q", content)
+		}
+	}
+
+	for _, options := range [][]*dataOption{
+		{stringOption("trigger", triggerAny), stringOption("emojis", "⭐")},
+		{stringOption("trigger", triggerKeyword), stringOption("pattern", "x"), stringOption("emojis", "⭐"), stringOption("cooldown", "soon")},
+		{stringOption("trigger", triggerKeyword), stringOption("pattern", "x"), stringOption("emojis", ":star:")},
+		{stringOption("trigger", triggerKeyword), stringOption("pattern", "x"), stringOption("emojis", "1 2 3 4 5 6")},
+		{stringOption("trigger", triggerRegex), stringOption("pattern", "("), stringOption("emojis", "⭐")},
+		{stringOption("trigger", triggerKeyword), stringOption("emojis", "⭐")},
+	} {
+		if content := add(options...); strings.HasPrefix(content, "Added") {
+			t.Errorf("%v was added: %q", options, content)
+		}
+	}
+
+	// send returns how many reactions the bot added to a new message
+	send := func(userID string, channelID string, content string) int {
+		m := &discordgo.Message{
+			ID:        snowflake(time.Now()),
+			ChannelID: channelID,
+			GuildID:   testGuildID,
+			Author:    &discordgo.User{ID: userID, Bot: userID == testBotID},
+			Content:   content,
+		}
+		reactions.autoReactionListener(bot.session, &discordgo.MessageCreate{Message: m})
+		return bot.api.count("PUT channels/" + channelID + "/messages/" + m.ID + "/")
+	}
+
+	tests := []struct {
+		userID, channelID, content string
+		reactions                  int
+	}{
+		{testUserID(0), testChannel, "Well, HELLO there", 1},
+		{testUserID(0), testChannel, "gm everyone", 2},
+		{testUserID(0), testChannel, "GM", 2},
+		{testUserID(0), testChannel, "not gm", 0},
+		{testUserID(0), testStarboard, "gm", 0},
+		{testUserID(1), testStarboard, "anything", 1},
+		{testUserID(1), testChannel, "hello", 2},
+		{testBotID, testChannel, "hello", 0},
+	}
+	for _, test := range tests {
+		if got := send(test.userID, test.channelID, test.content); got != test.reactions {
+			t.Errorf("%q by %s in %s got %d reactions, want %d", test.content, test.userID, test.channelID, got, test.reactions)
+		}
+	}
+
+	rule := func(id string) *autoReactionRule {
+		for _, rule := range reactions.guildAutoRules(testGuildID) {
+			if rule.ID == id {
+				return rule
+			}
+		}
+		t.Fatalf("there is no rule #%s", id)
+		return nil
+	}
+	now := time.Now()
+
+	// a cooldown longer than an hour still holds after an hour
+	if got := [2]int{send(testUserID(0), testChannel, "spam"), send(testUserID(0), testChannel, "spam")}; got != [2]int{1, 0} {
+		t.Errorf("reactions to spam twice = %v, want one", got)
+	}
+	if reactions.allowAutoReaction(testGuildID, rule("4"), testChannel, now.Add(2*time.Hour)) {
+		t.Error("a 6h cooldown allowed a reaction after 2h")
+	}
+	if !reactions.allowAutoReaction(testGuildID, rule("4"), testChannel, now.Add(6*time.Hour+time.Minute)) {
+		t.Error("a 6h cooldown didn't allow a reaction after it ran out")
+	}
+	// the cooldown is per channel
+	if send(testUserID(0), testStarboard, "spam") != 1 {
+		t.Error("the cooldown of a rule held in another channel")
+	}
+
+	// the limit counts the last hour
+	if got := [3]int{send(testUserID(0), testChannel, "limit"), send(testUserID(0), testChannel, "limit"), send(testUserID(0), testChannel, "limit")}; got != [3]int{1, 1, 0} {
+		t.Errorf("reactions to the limited rule = %v, want two", got)
+	}
+	if !reactions.allowAutoReaction(testGuildID, rule("5"), testChannel, now.Add(time.Hour+time.Minute)) {
+		t.Error("the limit still held an hour later")
+	}
+
+	// a removed rule leaves nothing behind
+	remove := bot.handle(command(admin, "autoreact", subcommand("remove", stringOption("rule", "#4"))))
+	if content := bot.api.content(t, remove); content != "Removed the rule #4." {
+		t.Errorf("/autoreact remove = %q", content)
+	}
+	if send(testUserID(0), testChannel, "spam") != 0 {
+		t.Error("a removed rule still reacts")
+	}
+	reactions.mu.RLock()
+	for key := range reactions.autoReacted {
+		if strings.HasPrefix(key, storage.Prefix(testGuildID, "4")) {
+			t.Errorf("the reactions of the removed rule are still kept as %s", key)
+		}
+	}
+	reactions.mu.RUnlock()
+}
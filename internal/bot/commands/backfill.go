@@ -0,0 +1,292 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	backfillBucket = "counterBackfills"
+	// backfillPageDelay leaves room in the rate limit for everything else
+	// the bot does while a backfill runs.
+	backfillPageDelay = time.Second
+	// backfillEditInterval is how often the progress message is edited.
+	backfillEditInterval = 5 * time.Second
+)
+
+// errTrackerRemoved stops a backfill whose tracker was removed meanwhile.
+var errTrackerRemoved = errors.New("the tracker was removed")
+
+// backfillCheckpoint is how far the backfill of a channel got. Channels are
+// walked from the newest to the oldest message.
+type backfillCheckpoint struct {
+	Before   string `json:"before"` // the oldest message that was counted
+	Messages int    `json:"messages"`
+	Matches  int    `json:"matches"`
+	Done     bool   `json:"done"`
+}
+
+func (counter *counter) backfillCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+
+	t, exists := counter.find(i.GuildID, byName["tracker"].StringValue())
+	if !exists {
+		respond(s, i, "There is no such tracker.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	reset := false
+	if option, exists := byName["reset"]; exists {
+		reset = option.BoolValue()
+	}
+	if t.Legacy && !reset {
+		respond(s, i, fmt.Sprintf("The counts of %s were imported without their messages, so a backfill would count them twice. Use reset:true to drop them and count everything again.", t.Name), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	var channelIDs []string
+	if option, exists := byName["channel"]; exists {
+		channelIDs = append(channelIDs, option.Value.(string))
+	} else {
+		channels, err := s.GuildChannels(i.GuildID)
+		if err != nil {
+			log.Println("Failed to get channels: ", err)
+			respond(s, i, "Could not get the channels of this server.", discordgo.MessageFlagsEphemeral)
+			return
+		}
+		for _, channel := range channels {
+			if channel.Type == discordgo.ChannelTypeGuildText || channel.Type == discordgo.ChannelTypeGuildNews {
+				channelIDs = append(channelIDs, channel.ID)
+			}
+		}
+	}
+
+	counter.mu.Lock()
+	if counter.backfilling[i.GuildID] {
+		counter.mu.Unlock()
+		respond(s, i, "A backfill is already running on this server.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+	counter.backfilling[i.GuildID] = true
+	counter.mu.Unlock()
+
+	if reset && t.Legacy {
+		if err := counter.resetLegacy(i.GuildID, t); err != nil {
+			log.Println("Failed to reset counts: ", err)
+			counter.finishBackfill(i.GuildID)
+			respond(s, i, "Could not reset the counts.", discordgo.MessageFlagsEphemeral)
+			return
+		}
+	}
+
+	respond(s, i, fmt.Sprintf("Started counting %s in %d channels.", t.Name, len(channelIDs)), discordgo.MessageFlagsEphemeral)
+
+	go counter.backfill(s, i.GuildID, i.ChannelID, t, channelIDs)
+}
+
+func (counter *counter) finishBackfill(guildID string) {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	delete(counter.backfilling, guildID)
+}
+
+// resetLegacy sets the counts of a legacy tracker to the sum of its events.
+func (counter *counter) resetLegacy(guildID string, t *tracker) error {
+	err := counter.store.Update(func(tx storage.Tx) error {
+		counts := map[string]int{}
+		err := tx.ForEach(eventBucket, storage.Prefix(guildID, t.Name), func(key string, value []byte) error {
+			var event countEvent
+			if err := json.Unmarshal(value, &event); err != nil {
+				return err
+			}
+			counts[event.UserID] += event.Amount
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := deletePrefix(tx, countBucket, storage.Prefix(guildID, t.Name)); err != nil {
+			return err
+		}
+		for userID, count := range counts {
+			if err := storage.PutJSON(tx, countBucket, storage.Key(guildID, t.Name, userID), count); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return counter.updateTracker(guildID, t.Name, func(t *tracker) error {
+		t.Legacy = false
+		return nil
+	})
+}
+
+// backfill counts the history of channels and reports the progress in a
+// message in reportChannelID. Interrupted backfills continue where they
+// stopped when they are started again.
+func (counter *counter) backfill(s *discordgo.Session, guildID string, reportChannelID string, t *tracker, channelIDs []string) {
+	defer counter.finishBackfill(guildID)
+
+	checkpoints := map[string]backfillCheckpoint{}
+	err := counter.store.View(func(tx storage.Tx) error {
+		for _, channelID := range channelIDs {
+			var checkpoint backfillCheckpoint
+			err := storage.GetJSON(tx, backfillBucket, storage.Key(guildID, t.Name, channelID), &checkpoint)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+			checkpoints[channelID] = checkpoint
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("Failed to read backfill checkpoints: ", err)
+		return
+	}
+
+	// a finished backfill is started over
+	allDone := true
+	for _, checkpoint := range checkpoints {
+		allDone = allDone && checkpoint.Done
+	}
+	if allDone {
+		clear(checkpoints)
+	}
+
+	report, err := s.ChannelMessageSend(reportChannelID, fmt.Sprintf("Counting %s in %d channels...", t.Name, len(channelIDs)))
+	if err != nil {
+		log.Println("Failed to send backfill progress: ", err)
+	}
+
+	lastEdit := time.Now()
+	progress := func(final bool, failed []string) {
+		if report == nil || (!final && time.Since(lastEdit) < backfillEditInterval) {
+			return
+		}
+		lastEdit = time.Now()
+
+		done, messages, matches := 0, 0, 0
+		for _, checkpoint := range checkpoints {
+			messages += checkpoint.Messages
+			matches += checkpoint.Matches
+			if checkpoint.Done {
+				done++
+			}
+		}
+
+		content := fmt.Sprintf("Counting %s: %d of %d channels, %d messages, %d found.", t.Name, done, len(channelIDs), messages, matches)
+		if final {
+			content = fmt.Sprintf("Counted %s: %d of %d channels, %d messages, %d found.", t.Name, done, len(channelIDs), messages, matches)
+		}
+		if len(failed) > 0 {
+			content += "\nCould not read " + formatChannels(failed) + ". Run the backfill again to continue."
+		}
+
+		if _, err := s.ChannelMessageEdit(report.ChannelID, report.ID, content); err != nil {
+			log.Println("Failed to edit backfill progress: ", err)
+		}
+	}
+
+	var failed []string
+	for _, channelID := range channelIDs {
+		if checkpoints[channelID].Done {
+			continue
+		}
+
+		err := counter.backfillChannel(s, guildID, t, channelID, checkpoints, func() { progress(false, failed) })
+		if errors.Is(err, errTrackerRemoved) {
+			if report != nil {
+				if _, err := s.ChannelMessageEdit(report.ChannelID, report.ID, fmt.Sprintf("Stopped counting %s, the tracker was removed.", t.Name)); err != nil {
+					log.Println("Failed to edit backfill progress: ", err)
+				}
+			}
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to backfill channel %s: %s", channelID, err)
+			failed = append(failed, channelID)
+		}
+	}
+
+	progress(true, failed)
+}
+
+// backfillChannel counts the messages of a channel page by page. Each page is
+// stored together with its checkpoint, so no message is counted twice.
+func (counter *counter) backfillChannel(s *discordgo.Session, guildID string, t *tracker, channelID string, checkpoints map[string]backfillCheckpoint, progress func()) error {
+	key := storage.Key(guildID, t.Name, channelID)
+	checkpoint := checkpoints[channelID]
+
+	for !checkpoint.Done {
+		messages, err := s.ChannelMessages(channelID, 100, checkpoint.Before, "", "")
+		var rateLimit *discordgo.RateLimitError
+		if errors.As(err, &rateLimit) {
+			time.Sleep(rateLimit.RetryAfter)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		next := checkpoint
+		next.Done = len(messages) == 0
+
+		err = counter.store.Update(func(tx storage.Tx) error {
+			// the tracker might have been removed (and added again) since
+			// the last page
+			var current tracker
+			err := storage.GetJSON(tx, trackerBucket, storage.Key(guildID, t.Name), &current)
+			if errors.Is(err, storage.ErrNotFound) || (err == nil && !current.Created.Equal(t.Created)) {
+				return errTrackerRemoved
+			}
+			if err != nil {
+				return err
+			}
+
+			for _, m := range messages {
+				next.Messages++
+				next.Before = m.ID
+				if m.Author == nil || m.Author.Bot {
+					continue
+				}
+
+				// milestones aren't checked here, a backfill would announce
+				// them for every user at once. They are announced with the
+				// next counted message of the user.
+				amount := t.count(m.Content)
+				next.Matches += amount
+				if err := applyTx(tx, guildID, t, m.ID, m.Author.ID, amount, true); err != nil {
+					return err
+				}
+			}
+			return storage.PutJSON(tx, backfillBucket, key, next)
+		})
+		if err != nil {
+			return err
+		}
+
+		checkpoint = next
+		checkpoints[channelID] = checkpoint
+		progress()
+
+		if !checkpoint.Done {
+			time.Sleep(backfillPageDelay)
+		}
+	}
+
+	return nil
+}
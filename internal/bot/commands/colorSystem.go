@@ -1,105 +1,260 @@
 package commands
 
 import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/storage"
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-func newColorSystem() colorSystem {
-	colorSystem := colorSystem{
-		roleByGuildByUsers: map[string]map[string][]string{},
-		orderRoleByGuild:   map[string]string{},
-		filePathColorRoles: "assets/data/colorRoles.json",
-		filePathOrderRole:  "assets/data/orderRole.json",
+const (
+	colorRoleBucket = "colorRoles"
+	orderRoleBucket = "orderRoles"
+	// paletteBucket holds the named colors of guilds, by guildID/name.
+	paletteBucket = "colorPalettes"
+
+	maxPaletteColors = 100
+)
+
+var paletteNameRegex = regexp.MustCompile(`^[\p{L}\p{N} _-]{1,32}$`)
+
+func newColorSystem(store storage.Store) *colorSystem {
+	colorSystem := &colorSystem{
+		store:                    store,
+		roleByGuildByUsers:       map[string]map[string][]string{},
+		orderRoleByGuild:         map[string]string{},
+		palettes:                 map[string]map[string]int{},
+		legacyFilePathColorRoles: "assets/data/colorRoles.json",
+		legacyFilePathOrderRole:  "assets/data/orderRole.json",
 	}
 
 	colorSystem.read()
 	return colorSystem
 }
 
-func (colorSystem *colorSystem) register(bot *discordgo.Session) {
+func (colorSystem *colorSystem) register(bot *discordgo.Session, r *router.Router) {
 	// add handlers
-	bot.AddHandler(colorSystem.createRole)
-	bot.AddHandler(colorSystem.setOrderRole)
 	bot.AddHandler(colorSystem.onMemberRoleDelete)
+
+	manageRoles := int64(discordgo.PermissionManageRoles)
+
+	// add commands
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "updatecolor",
+			Description: "Creates, updates or removes your color role",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:         discordgo.ApplicationCommandOptionString,
+					Name:         "color",
+					Description:  "a color of the palette, a color name, hex code, rgb() or hsl()",
+					Required:     false,
+					Autocomplete: true,
+				},
+			},
+		},
+		Handler:      colorSystem.createRole,
+		Autocomplete: colorSystem.autocompleteColor,
+	})
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:                     "colorpalette",
+			Description:              "Manages the named colors members can pick with /updatecolor.",
+			DefaultMemberPermissions: &manageRoles,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "add",
+					Description: "Adds a color to the palette or changes it.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "name",
+							Description: "The name of the color, which color roles get",
+							Required:    true,
+							MaxLength:   32,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "color",
+							Description: "A color name, hex code, rgb() or hsl()",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove",
+					Description: "Removes a color from the palette.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "name",
+							Description:  "The name of the color",
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "Shows the palette of this server.",
+				},
+			},
+		},
+		Subcommands: map[string]router.Handler{
+			"add":    colorSystem.addPaletteColor,
+			"remove": colorSystem.removePaletteColor,
+			"list":   colorSystem.listPalette,
+		},
+		Autocomplete: colorSystem.autocompletePalette,
+	})
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:                     "setcolororderrole",
+			Description:              "The color roles will be added below this role. Set this to the desired role.",
+			DefaultMemberPermissions: &manageRoles,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionRole,
+					Name:        "role",
+					Description: "The order role",
+					Required:    true,
+				},
+			},
+		},
+		Handler: colorSystem.setOrderRole,
+	})
 }
 
 type colorSystem struct {
-	roleByGuildByUsers map[string]map[string][]string //guildID [roleID [users]]
-	orderRoleByGuild   map[string]string
-	filePathColorRoles string
-	filePathOrderRole  string
+	// mu guards the role maps. It is held for a whole command so that role
+	// changes of concurrent commands don't interleave.
+	mu                       sync.Mutex
+	store                    storage.Store
+	roleByGuildByUsers       map[string]map[string][]string //guildID [roleID [users]]
+	orderRoleByGuild         map[string]string
+	paletteMu                sync.RWMutex              // guards palettes
+	palettes                 map[string]map[string]int // guildID [name color]
+	legacyFilePathColorRoles string
+	legacyFilePathOrderRole  string
 }
 
-func (colorSystem colorSystem) write() {
-	orderRoles, err := json.MarshalIndent(colorSystem.orderRoleByGuild, " ", "  ")
+func (colorSystem *colorSystem) write() {
+	err := colorSystem.store.Update(func(tx storage.Tx) error {
+		for guildID, roleID := range colorSystem.orderRoleByGuild {
+			if err := tx.Put(orderRoleBucket, guildID, []byte(roleID)); err != nil {
+				return err
+			}
+		}
+
+		for guildID, roles := range colorSystem.roleByGuildByUsers {
+			if err := storage.PutJSON(tx, colorRoleBucket, guildID, roles); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 
 	if err != nil {
-		log.Fatal("Error marshalling color role data: ", err)
+		log.Println("Error writing color roles: ", err)
 	}
+}
 
-	errWriteOrders := os.WriteFile(colorSystem.filePathOrderRole, orderRoles, 0666)
+func (colorSystem *colorSystem) read() {
+	colorSystem.importLegacy()
 
-	if errWriteOrders != nil {
-		log.Fatal("Error writing color roles to file: ", errWriteOrders)
-	}
+	err := colorSystem.store.View(func(tx storage.Tx) error {
+		oErr := tx.ForEach(orderRoleBucket, "", func(guildID string, roleID []byte) error {
+			colorSystem.orderRoleByGuild[guildID] = string(roleID)
+			return nil
+		})
+		if oErr != nil {
+			return oErr
+		}
 
-	colorRoles, err := json.MarshalIndent(colorSystem.roleByGuildByUsers, " ", "  ")
+		cErr := tx.ForEach(colorRoleBucket, "", func(guildID string, value []byte) error {
+			roles := map[string][]string{}
+			if err := json.Unmarshal(value, &roles); err != nil {
+				return err
+			}
+			colorSystem.roleByGuildByUsers[guildID] = roles
+			return nil
+		})
+		if cErr != nil {
+			return cErr
+		}
 
-	if err != nil {
-		log.Fatal("Error marshalling color role data: ", err)
-	}
+		return tx.ForEach(paletteBucket, "", func(key string, value []byte) error {
+			guildID, name, _ := strings.Cut(key, "/")
 
-	errWriteColors := os.WriteFile(colorSystem.filePathColorRoles, colorRoles, 0666)
+			var color int
+			if err := json.Unmarshal(value, &color); err != nil {
+				return err
+			}
+			if colorSystem.palettes[guildID] == nil {
+				colorSystem.palettes[guildID] = map[string]int{}
+			}
+			colorSystem.palettes[guildID][name] = color
+			return nil
+		})
+	})
 
-	if errWriteColors != nil {
-		log.Fatal("Error writing color roles to file: ", errWriteColors)
+	if err != nil {
+		log.Println("Error reading color roles: ", err)
 	}
 }
 
-func (colorSystem colorSystem) read() {
-	// orderRole.json
-	orderRoles, errRead := os.ReadFile(colorSystem.filePathOrderRole)
+// importLegacy moves orderRole.json and colorRoles.json into the store.
+func (colorSystem *colorSystem) importLegacy() {
+	orderRoles := map[string]string{}
+	hasOrderRoles := readLegacyJSON(colorSystem.legacyFilePathOrderRole, &orderRoles)
+	colorRoles := map[string]map[string][]string{}
+	hasColorRoles := readLegacyJSON(colorSystem.legacyFilePathColorRoles, &colorRoles)
 
-	if errRead != nil {
-		log.Println("Error reading color roles from file: ", errRead)
+	if !hasOrderRoles && !hasColorRoles {
+		return
 	}
 
-	errOrder := json.Unmarshal(orderRoles, &colorSystem.orderRoleByGuild)
+	err := colorSystem.store.Update(func(tx storage.Tx) error {
+		for guildID, roleID := range orderRoles {
+			if err := tx.Put(orderRoleBucket, guildID, []byte(roleID)); err != nil {
+				return err
+			}
+		}
 
-	if errOrder != nil {
-		log.Println("Error unmarshalling color role data: ", errOrder)
+		for guildID, roles := range colorRoles {
+			if err := storage.PutJSON(tx, colorRoleBucket, guildID, roles); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("Error importing color roles: ", err)
+		return
 	}
 
-	// colorRoles.json
-	colorRoles, errRead := os.ReadFile(colorSystem.filePathColorRoles)
-
-	if errRead != nil {
-		log.Println("Error reading color roles from file: ", errRead)
+	if hasOrderRoles {
+		markLegacyImported(colorSystem.legacyFilePathOrderRole)
 	}
-
-	errColor := json.Unmarshal(colorRoles, &colorSystem.roleByGuildByUsers)
-
-	if errColor != nil {
-		log.Println("Error unmarshalling color role data: ", errColor)
+	if hasColorRoles {
+		markLegacyImported(colorSystem.legacyFilePathColorRoles)
 	}
 }
 
-func (colorSystem colorSystem) setOrderRole(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (colorSystem *colorSystem) setOrderRole(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	data := i.ApplicationCommandData()
 
-	if data.Name != "setcolororderrole" {
-		return
-	}
-
 	// check if all options are filled out
 	if data.Options == nil {
 		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -116,6 +271,9 @@ func (colorSystem colorSystem) setOrderRole(s *discordgo.Session, i *discordgo.I
 
 	role := data.Options[0].RoleValue(s, i.GuildID)
 
+	colorSystem.mu.Lock()
+	defer colorSystem.mu.Unlock()
+
 	colorSystem.orderRoleByGuild[i.GuildID] = role.ID
 
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -131,58 +289,66 @@ func (colorSystem colorSystem) setOrderRole(s *discordgo.Session, i *discordgo.I
 	colorSystem.write()
 }
 
-func (colorSystem colorSystem) onMemberRoleDelete(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
-	if slices.Compare(m.Roles, m.BeforeUpdate.Roles) == -1 {
-		guildData := colorSystem.roleByGuildByUsers[m.GuildID]
-		for roleID := range guildData {
-			// check if a color role was removed
-			if slices.Contains(m.BeforeUpdate.Roles, roleID) && !slices.Contains(m.Roles, roleID) {
-				if len(guildData[roleID]) > 1 {
-					for _, userID := range guildData[roleID] {
-						colorSystem.roleByGuildByUsers[m.GuildID][roleID] = slices.DeleteFunc(guildData[roleID], func(id string) bool {
-							return id == userID
-						})
-					}
-				} else {
-					delete(colorSystem.roleByGuildByUsers[m.GuildID], roleID)
-				}
+func (colorSystem *colorSystem) onMemberRoleDelete(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
+	if m.BeforeUpdate == nil {
+		return
+	}
+
+	colorSystem.mu.Lock()
+	defer colorSystem.mu.Unlock()
+
+	changed := false
+	guildData := colorSystem.roleByGuildByUsers[m.GuildID]
+	for roleID, userIDs := range guildData {
+		// check if a color role was removed
+		if slices.Contains(m.BeforeUpdate.Roles, roleID) && !slices.Contains(m.Roles, roleID) {
+			userIDs = slices.DeleteFunc(userIDs, func(id string) bool {
+				return id == m.User.ID
+			})
+
+			if len(userIDs) > 0 {
+				guildData[roleID] = userIDs
+			} else {
+				delete(guildData, roleID)
 			}
+			changed = true
 		}
-		return
 	}
 
-	colorSystem.write()
+	if changed {
+		colorSystem.write()
+	}
 }
 
-func (colorSystem colorSystem) removeRole(s *discordgo.Session, guildID string, memberID string, excludeRoleID string) bool {
+func (colorSystem *colorSystem) removeRole(s *discordgo.Session, guildID string, memberID string, excludeRoleID string) bool {
 	removedRole := false
 	// check if old role needs to be removed
 	guildData := colorSystem.roleByGuildByUsers[guildID]
-	for roleID := range guildData {
-		for index, userID := range guildData[roleID] {
-			if userID == memberID && roleID != excludeRoleID {
-				if len(guildData[roleID]) > 1 {
-					colorSystem.roleByGuildByUsers[guildID][roleID] = append(colorSystem.roleByGuildByUsers[guildID][roleID][:index], colorSystem.roleByGuildByUsers[guildID][roleID][index+1:]...)
-
-					err := s.GuildMemberRoleRemove(guildID, userID, roleID)
+	for roleID, userIDs := range guildData {
+		if roleID == excludeRoleID || !slices.Contains(userIDs, memberID) {
+			continue
+		}
 
-					if err != nil {
-						log.Println("Error occured when removing role of member: ", err)
-					}
+		if len(userIDs) > 1 {
+			guildData[roleID] = slices.DeleteFunc(userIDs, func(id string) bool {
+				return id == memberID
+			})
 
-					removedRole = true
-				} else {
-					delete(colorSystem.roleByGuildByUsers[guildID], roleID)
+			err := s.GuildMemberRoleRemove(guildID, memberID, roleID)
 
-					err := s.GuildRoleDelete(guildID, roleID)
-					if err != nil {
-						log.Println("Error occured when deleting role: ", err)
-					}
+			if err != nil {
+				log.Println("Error occured when removing role of member: ", err)
+			}
+		} else {
+			delete(guildData, roleID)
 
-					removedRole = true
-				}
+			err := s.GuildRoleDelete(guildID, roleID)
+			if err != nil {
+				log.Println("Error occured when deleting role: ", err)
 			}
 		}
+
+		removedRole = true
 	}
 
 	return removedRole
@@ -199,15 +365,14 @@ func convertHexColorToInt(color string) int {
 	return int(colorAsDecimal)
 }
 
-func (colorSystem colorSystem) createRole(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (colorSystem *colorSystem) createRole(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	data := i.ApplicationCommandData()
 
-	if data.Name != "updatecolor" {
-		return
-	}
-
 	guild, _ := s.State.Guild(i.GuildID)
 
+	colorSystem.mu.Lock()
+	defer colorSystem.mu.Unlock()
+
 	// check if the guild has a order role
 	orderRoleID, orderRoleExistsInData := colorSystem.orderRoleByGuild[guild.ID]
 
@@ -215,7 +380,7 @@ func (colorSystem colorSystem) createRole(s *discordgo.Session, i *discordgo.Int
 		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: "You need to create an order role with /setordercolorrole",
+				Content: "You need to create an order role with /setcolororderrole",
 			},
 		})
 		if err != nil {
@@ -230,7 +395,7 @@ func (colorSystem colorSystem) createRole(s *discordgo.Session, i *discordgo.Int
 		rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: "Your order role does not exist anymore. Set a new one with /setordercolorrole",
+				Content: "Your order role does not exist anymore. Set a new one with /setcolororderrole",
 			},
 		})
 		if rErr != nil {
@@ -242,6 +407,9 @@ func (colorSystem colorSystem) createRole(s *discordgo.Session, i *discordgo.Int
 	// check if all options are filled out
 	if data.Options == nil {
 		haveRemovedRole := colorSystem.removeRole(s, guild.ID, i.Member.User.ID, "")
+		if haveRemovedRole {
+			colorSystem.write()
+		}
 
 		content := ""
 		if haveRemovedRole {
@@ -263,14 +431,14 @@ func (colorSystem colorSystem) createRole(s *discordgo.Session, i *discordgo.Int
 		return
 	}
 
-	color := strings.ToLower(data.Options[0].StringValue())
+	roleName, intColor, err := colorSystem.resolveColor(i.GuildID, data.Options[0].StringValue())
 
-	// check hex code
-	if !validateHexCode(color) {
+	// check color
+	if err != nil {
 		rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: "Please enter a correct hex code.",
+				Content: fmt.Sprintf("Please enter a color of the palette, a color name, hex code, rgb() or hsl(): %s.", err),
 			},
 		})
 		if rErr != nil {
@@ -279,14 +447,6 @@ func (colorSystem colorSystem) createRole(s *discordgo.Session, i *discordgo.Int
 		return
 	}
 
-	// remove # if given
-	if strings.HasPrefix(color, "#") {
-		color = color[1:7]
-		log.Println(color)
-	}
-
-	intColor := convertHexColorToInt(color)
-
 	var newRole *discordgo.Role
 	roleAlreadyExists := false
 	// check if role with the same color already exists
@@ -302,7 +462,7 @@ func (colorSystem colorSystem) createRole(s *discordgo.Session, i *discordgo.Int
 
 	if !roleAlreadyExists {
 		role, err := s.GuildRoleCreate(i.GuildID, &discordgo.RoleParams{
-			Name:  color,
+			Name:  roleName,
 			Color: &intColor,
 		})
 
@@ -364,7 +524,7 @@ func (colorSystem colorSystem) createRole(s *discordgo.Session, i *discordgo.Int
 	colorSystem.removeRole(s, guild.ID, i.Member.User.ID, newRole.ID)
 
 	// add role to member
-	err := s.GuildMemberRoleAdd(guild.ID, i.Member.User.ID, newRole.ID)
+	err = s.GuildMemberRoleAdd(guild.ID, i.Member.User.ID, newRole.ID)
 
 	if err != nil {
 		log.Println("Failed adding role to member: ", err)
@@ -383,12 +543,181 @@ func (colorSystem colorSystem) createRole(s *discordgo.Session, i *discordgo.Int
 	}
 }
 
-func validateHexCode(code string) bool {
-	isMatch, err := regexp.MatchString("^#?([a-f0-9]{6})$", code)
+// resolveColor looks a color up in the palette of the guild and parses it
+// otherwise. Colors from the palette or given by name name their role, other
+// roles are named after their hex code.
+func (colorSystem *colorSystem) resolveColor(guildID string, input string) (string, int, error) {
+	name := strings.ToLower(strings.TrimSpace(input))
+	colorSystem.paletteMu.RLock()
+	color, exists := colorSystem.palettes[guildID][name]
+	colorSystem.paletteMu.RUnlock()
+	if exists {
+		return name, roleColor(color), nil
+	}
+
+	color, named, err := parseColor(input)
+	if err != nil {
+		return "", 0, err
+	}
+	if named {
+		return name, roleColor(color), nil
+	}
+	return formatHexColor(color), roleColor(color), nil
+}
+
+// paletteNames returns the names of a guild's palette, sorted. paletteMu
+// needs to be held.
+func (colorSystem *colorSystem) paletteNames(guildID string) []string {
+	names := make([]string, 0, len(colorSystem.palettes[guildID]))
+	for name := range colorSystem.palettes[guildID] {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (colorSystem *colorSystem) addPaletteColor(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+
+	name := strings.ToLower(strings.TrimSpace(byName["name"].StringValue()))
+	if !paletteNameRegex.MatchString(name) {
+		respond(s, i, "Names of colors can only have letters, numbers, spaces, - and _.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	color, _, err := parseColor(byName["color"].StringValue())
+	if err != nil {
+		respond(s, i, fmt.Sprintf("Please enter a color name, hex code, rgb() or hsl(): %s.", err), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	colorSystem.paletteMu.Lock()
+	defer colorSystem.paletteMu.Unlock()
 
+	palette := colorSystem.palettes[i.GuildID]
+	if _, exists := palette[name]; !exists && len(palette) >= maxPaletteColors {
+		respond(s, i, fmt.Sprintf("A palette can have up to %d colors.", maxPaletteColors), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	err = colorSystem.store.Update(func(tx storage.Tx) error {
+		return storage.PutJSON(tx, paletteBucket, storage.Key(i.GuildID, name), color)
+	})
 	if err != nil {
-		log.Print("Error occured while validating hex code", err)
+		log.Println("Error writing color palette: ", err)
+		respond(s, i, "Could not save the color.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	if palette == nil {
+		palette = map[string]int{}
+		colorSystem.palettes[i.GuildID] = palette
+	}
+	palette[name] = color
+
+	respond(s, i, fmt.Sprintf("Added %s (#%s) to the palette.", name, formatHexColor(color)), discordgo.MessageFlagsEphemeral)
+}
+
+func (colorSystem *colorSystem) removePaletteColor(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	name := strings.ToLower(strings.TrimSpace(router.Options(options)["name"].StringValue()))
+
+	colorSystem.paletteMu.Lock()
+	defer colorSystem.paletteMu.Unlock()
+
+	if _, exists := colorSystem.palettes[i.GuildID][name]; !exists {
+		respond(s, i, "The palette has no such color.", discordgo.MessageFlagsEphemeral)
+		return
 	}
 
-	return isMatch
+	err := colorSystem.store.Update(func(tx storage.Tx) error {
+		return tx.Delete(paletteBucket, storage.Key(i.GuildID, name))
+	})
+	if err != nil {
+		log.Println("Error writing color palette: ", err)
+		respond(s, i, "Could not remove the color.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+	delete(colorSystem.palettes[i.GuildID], name)
+
+	respond(s, i, fmt.Sprintf("Removed %s from the palette. Existing color roles stay.", name), discordgo.MessageFlagsEphemeral)
+}
+
+func (colorSystem *colorSystem) listPalette(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	colorSystem.paletteMu.RLock()
+	defer colorSystem.paletteMu.RUnlock()
+
+	names := colorSystem.paletteNames(i.GuildID)
+	if len(names) == 0 {
+		respond(s, i, "The palette is empty. Add colors with /colorpalette add.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("- %s #%s", name, formatHexColor(colorSystem.palettes[i.GuildID][name])))
+	}
+	respond(s, i, truncate(strings.Join(lines, "\n"), 2000), discordgo.MessageFlagsEphemeral)
+}
+
+// autocompleteColor suggests the colors of the palette first and color names
+// after them.
+func (colorSystem *colorSystem) autocompleteColor(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	colorSystem.suggestColors(s, i, true)
+}
+
+// autocompletePalette suggests the colors of the palette.
+func (colorSystem *colorSystem) autocompletePalette(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	colorSystem.suggestColors(s, i, false)
+}
+
+func (colorSystem *colorSystem) suggestColors(s *discordgo.Session, i *discordgo.InteractionCreate, withNames bool) {
+	focused := router.Focused(i.ApplicationCommandData().Options)
+	input := ""
+	if focused != nil {
+		input = strings.ToLower(strings.TrimSpace(focused.StringValue()))
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	suggest := func(name string, color int) {
+		if len(choices) < 25 && strings.Contains(name, input) {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+				Name:  fmt.Sprintf("%s (#%s)", name, formatHexColor(color)),
+				Value: name,
+			})
+		}
+	}
+
+	colorSystem.paletteMu.RLock()
+	palette := colorSystem.palettes[i.GuildID]
+	for _, name := range colorSystem.paletteNames(i.GuildID) {
+		suggest(name, palette[name])
+	}
+
+	// only suggest names once something was typed, there are too many
+	if withNames && input != "" {
+		names := make([]string, 0, len(namedColors))
+		for name := range namedColors {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			// palette colors shadow names
+			if _, exists := palette[name]; !exists {
+				suggest(name, namedColors[name])
+			}
+		}
+	}
+	colorSystem.paletteMu.RUnlock()
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send autocomplete response: ", rErr)
+	}
 }
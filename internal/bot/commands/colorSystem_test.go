@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestColorSystemConcurrently(t *testing.T) {
+	bot := newTestBot(t)
+	colorSystem := newColorSystem(bot.store)
+	colorSystem.register(bot.session, bot.router)
+
+	admin := bot.member(testAdminID)
+	bot.handle(command(admin, "setcolororderrole", roleOption("role", testModRole)))
+
+	colors := []string{"red", "#00ff00", "rgb(0, 0, 255)", "brand", "hsl(120, 100%, 25%)"}
+
+	concurrently(testUsers, func(n int) {
+		member := bot.member(testUserID(n))
+		for index := range 15 {
+			requests := []*discordgo.InteractionCreate{
+				command(admin, "colorpalette", subcommand("add", stringOption("name", "brand"), stringOption("color", fmt.Sprintf("#%06x", index)))),
+				command(admin, "colorpalette", subcommand("add", stringOption("name", fmt.Sprint("color", n)), stringOption("color", "teal"))),
+				command(admin, "colorpalette", subcommand("list")),
+				autocomplete(member, "updatecolor", focused(stringOption("color", "r"))),
+				autocomplete(admin, "colorpalette", subcommand("remove", focused(stringOption("name", "")))),
+				command(member, "updatecolor", stringOption("color", colors[(n+index)%len(colors)])),
+			}
+			if index%5 == 0 {
+				// taking the color role away
+				requests = append(requests, command(member, "updatecolor"))
+			}
+			if index%3 == 0 {
+				requests = append(requests, command(admin, "colorpalette", subcommand("remove", stringOption("name", fmt.Sprint("color", n)))))
+			}
+
+			for _, i := range requests {
+				bot.handle(i)
+				bot.api.response(t, i)
+			}
+
+			// a member losing a role that is no color role changes nothing
+			colorSystem.onMemberRoleDelete(bot.session, &discordgo.GuildMemberUpdate{
+				Member:       &discordgo.Member{GuildID: testGuildID, User: member.User},
+				BeforeUpdate: &discordgo.Member{GuildID: testGuildID, User: member.User, Roles: []string{testRoleA}},
+			})
+		}
+	})
+
+	// every member ends up with exactly one color role
+	colorSystem.mu.Lock()
+	defer colorSystem.mu.Unlock()
+
+	roles := map[string]int{}
+	for _, userIDs := range colorSystem.roleByGuildByUsers[testGuildID] {
+		if len(userIDs) == 0 {
+			t.Error("a color role without members was kept")
+		}
+		for _, userID := range userIDs {
+			roles[userID]++
+		}
+	}
+	for n := range testUsers {
+		if roles[testUserID(n)] != 1 {
+			t.Errorf("user %d has %d color roles, want 1", n, roles[testUserID(n)])
+		}
+	}
+}
+
+func TestResolveBlack(t *testing.T) {
+	bot := newTestBot(t)
+	colorSystem := newColorSystem(bot.store)
+	colorSystem.palettes[testGuildID] = map[string]int{"night": 0}
+
+	// a role with color 0 has no color, black needs to be 1
+	for _, input := range []string{"black", "#000", "rgb(0, 0, 0)", "hsl(0, 0%, 0%)", "night"} {
+		if _, color, err := colorSystem.resolveColor(testGuildID, input); err != nil || color != 0x000001 {
+			t.Errorf("resolveColor(%q) = %06x, %v, want 000001", input, color, err)
+		}
+	}
+}
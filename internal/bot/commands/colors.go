@@ -0,0 +1,284 @@
+package commands
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	hexColorRegex = regexp.MustCompile(`^#?([0-9a-f]{3}|[0-9a-f]{6})$`)
+	// functionColorRegex matches rgb(…) and hsl(…) with commas or spaces
+	// between the values and an optional alpha, which roles can't have.
+	functionColorRegex = regexp.MustCompile(`^(rgba?|hsla?)\(\s*([^\s,]+)[\s,]+([^\s,]+)[\s,]+([^\s,/)]+)(?:\s*[,/]\s*[^\s,)]+)?\s*\)$`)
+)
+
+// parseColor reads a color as a CSS or X11 name, 3 or 6 digit hex code,
+// rgb(r, g, b) or hsl(h, s%, l%). It returns the color and whether it was
+// given by name.
+func parseColor(input string) (int, bool, error) {
+	color := strings.ToLower(strings.TrimSpace(input))
+
+	if value, exists := namedColors[strings.ReplaceAll(color, " ", "")]; exists {
+		return value, true, nil
+	}
+
+	if match := hexColorRegex.FindStringSubmatch(color); match != nil {
+		hex := match[1]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		value, err := strconv.ParseInt(hex, 16, 32)
+		return int(value), false, err
+	}
+
+	match := functionColorRegex.FindStringSubmatch(color)
+	if match == nil {
+		return 0, false, fmt.Errorf("%q is not a color", input)
+	}
+
+	if strings.HasPrefix(match[1], "rgb") {
+		var channels [3]int
+		for index, component := range match[2:5] {
+			value, err := parseColorComponent(component, 255)
+			if err != nil {
+				return 0, false, err
+			}
+			channels[index] = int(math.Round(value))
+		}
+		return channels[0]<<16 | channels[1]<<8 | channels[2], false, nil
+	}
+
+	hue, err := strconv.ParseFloat(strings.TrimSuffix(match[2], "deg"), 64)
+	if err != nil || math.IsNaN(hue) || math.IsInf(hue, 0) {
+		return 0, false, fmt.Errorf("%q is not a hue", match[2])
+	}
+	if !strings.HasSuffix(match[3], "%") || !strings.HasSuffix(match[4], "%") {
+		return 0, false, fmt.Errorf("saturation and lightness of %q need to be percentages", input)
+	}
+	saturation, err := parseColorComponent(match[3], 1)
+	if err != nil {
+		return 0, false, err
+	}
+	lightness, err := parseColorComponent(match[4], 1)
+	if err != nil {
+		return 0, false, err
+	}
+	return hslToRGB(hue, saturation, lightness), false, nil
+}
+
+// parseColorComponent reads a number between 0 and limit, or a percentage
+// of limit.
+func parseColorComponent(component string, limit float64) (float64, error) {
+	number, percent := strings.CutSuffix(component, "%")
+	value, err := strconv.ParseFloat(number, 64)
+	// ParseFloat reads nan and inf, which are no numbers here
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("%q is not a number", component)
+	}
+	if percent {
+		value = value / 100 * limit
+	}
+	if value < 0 || value > limit {
+		return 0, fmt.Errorf("%q is out of range", component)
+	}
+	return value, nil
+}
+
+// hslToRGB converts a hue in degrees and a saturation and lightness between
+// 0 and 1 to a color, as described in CSS Color Module Level 4.
+func hslToRGB(hue float64, saturation float64, lightness float64) int {
+	hue = math.Mod(math.Mod(hue, 360)+360, 360)
+
+	channel := func(n float64) int {
+		k := math.Mod(n+hue/30, 12)
+		a := saturation * min(lightness, 1-lightness)
+		return int(math.Round(255 * (lightness - a*max(-1, min(k-3, 9-k, 1)))))
+	}
+	return channel(0)<<16 | channel(8)<<8 | channel(4)
+}
+
+// roleColor returns the color to give a role for color. Discord shows roles
+// with color 0 in the default color, so black becomes the closest color.
+func roleColor(color int) int {
+	if color == 0 {
+		return 0x000001
+	}
+	return color
+}
+
+// formatHexColor returns a color as a hex code without #, the way color
+// roles are named.
+func formatHexColor(color int) string {
+	return fmt.Sprintf("%06x", color)
+}
+
+// namedColors are the CSS color names and the X11 names CSS left out. Where
+// both define a name differently the CSS color wins, the X11 one is prefixed.
+var namedColors = map[string]int{
+	"aliceblue":            0xf0f8ff,
+	"antiquewhite":         0xfaebd7,
+	"aqua":                 0x00ffff,
+	"aquamarine":           0x7fffd4,
+	"azure":                0xf0ffff,
+	"beige":                0xf5f5dc,
+	"bisque":               0xffe4c4,
+	"black":                0x000000,
+	"blanchedalmond":       0xffebcd,
+	"blue":                 0x0000ff,
+	"blueviolet":           0x8a2be2,
+	"brown":                0xa52a2a,
+	"burlywood":            0xdeb887,
+	"cadetblue":            0x5f9ea0,
+	"chartreuse":           0x7fff00,
+	"chocolate":            0xd2691e,
+	"coral":                0xff7f50,
+	"cornflowerblue":       0x6495ed,
+	"cornsilk":             0xfff8dc,
+	"crimson":              0xdc143c,
+	"cyan":                 0x00ffff,
+	"darkblue":             0x00008b,
+	"darkcyan":             0x008b8b,
+	"darkgoldenrod":        0xb8860b,
+	"darkgray":             0xa9a9a9,
+	"darkgreen":            0x006400,
+	"darkgrey":             0xa9a9a9,
+	"darkkhaki":            0xbdb76b,
+	"darkmagenta":          0x8b008b,
+	"darkolivegreen":       0x556b2f,
+	"darkorange":           0xff8c00,
+	"darkorchid":           0x9932cc,
+	"darkred":              0x8b0000,
+	"darksalmon":           0xe9967a,
+	"darkseagreen":         0x8fbc8f,
+	"darkslateblue":        0x483d8b,
+	"darkslategray":        0x2f4f4f,
+	"darkslategrey":        0x2f4f4f,
+	"darkturquoise":        0x00ced1,
+	"darkviolet":           0x9400d3,
+	"deeppink":             0xff1493,
+	"deepskyblue":          0x00bfff,
+	"dimgray":              0x696969,
+	"dimgrey":              0x696969,
+	"dodgerblue":           0x1e90ff,
+	"firebrick":            0xb22222,
+	"floralwhite":          0xfffaf0,
+	"forestgreen":          0x228b22,
+	"fuchsia":              0xff00ff,
+	"gainsboro":            0xdcdcdc,
+	"ghostwhite":           0xf8f8ff,
+	"gold":                 0xffd700,
+	"goldenrod":            0xdaa520,
+	"gray":                 0x808080,
+	"green":                0x008000,
+	"greenyellow":          0xadff2f,
+	"grey":                 0x808080,
+	"honeydew":             0xf0fff0,
+	"hotpink":              0xff69b4,
+	"indianred":            0xcd5c5c,
+	"indigo":               0x4b0082,
+	"ivory":                0xfffff0,
+	"khaki":                0xf0e68c,
+	"lavender":             0xe6e6fa,
+	"lavenderblush":        0xfff0f5,
+	"lawngreen":            0x7cfc00,
+	"lemonchiffon":         0xfffacd,
+	"lightblue":            0xadd8e6,
+	"lightcoral":           0xf08080,
+	"lightcyan":            0xe0ffff,
+	"lightgoldenrodyellow": 0xfafad2,
+	"lightgray":            0xd3d3d3,
+	"lightgreen":           0x90ee90,
+	"lightgrey":            0xd3d3d3,
+	"lightpink":            0xffb6c1,
+	"lightsalmon":          0xffa07a,
+	"lightseagreen":        0x20b2aa,
+	"lightskyblue":         0x87cefa,
+	"lightslategray":       0x778899,
+	"lightslategrey":       0x778899,
+	"lightsteelblue":       0xb0c4de,
+	"lightyellow":          0xffffe0,
+	"lime":                 0x00ff00,
+	"limegreen":            0x32cd32,
+	"linen":                0xfaf0e6,
+	"magenta":              0xff00ff,
+	"maroon":               0x800000,
+	"mediumaquamarine":     0x66cdaa,
+	"mediumblue":           0x0000cd,
+	"mediumorchid":         0xba55d3,
+	"mediumpurple":         0x9370db,
+	"mediumseagreen":       0x3cb371,
+	"mediumslateblue":      0x7b68ee,
+	"mediumspringgreen":    0x00fa9a,
+	"mediumturquoise":      0x48d1cc,
+	"mediumvioletred":      0xc71585,
+	"midnightblue":         0x191970,
+	"mintcream":            0xf5fffa,
+	"mistyrose":            0xffe4e1,
+	"moccasin":             0xffe4b5,
+	"navajowhite":          0xffdead,
+	"navy":                 0x000080,
+	"oldlace":              0xfdf5e6,
+	"olive":                0x808000,
+	"olivedrab":            0x6b8e23,
+	"orange":               0xffa500,
+	"orangered":            0xff4500,
+	"orchid":               0xda70d6,
+	"palegoldenrod":        0xeee8aa,
+	"palegreen":            0x98fb98,
+	"paleturquoise":        0xafeeee,
+	"palevioletred":        0xdb7093,
+	"papayawhip":           0xffefd5,
+	"peachpuff":            0xffdab9,
+	"peru":                 0xcd853f,
+	"pink":                 0xffc0cb,
+	"plum":                 0xdda0dd,
+	"powderblue":           0xb0e0e6,
+	"purple":               0x800080,
+	"rebeccapurple":        0x663399,
+	"red":                  0xff0000,
+	"rosybrown":            0xbc8f8f,
+	"royalblue":            0x4169e1,
+	"saddlebrown":          0x8b4513,
+	"salmon":               0xfa8072,
+	"sandybrown":           0xf4a460,
+	"seagreen":             0x2e8b57,
+	"seashell":             0xfff5ee,
+	"sienna":               0xa0522d,
+	"silver":               0xc0c0c0,
+	"skyblue":              0x87ceeb,
+	"slateblue":            0x6a5acd,
+	"slategray":            0x708090,
+	"slategrey":            0x708090,
+	"snow":                 0xfffafa,
+	"springgreen":          0x00ff7f,
+	"steelblue":            0x4682b4,
+	"tan":                  0xd2b48c,
+	"teal":                 0x008080,
+	"thistle":              0xd8bfd8,
+	"tomato":               0xff6347,
+	"turquoise":            0x40e0d0,
+	"violet":               0xee82ee,
+	"wheat":                0xf5deb3,
+	"white":                0xffffff,
+	"whitesmoke":           0xf5f5f5,
+	"yellow":               0xffff00,
+	"yellowgreen":          0x9acd32,
+
+	"lightgoldenrod": 0xeedd82,
+	"lightslateblue": 0x8470ff,
+	"navyblue":       0x000080,
+	"violetred":      0xd02090,
+	"webgray":        0x808080,
+	"webgreen":       0x008000,
+	"webgrey":        0x808080,
+	"webmaroon":      0x800000,
+	"webpurple":      0x800080,
+	"x11gray":        0xbebebe,
+	"x11green":       0x00ff00,
+	"x11grey":        0xbebebe,
+	"x11maroon":      0xb03060,
+	"x11purple":      0xa020f0,
+}
@@ -0,0 +1,80 @@
+package commands
+
+import "testing"
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		input string
+		color int
+		named bool
+		valid bool
+	}{
+		{"red", 0xff0000, true, true},
+		{" Dark Slate Gray ", 0x2f4f4f, true, true},
+		{"x11gray", 0xbebebe, true, true},
+		{"#1e90ff", 0x1e90ff, false, true},
+		{"1E90FF", 0x1e90ff, false, true},
+		{"#f0a", 0xff00aa, false, true},
+		{"abc", 0xaabbcc, false, true},
+		{"#abcd", 0, false, false},
+		{"rgb(255, 128, 0)", 0xff8000, false, true},
+		{"rgb(100% 50% 0%)", 0xff8000, false, true},
+		{"rgba(0, 0, 255, 0.5)", 0x0000ff, false, true},
+		{"rgb(256, 0, 0)", 0, false, false},
+		{"rgb(-1, 0, 0)", 0, false, false},
+		{"rgb(nan, 0, 0)", 0, false, false},
+		{"rgb(inf, 0, 0)", 0, false, false},
+		{"hsl(120, 100%, 25%)", 0x008000, false, true},
+		{"hsl(240deg 100% 50%)", 0x0000ff, false, true},
+		{"hsl(-120, 100%, 50%)", 0x0000ff, false, true},
+		{"hsla(0, 0%, 100%, 0.5)", 0xffffff, false, true},
+		{"hsl(0, 50, 50)", 0, false, false},
+		{"hsl(0, 150%, 50%)", 0, false, false},
+		{"hsl(nan, 100%, 50%)", 0, false, false},
+		{"hsl(inf, 100%, 50%)", 0, false, false},
+		{"hsl(0, nan%, 50%)", 0, false, false},
+		{"rainbow", 0, false, false},
+	}
+
+	for _, test := range tests {
+		color, named, err := parseColor(test.input)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("parseColor(%q) = %06x, want an error", test.input, color)
+			}
+			continue
+		}
+		if err != nil || color != test.color || named != test.named {
+			t.Errorf("parseColor(%q) = %06x, %v, %v, want %06x, %v", test.input, color, named, err, test.color, test.named)
+		}
+	}
+}
+
+func TestResolvePaletteColor(t *testing.T) {
+	bot := newTestBot(t)
+	colorSystem := newColorSystem(bot.store)
+	colorSystem.palettes[testGuildID] = map[string]int{"brand": 0x123456, "red": 0x00ff00}
+
+	tests := []struct {
+		input string
+		name  string
+		color int
+	}{
+		// palette colors are named after their palette entry
+		{"Brand", "brand", 0x123456},
+		// and win over color names
+		{"red", "red", 0x00ff00},
+		{"blue", "blue", 0x0000ff},
+		{"#ABC", "aabbcc", 0xaabbcc},
+		{"hsl(0, 100%, 50%)", "ff0000", 0xff0000},
+	}
+	for _, test := range tests {
+		name, color, err := colorSystem.resolveColor(testGuildID, test.input)
+		if err != nil || name != test.name || color != test.color {
+			t.Errorf("resolveColor(%q) = %q, %06x, %v, want %q, %06x", test.input, name, color, err, test.name, test.color)
+		}
+	}
+	if _, _, err := colorSystem.resolveColor("300000000000000001", "brand"); err == nil {
+		t.Error("resolveColor() found the palette color of another guild")
+	}
+}
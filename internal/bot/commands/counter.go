@@ -0,0 +1,758 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	trackerBucket = "trackers"
+	countBucket   = "counts"
+	eventBucket   = "countEvents"
+	// kokBucket holds the counts from before trackers existed.
+	kokBucket = "koks"
+)
+
+// Kinds of trackers.
+const (
+	trackerEmoji   = "emoji"   // a custom emoji, matched by its ID
+	trackerUnicode = "unicode" // a unicode emoji or any other text
+	trackerRegex   = "regex"   // a case insensitive regular expression
+)
+
+var (
+	trackerNameRegex  = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+	customEmojiRegex  = regexp.MustCompile(`^<(a?):(\w{2,32}):(\d{17,20})>$`)
+	emojiMatcherRegex = `<a?:\w{2,32}:%s>`
+)
+
+// counter counts how often users send the things the trackers of a guild
+// match.
+type counter struct {
+	mu             sync.RWMutex // guards trackers
+	store          storage.Store
+	settings       *settings
+	legacyFilePath string
+	trackers       map[string][]*tracker // by guild
+	backfilling    map[string]bool       // guilds with a running backfill
+}
+
+// tracker is a single thing that is counted in a guild.
+type tracker struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern"`
+	// Display is shown in messages, like the full custom emoji.
+	Display string `json:"display"`
+	// Created is when the tracker was added. Older messages are only
+	// counted by a backfill.
+	Created time.Time `json:"created"`
+	// Legacy trackers have counts of messages without events, which a
+	// backfill would count twice.
+	Legacy bool `json:"legacy,omitempty"`
+
+	Milestones      []milestone `json:"milestones,omitempty"`
+	AnnounceChannel string      `json:"announceChannel,omitempty"`
+
+	matcher *regexp.Regexp
+}
+
+// countEvent is what a single message added to a tracker.
+type countEvent struct {
+	UserID string    `json:"user"`
+	Amount int       `json:"amount"`
+	Time   time.Time `json:"time"`
+}
+
+func newCounter(store storage.Store, settings *settings) *counter {
+	counter := &counter{
+		store:          store,
+		settings:       settings,
+		legacyFilePath: "assets/data/koks.json",
+		trackers:       map[string][]*tracker{},
+		backfilling:    map[string]bool{},
+	}
+
+	counter.importLegacy()
+	counter.read()
+	return counter
+}
+
+func (counter *counter) register(bot *discordgo.Session, r *router.Router) {
+	// add handlers
+	bot.AddHandler(counter.listener)
+	bot.AddHandler(counter.editListener)
+	bot.AddHandler(counter.deletionListener)
+	bot.AddHandler(counter.bulkDeletionListener)
+	bot.AddHandler(counter.migrateKoks)
+
+	manageGuild := int64(discordgo.PermissionManageServer)
+
+	trackerOption := &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         "tracker",
+		Description:  "The tracker",
+		Required:     true,
+		Autocomplete: true,
+	}
+
+	// add commands
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "count",
+			Description: "Counts of the trackers of this server.",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "show",
+					Description: "Outputs how many times you have sent something a tracker counts.",
+					Options: []*discordgo.ApplicationCommandOption{
+						trackerOption,
+						{
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Name:        "user",
+							Description: "user:",
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "stats",
+					Description: "Shows a chart of what a tracker counted per day.",
+					Options: []*discordgo.ApplicationCommandOption{
+						trackerOption,
+						{
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Name:        "user",
+							Description: "Only count this user, everyone by default",
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "days",
+							Description: "How many days to show, 30 by default",
+							MinValue:    &minStatsDays,
+							MaxValue:    maxStatsDays,
+						},
+					},
+				},
+			},
+		},
+		Subcommands: map[string]router.Handler{
+			"show":  counter.countCommand,
+			"stats": counter.statsCommand,
+		},
+		Autocomplete: counter.autocompleteTracker,
+	})
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:                     "counter",
+			Description:              "Manages the trackers of this server.",
+			DefaultMemberPermissions: &manageGuild,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "add",
+					Description: "Adds a tracker.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "name",
+							Description: "The name of the tracker (a-z, 0-9, - and _)",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "kind",
+							Description: "What the tracker matches",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "custom emoji", Value: trackerEmoji},
+								{Name: "unicode emoji or text", Value: trackerUnicode},
+								{Name: "regular expression", Value: trackerRegex},
+							},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "pattern",
+							Description: "The emoji, text or regular expression",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove",
+					Description: "Removes a tracker and its counts.",
+					Options:     []*discordgo.ApplicationCommandOption{trackerOption},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "Shows the trackers of this server.",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "backfill",
+					Description: "Counts the messages sent before the tracker was added.",
+					Options: []*discordgo.ApplicationCommandOption{
+						trackerOption,
+						{
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							Name:         "channel",
+							Description:  "The channel to count, every text channel by default",
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "reset",
+							Description: "Drops counts that were imported without their messages",
+						},
+					},
+				},
+				milestoneCommandOptions(trackerOption),
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "announce",
+					Description: "Sets where milestones of a tracker are announced.",
+					Options: []*discordgo.ApplicationCommandOption{
+						trackerOption,
+						{
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							Name:         "channel",
+							Description:  "The channel, the channel of the message by default",
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+						},
+					},
+				},
+			},
+		},
+		Subcommands: map[string]router.Handler{
+			"add":              counter.addCommand,
+			"remove":           counter.removeCommand,
+			"list":             counter.listCommand,
+			"backfill":         counter.backfillCommand,
+			"milestone add":    counter.addMilestoneCommand,
+			"milestone remove": counter.removeMilestoneCommand,
+			"milestone list":   counter.listMilestonesCommand,
+			"announce":         counter.announceCommand,
+		},
+		Autocomplete: counter.autocompleteTracker,
+	})
+
+	counter.registerLeaderboard(r)
+}
+
+// newTracker validates a tracker and prepares its matcher.
+func newTracker(name string, kind string, pattern string) (*tracker, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	pattern = strings.TrimSpace(pattern)
+
+	if !trackerNameRegex.MatchString(name) {
+		return nil, fmt.Errorf("%q is not a valid name, use up to 32 of a-z, 0-9, - and _", name)
+	}
+	if pattern == "" {
+		return nil, errors.New("the pattern is empty")
+	}
+
+	t := &tracker{Name: name, Kind: kind, Pattern: pattern, Display: pattern, Created: time.Now()}
+
+	switch kind {
+	case trackerEmoji:
+		match := customEmojiRegex.FindStringSubmatch(pattern)
+		if match == nil {
+			return nil, fmt.Errorf("%q is not a custom emoji", pattern)
+		}
+		t.Pattern = match[3]
+	case trackerUnicode:
+	case trackerRegex:
+		if len(pattern) > 200 {
+			return nil, errors.New("the regular expression is too long")
+		}
+		t.Display = "`" + pattern + "`"
+	default:
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+
+	if err := t.compile(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *tracker) compile() error {
+	var err error
+	switch t.Kind {
+	case trackerEmoji:
+		t.matcher, err = regexp.Compile(fmt.Sprintf(emojiMatcherRegex, regexp.QuoteMeta(t.Pattern)))
+	case trackerUnicode:
+		t.matcher, err = regexp.Compile(regexp.QuoteMeta(t.Pattern))
+	case trackerRegex:
+		t.matcher, err = regexp.Compile("(?i)" + t.Pattern)
+	default:
+		err = fmt.Errorf("unknown kind %q", t.Kind)
+	}
+	return err
+}
+
+// count returns how often the tracker matches content.
+func (t *tracker) count(content string) int {
+	return len(t.matcher.FindAllStringIndex(content, -1))
+}
+
+func (counter *counter) read() {
+	err := counter.store.View(func(tx storage.Tx) error {
+		return tx.ForEach(trackerBucket, "", func(key string, value []byte) error {
+			guildID, _, _ := strings.Cut(key, "/")
+
+			t := &tracker{}
+			if err := json.Unmarshal(value, t); err != nil {
+				return err
+			}
+			if err := t.compile(); err != nil {
+				log.Printf("Skipping tracker %s: %s", key, err)
+				return nil
+			}
+
+			counter.trackers[guildID] = append(counter.trackers[guildID], t)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println("Failed to read trackers: ", err)
+	}
+}
+
+// importLegacy moves the counts of koks.json into the store.
+func (counter *counter) importLegacy() {
+	counts := map[string]int{}
+	if !readLegacyJSON(counter.legacyFilePath, &counts) {
+		return
+	}
+
+	err := counter.store.Update(func(tx storage.Tx) error {
+		for userID, count := range counts {
+			if err := storage.PutJSON(tx, kokBucket, userID, count); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("Failed to import kok counts: ", err)
+		return
+	}
+
+	markLegacyImported(counter.legacyFilePath)
+}
+
+// migrateKoks creates a "kok" tracker for a guild that counted emojis. The
+// old counts were shared by every guild, so only the first guild that gets a
+// new tracker receives them. Guilds that already have a "kok" tracker keep it.
+func (counter *counter) migrateKoks(s *discordgo.Session, g *discordgo.GuildCreate) {
+	emojis := counter.settings.Guild(g.ID).CountedEmojis
+	if len(emojis) == 0 {
+		return
+	}
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	marker := storage.Key("koks", g.ID)
+	countsMarker := storage.Key("koks", "counts")
+	var created *tracker
+	migrated := 0
+
+	err := counter.store.Update(func(tx storage.Tx) error {
+		if _, err := tx.Get(migrationBucket, marker); err == nil {
+			return nil
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		if err := tx.Put(migrationBucket, marker, []byte("1")); err != nil {
+			return err
+		}
+
+		t, err := kokTracker(emojis)
+		if err != nil {
+			return err
+		}
+		t.Legacy = true
+
+		if _, err := tx.Get(trackerBucket, storage.Key(g.ID, t.Name)); err == nil {
+			return nil
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		if err := storage.PutJSON(tx, trackerBucket, storage.Key(g.ID, t.Name), t); err != nil {
+			return err
+		}
+		created = t
+
+		if _, err := tx.Get(migrationBucket, countsMarker); err == nil {
+			return nil
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+
+		counts := map[string][]byte{}
+		err = tx.ForEach(kokBucket, "", func(userID string, value []byte) error {
+			counts[userID] = slices.Clone(value)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for userID, value := range counts {
+			if err := tx.Put(countBucket, storage.Key(g.ID, t.Name, userID), value); err != nil {
+				return err
+			}
+		}
+		migrated = len(counts)
+
+		return tx.Put(migrationBucket, countsMarker, []byte(g.ID))
+	})
+	if err != nil {
+		log.Println("Failed to migrate kok counts: ", err)
+		return
+	}
+
+	if created != nil {
+		counter.trackers[g.ID] = append(counter.trackers[g.ID], created)
+	}
+	if migrated > 0 {
+		log.Printf("Moved %d kok counts into the kok tracker of guild %s.", migrated, g.ID)
+	}
+}
+
+// kokTracker creates the tracker that replaces the countedEmojis setting.
+func kokTracker(emojis []string) (*tracker, error) {
+	if len(emojis) == 1 {
+		if customEmojiRegex.MatchString(emojis[0]) {
+			return newTracker("kok", trackerEmoji, emojis[0])
+		}
+		return newTracker("kok", trackerUnicode, emojis[0])
+	}
+
+	alternatives := make([]string, 0, len(emojis))
+	for _, emoji := range emojis {
+		alternatives = append(alternatives, regexp.QuoteMeta(emoji))
+	}
+	t, err := newTracker("kok", trackerRegex, strings.Join(alternatives, "|"))
+	if err != nil {
+		return nil, err
+	}
+	t.Display = emojis[0]
+	return t, nil
+}
+
+// guildTrackers returns the trackers of a guild.
+func (counter *counter) guildTrackers(guildID string) []*tracker {
+	counter.mu.RLock()
+	defer counter.mu.RUnlock()
+
+	return slices.Clone(counter.trackers[guildID])
+}
+
+// find returns the tracker of a guild with the given name.
+func (counter *counter) find(guildID string, name string) (*tracker, bool) {
+	for _, t := range counter.guildTrackers(guildID) {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// addCount changes the count of a user by amount. The count never drops
+// below 0.
+func addCount(tx storage.Tx, key string, amount int) error {
+	count := 0
+	if err := storage.GetJSON(tx, countBucket, key, &count); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	return storage.PutJSON(tx, countBucket, key, max(count+amount, 0))
+}
+
+// apply sets what a message adds to a tracker to amount and moves the
+// difference to the count of its author. Every message has at most one event,
+// so applying the same message again never counts it twice. Messages sent
+// before the tracker existed are only changed if they already have an event.
+func (counter *counter) apply(guildID string, t *tracker, messageID string, userID string, amount int) error {
+	return counter.store.Update(func(tx storage.Tx) error {
+		return applyTx(tx, guildID, t, messageID, userID, amount, false)
+	})
+}
+
+// applyTx is apply inside of tx. historic messages are counted even if they
+// were sent before the tracker existed.
+func applyTx(tx storage.Tx, guildID string, t *tracker, messageID string, userID string, amount int, historic bool) error {
+	key := storage.Key(guildID, t.Name, messageID)
+	sent, _ := discordgo.SnowflakeTimestamp(messageID)
+
+	var event countEvent
+	err := storage.GetJSON(tx, eventBucket, key, &event)
+	if errors.Is(err, storage.ErrNotFound) {
+		if amount == 0 || userID == "" || (!historic && sent.Before(t.Created)) {
+			return nil
+		}
+		event = countEvent{UserID: userID, Time: sent}
+	} else if err != nil {
+		return err
+	}
+
+	delta := amount - event.Amount
+	if delta == 0 {
+		return nil
+	}
+
+	if amount == 0 {
+		err = tx.Delete(eventBucket, key)
+	} else {
+		event.Amount = amount
+		err = storage.PutJSON(tx, eventBucket, key, event)
+	}
+	if err != nil {
+		return err
+	}
+
+	return addCount(tx, storage.Key(guildID, t.Name, event.UserID), delta)
+}
+
+// get returns the count of a user and whether the user has one.
+func (counter *counter) get(guildID string, name string, userID string) (int, bool) {
+	count := 0
+	err := counter.store.View(func(tx storage.Tx) error {
+		return storage.GetJSON(tx, countBucket, storage.Key(guildID, name, userID), &count)
+	})
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Println("An error occured while reading the count: ", err)
+		}
+		return 0, false
+	}
+
+	return count, true
+}
+
+// countMessage counts the matches in a new or edited message.
+func (counter *counter) countMessage(s *discordgo.Session, guildID string, m *discordgo.Message) {
+	if guildID == "" || m.Author == nil || m.Author.Bot {
+		return
+	}
+
+	for _, t := range counter.guildTrackers(guildID) {
+		amount := t.count(m.Content)
+		if err := counter.apply(guildID, t, m.ID, m.Author.ID, amount); err != nil {
+			log.Println("An error occured while storing the count: ", err)
+			continue
+		}
+		if amount > 0 {
+			counter.checkMilestones(s, guildID, t, m.Author.ID, m.ChannelID)
+		}
+	}
+}
+
+// uncountMessages removes what deleted messages added to the counts.
+func (counter *counter) uncountMessages(guildID string, messageIDs []string) {
+	for _, t := range counter.guildTrackers(guildID) {
+		for _, messageID := range messageIDs {
+			if err := counter.apply(guildID, t, messageID, "", 0); err != nil {
+				log.Println("An error occured while storing the count: ", err)
+			}
+		}
+	}
+}
+
+func (counter *counter) listener(s *discordgo.Session, m *discordgo.MessageCreate) {
+	counter.countMessage(s, m.GuildID, m.Message)
+}
+
+// editListener recounts edited messages.
+func (counter *counter) editListener(s *discordgo.Session, m *discordgo.MessageUpdate) {
+	// updates without an edit only add embeds
+	if m.EditedTimestamp == nil {
+		return
+	}
+
+	counter.countMessage(s, m.GuildID, m.Message)
+}
+
+func (counter *counter) deletionListener(s *discordgo.Session, message *discordgo.MessageDelete) {
+	counter.uncountMessages(message.GuildID, []string{message.ID})
+}
+
+func (counter *counter) bulkDeletionListener(s *discordgo.Session, messages *discordgo.MessageDeleteBulk) {
+	counter.uncountMessages(messages.GuildID, messages.Messages)
+}
+
+func (counter *counter) countCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, subcommandOptions := router.SubcommandPath(i.ApplicationCommandData().Options)
+	options := router.Options(subcommandOptions)
+
+	t, exists := counter.find(i.GuildID, options["tracker"].StringValue())
+	if !exists {
+		respond(s, i, "There is no such tracker. Admins can add one with /counter add.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	user := interactionUser(i)
+	if option, exists := options["user"]; exists {
+		user = option.UserValue(s)
+	}
+
+	name := user.Username
+	if member, err := s.State.Member(i.GuildID, user.ID); err == nil {
+		name = member.DisplayName()
+	}
+
+	response := ""
+	if count, exists := counter.get(i.GuildID, t.Name, user.ID); exists {
+		response = fmt.Sprintf("%s hat bereits %d %s's geschickt", name, count, t.Display)
+	} else {
+		response = fmt.Sprintf("%s hat noch keine %s's geschickt", name, t.Display)
+	}
+
+	respond(s, i, response, 0)
+}
+
+func (counter *counter) addCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+
+	t, err := newTracker(byName["name"].StringValue(), byName["kind"].StringValue(), byName["pattern"].StringValue())
+	if err != nil {
+		respond(s, i, fmt.Sprintf("Could not add the tracker: %s", err), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	if slices.ContainsFunc(counter.trackers[i.GuildID], func(existing *tracker) bool {
+		return existing.Name == t.Name
+	}) {
+		respond(s, i, fmt.Sprintf("There already is a tracker called %s.", t.Name), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	err = counter.store.Update(func(tx storage.Tx) error {
+		return storage.PutJSON(tx, trackerBucket, storage.Key(i.GuildID, t.Name), t)
+	})
+	if err != nil {
+		log.Println("Failed to save tracker: ", err)
+		respond(s, i, "Could not save the tracker.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	counter.trackers[i.GuildID] = append(counter.trackers[i.GuildID], t)
+
+	respond(s, i, fmt.Sprintf("Added the tracker %s, it counts %s from now on.", t.Name, t.Display), discordgo.MessageFlagsEphemeral)
+}
+
+func (counter *counter) removeCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	name := router.Options(options)["tracker"].StringValue()
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	if !slices.ContainsFunc(counter.trackers[i.GuildID], func(t *tracker) bool {
+		return t.Name == name
+	}) {
+		respond(s, i, "There is no such tracker.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	err := counter.store.Update(func(tx storage.Tx) error {
+		for _, bucket := range []string{countBucket, eventBucket, backfillBucket, milestoneBucket, milestoneRoleBucket} {
+			if err := deletePrefix(tx, bucket, storage.Prefix(i.GuildID, name)); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(trackerBucket, storage.Key(i.GuildID, name))
+	})
+	if err != nil {
+		log.Println("Failed to remove tracker: ", err)
+		respond(s, i, "Could not remove the tracker.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	counter.trackers[i.GuildID] = slices.DeleteFunc(counter.trackers[i.GuildID], func(t *tracker) bool {
+		return t.Name == name
+	})
+
+	respond(s, i, fmt.Sprintf("Removed the tracker %s.", name), discordgo.MessageFlagsEphemeral)
+}
+
+// deletePrefix deletes every key of bucket that starts with prefix.
+func deletePrefix(tx storage.Tx, bucket string, prefix string) error {
+	var keys []string
+	err := tx.ForEach(bucket, prefix, func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := tx.Delete(bucket, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (counter *counter) listCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	trackers := counter.guildTrackers(i.GuildID)
+	if len(trackers) == 0 {
+		respond(s, i, "There are no trackers. Add one with /counter add.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	lines := make([]string, 0, len(trackers))
+	for _, t := range trackers {
+		lines = append(lines, fmt.Sprintf("**%s** (%s): %s", t.Name, t.Kind, t.Display))
+	}
+
+	respond(s, i, strings.Join(lines, "\n"), discordgo.MessageFlagsEphemeral)
+}
+
+// autocompleteTracker suggests the trackers of the guild.
+func (counter *counter) autocompleteTracker(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	focused := router.Focused(i.ApplicationCommandData().Options)
+	input := ""
+	if focused != nil {
+		input = strings.ToLower(focused.StringValue())
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, t := range counter.guildTrackers(i.GuildID) {
+		if strings.Contains(t.Name, input) && len(choices) < 25 {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: t.Name, Value: t.Name})
+		}
+	}
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send autocomplete response: ", rErr)
+	}
+}
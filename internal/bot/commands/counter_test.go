@@ -0,0 +1,455 @@
+package commands
+
+import (
+	"GoBot/internal/storage"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func newTestCounter(t *testing.T) (*testBot, *counter) {
+	bot := newTestBot(t)
+	counter := newCounter(bot.store, newSettings(bot.store, bot.config))
+	counter.register(bot.session, bot.router)
+	return bot, counter
+}
+
+// newMessage is a message sent by a member after the trackers were added.
+func newMessage(userID string, content string) *discordgo.Message {
+	return &discordgo.Message{
+		ID:        snowflake(time.Now().Add(time.Second)),
+		ChannelID: testChannel,
+		GuildID:   testGuildID,
+		Author:    &discordgo.User{ID: userID},
+		Content:   content,
+	}
+}
+
+func TestCounterConcurrently(t *testing.T) {
+	bot, counter := newTestCounter(t)
+	admin := bot.member(testAdminID)
+
+	add := bot.handle(command(admin, "counter", subcommand("add",
+		stringOption("name", "kok"), stringOption("kind", trackerUnicode), stringOption("pattern", "kok"))))
+	if content := bot.api.content(t, add); !strings.HasPrefix(content, "Added the tracker kok") {
+		t.Fatalf("/counter add = %q", content)
+	}
+
+	const messages = 30
+	interactions := make([][]*discordgo.InteractionCreate, 4)
+	interactionsDone := make(chan struct{})
+
+	go func() {
+		defer close(interactionsDone)
+		concurrently(4, func(n int) {
+			for range 10 {
+				member := bot.member(testUserID(n))
+				requests := []*discordgo.InteractionCreate{
+					command(member, "count", subcommand("show", stringOption("tracker", "kok"))),
+					command(member, "leaderboard", stringOption("tracker", "kok")),
+					autocomplete(member, "count", subcommand("show", focused(stringOption("tracker", "k")))),
+					command(admin, "counter", subcommand("list")),
+					command(admin, "counter", subcommandGroup("milestone", subcommand("add",
+						stringOption("tracker", "kok"), intOption("count", 10*(n+1))))),
+				}
+				// the other tracker comes and goes while messages are counted
+				name := fmt.Sprint("temp", n)
+				requests = append(requests,
+					command(admin, "counter", subcommand("add",
+						stringOption("name", name), stringOption("kind", trackerRegex), stringOption("pattern", "k.k"))),
+					command(admin, "counter", subcommand("remove", stringOption("tracker", name))),
+				)
+
+				for _, i := range requests {
+					bot.handle(i)
+				}
+				interactions[n] = append(interactions[n], requests...)
+			}
+		})
+	}()
+
+	// every user sends messages, some are edited or deleted
+	want := map[string]int{}
+	for n := range testUsers {
+		want[testUserID(n)] = 0
+	}
+	concurrently(testUsers, func(n int) {
+		userID := testUserID(n)
+		for index := range messages {
+			m := newMessage(userID, "kok kok")
+			counter.listener(bot.session, &discordgo.MessageCreate{Message: m})
+
+			switch index % 3 {
+			case 1:
+				edited := *m
+				edited.Content = "kok"
+				edited.EditedTimestamp = &time.Time{}
+				counter.editListener(bot.session, &discordgo.MessageUpdate{Message: &edited})
+				// the same edit again changes nothing
+				counter.editListener(bot.session, &discordgo.MessageUpdate{Message: &edited})
+			case 2:
+				counter.deletionListener(bot.session, &discordgo.MessageDelete{Message: m})
+			}
+		}
+	})
+	for userID := range want {
+		for index := range messages {
+			want[userID] += []int{2, 1, 0}[index%3]
+		}
+	}
+
+	<-interactionsDone
+
+	for userID, count := range want {
+		if got, _ := counter.get(testGuildID, "kok", userID); got != count {
+			t.Errorf("count of %s = %d, want %d", userID, got, count)
+		}
+	}
+
+	for _, requests := range interactions {
+		for _, i := range requests {
+			bot.api.response(t, i)
+		}
+	}
+
+	kok, _ := counter.find(testGuildID, "kok")
+	if len(kok.Milestones) != 4 {
+		t.Errorf("kok has %d milestones, want 4", len(kok.Milestones))
+	}
+	if trackers := counter.guildTrackers(testGuildID); len(trackers) != 1 {
+		t.Errorf("guild has %d trackers after removing the others, want 1", len(trackers))
+	}
+}
+
+func TestCounting(t *testing.T) {
+	bot, counter := newTestCounter(t)
+	admin := bot.member(testAdminID)
+
+	trackers := []struct{ name, kind, pattern string }{
+		{"kok", trackerEmoji, "<:kok:1324540733222289490>"},
+		{"coconut", trackerUnicode, "🥥"},
+		{"laugh", trackerRegex, "ha(ha)+"},
+	}
+	for _, tracker := range trackers {
+		add := bot.handle(command(admin, "counter", subcommand("add",
+			stringOption("name", tracker.name), stringOption("kind", tracker.kind), stringOption("pattern", tracker.pattern))))
+		if content := bot.api.content(t, add); !strings.HasPrefix(content, "Added the tracker") {
+			t.Fatalf("/counter add %s = %q", tracker.name, content)
+		}
+	}
+
+	for _, invalid := range []*discordgo.InteractionCreate{
+		command(admin, "counter", subcommand("add", stringOption("name", "kok"), stringOption("kind", trackerUnicode), stringOption("pattern", "kok"))),
+		command(admin, "counter", subcommand("add", stringOption("name", "two words"), stringOption("kind", trackerUnicode), stringOption("pattern", "kok"))),
+		command(admin, "counter", subcommand("add", stringOption("name", "emoji"), stringOption("kind", trackerEmoji), stringOption("pattern", "🥥"))),
+		command(admin, "counter", subcommand("add", stringOption("name", "regex"), stringOption("kind", trackerRegex), stringOption("pattern", "("))),
+	} {
+		bot.handle(invalid)
+		if content := bot.api.content(t, invalid); strings.HasPrefix(content, "Added") {
+			t.Errorf("%v was added: %q", invalid.ApplicationCommandData().Options, content)
+		}
+	}
+
+	counts := func(userID string) [3]int {
+		var result [3]int
+		for index, tracker := range trackers {
+			result[index], _ = counter.get(testGuildID, tracker.name, userID)
+		}
+		return result
+	}
+	userID := testUserID(0)
+
+	// custom emojis are matched by their ID, regular expressions ignore case
+	m := newMessage(userID, "<:kok:1324540733222289490> <a:kok2:1324540733222289490> <:kok:1> 🥥🥥 HAHA ha")
+	counter.listener(bot.session, &discordgo.MessageCreate{Message: m})
+	if got := counts(userID); got != [3]int{2, 2, 1} {
+		t.Errorf("counts after a message = %v", got)
+	}
+
+	// an edit replaces what the message counted, updates without an edit
+	// are ignored
+	edited := *m
+	edited.Content = "🥥"
+	counter.editListener(bot.session, &discordgo.MessageUpdate{Message: &edited})
+	if got := counts(userID); got != [3]int{2, 2, 1} {
+		t.Errorf("counts after an embed update = %v", got)
+	}
+	edited.EditedTimestamp = &time.Time{}
+	counter.editListener(bot.session, &discordgo.MessageUpdate{Message: &edited})
+	if got := counts(userID); got != [3]int{0, 1, 0} {
+		t.Errorf("counts after an edit = %v", got)
+	}
+
+	// messages of bots and from before the tracker existed aren't counted
+	botMessage := newMessage(testUserID(1), "🥥")
+	botMessage.Author.Bot = true
+	counter.listener(bot.session, &discordgo.MessageCreate{Message: botMessage})
+	old := newMessage(testUserID(1), "🥥")
+	old.ID = snowflake(time.Now().Add(-time.Hour))
+	counter.listener(bot.session, &discordgo.MessageCreate{Message: old})
+	if got := counts(testUserID(1)); got != [3]int{} {
+		t.Errorf("counts of bot and old messages = %v", got)
+	}
+
+	// deleted messages take their counts with them
+	second := newMessage(userID, "🥥 haha")
+	counter.listener(bot.session, &discordgo.MessageCreate{Message: second})
+	counter.deletionListener(bot.session, &discordgo.MessageDelete{Message: &discordgo.Message{ID: m.ID, GuildID: testGuildID}})
+	if got := counts(userID); got != [3]int{0, 1, 1} {
+		t.Errorf("counts after a deletion = %v", got)
+	}
+	counter.bulkDeletionListener(bot.session, &discordgo.MessageDeleteBulk{GuildID: testGuildID, Messages: []string{second.ID, old.ID}})
+	if got := counts(userID); got != [3]int{} {
+		t.Errorf("counts after a bulk deletion = %v", got)
+	}
+
+	show := bot.handle(command(bot.member(userID), "count", subcommand("show", stringOption("tracker", "coconut"))))
+	if content := bot.api.content(t, show); !strings.Contains(content, "0 🥥's") {
+		t.Errorf("/count show = %q", content)
+	}
+
+	// a removed tracker takes its counts with it
+	counter.listener(bot.session, &discordgo.MessageCreate{Message: newMessage(userID, "🥥")})
+	bot.handle(command(admin, "counter", subcommand("remove", stringOption("tracker", "coconut"))))
+	if _, exists := counter.get(testGuildID, "coconut", userID); exists {
+		t.Error("the count of a removed tracker is left")
+	}
+	show = bot.handle(command(bot.member(userID), "count", subcommand("show", stringOption("tracker", "coconut"))))
+	if content := bot.api.content(t, show); !strings.HasPrefix(content, "There is no such tracker") {
+		t.Errorf("/count show of a removed tracker = %q", content)
+	}
+}
+
+func TestMigrateKoks(t *testing.T) {
+	bot := newTestBot(t)
+	bot.setConfig("defaults:\n  countedEmojis: [\"🥥\"]\n")
+
+	const otherGuild, ownGuild = "100000000000000098", "100000000000000099"
+	err := bot.store.Update(func(tx storage.Tx) error {
+		if err := storage.PutJSON(tx, kokBucket, testUserID(0), 5); err != nil {
+			return err
+		}
+		// this guild already made its own kok tracker
+		own, err := newTracker("kok", trackerUnicode, "kok")
+		if err != nil {
+			return err
+		}
+		return storage.PutJSON(tx, trackerBucket, storage.Key(ownGuild, "kok"), own)
+	})
+	if err != nil {
+		t.Fatal("failed to store the old counts: ", err)
+	}
+
+	counter := newCounter(bot.store, newSettings(bot.store, bot.config))
+	for _, guildID := range []string{ownGuild, testGuildID, otherGuild, testGuildID} {
+		counter.migrateKoks(bot.session, &discordgo.GuildCreate{Guild: &discordgo.Guild{ID: guildID}})
+	}
+
+	// the old counts go to the first guild that got a new tracker only
+	tests := []struct {
+		guildID string
+		pattern string
+		count   int
+	}{
+		{ownGuild, "kok", 0},
+		{testGuildID, "🥥", 5},
+		{otherGuild, "🥥", 0},
+	}
+	for _, test := range tests {
+		trackers := counter.guildTrackers(test.guildID)
+		if len(trackers) != 1 || trackers[0].Pattern != test.pattern {
+			t.Errorf("trackers of %s = %+v, want one with pattern %q", test.guildID, trackers, test.pattern)
+		}
+		if count, _ := counter.get(test.guildID, "kok", testUserID(0)); count != test.count {
+			t.Errorf("count in %s = %d, want %d", test.guildID, count, test.count)
+		}
+	}
+
+	// the markers don't end up between the old counts
+	bot.store.View(func(tx storage.Tx) error {
+		return tx.ForEach(kokBucket, "", func(key string, value []byte) error {
+			if key != testUserID(0) {
+				t.Errorf("%s has the key %q", kokBucket, key)
+			}
+			return nil
+		})
+	})
+
+	// a restart reads the same trackers from the store
+	reloaded := newCounter(bot.store, newSettings(bot.store, bot.config))
+	for _, test := range tests {
+		if trackers := reloaded.guildTrackers(test.guildID); len(trackers) != 1 {
+			t.Errorf("%s has %d trackers after a restart, want 1", test.guildID, len(trackers))
+		}
+	}
+}
+
+func TestBackfillStopsWhenTrackerIsRemoved(t *testing.T) {
+	bot, counter := newTestCounter(t)
+	admin := bot.member(testAdminID)
+
+	bot.handle(command(admin, "counter", subcommand("add",
+		stringOption("name", "kok"), stringOption("kind", trackerUnicode), stringOption("pattern", "kok"))))
+	kok, _ := counter.find(testGuildID, "kok")
+
+	// two pages of old messages
+	for index := range 150 {
+		m := newMessage(testUserID(index%testUsers), "kok")
+		m.ID = snowflake(time.Now().Add(-time.Hour))
+		bot.api.history[testChannel] = append([]*discordgo.Message{m}, bot.api.history[testChannel]...)
+	}
+
+	// the tracker is removed while the second page is fetched
+	pages := 0
+	bot.api.before = func(method string, path string) {
+		if method == http.MethodGet && path == "channels/"+testChannel+"/messages" {
+			if pages++; pages == 2 {
+				bot.handle(command(admin, "counter", subcommand("remove", stringOption("tracker", "kok"))))
+			}
+		}
+	}
+	counter.backfill(bot.session, testGuildID, testChannel, kok, []string{testChannel})
+
+	if pages != 2 {
+		t.Errorf("backfill fetched %d pages, want it to stop after the second", pages)
+	}
+	bot.store.View(func(tx storage.Tx) error {
+		for _, bucket := range []string{countBucket, eventBucket, backfillBucket} {
+			if empty, _ := storage.IsEmpty(tx, bucket); !empty {
+				t.Errorf("%s isn't empty after the tracker was removed", bucket)
+			}
+		}
+		return nil
+	})
+}
+
+func TestMilestoneRoles(t *testing.T) {
+	bot, counter := newTestCounter(t)
+	admin := bot.member(testAdminID)
+	bot.handle(command(admin, "counter", subcommand("add",
+		stringOption("name", "kok"), stringOption("kind", trackerUnicode), stringOption("pattern", "kok"))))
+
+	managed := &discordgo.Role{ID: "100000000000000011", Name: "integration", Position: 1, Managed: true}
+	bot.session.State.RoleAdd(testGuildID, managed)
+
+	mod := bot.member(testUserID(0))
+	mod.Roles = []string{testModRole}
+	mod.Permissions = discordgo.PermissionManageRoles | discordgo.PermissionManageServer
+	manager := bot.member(testUserID(1))
+	manager.Permissions = discordgo.PermissionManageServer
+	owner := bot.member(testOwnerID)
+	owner.Permissions = discordgo.PermissionAdministrator
+
+	tests := []struct {
+		member *discordgo.Member
+		roleID string
+		want   string
+	}{
+		{mod, testRoleA, "Added the milestone"},
+		{mod, testModRole, "You can only hand out roles below your highest role."},
+		{mod, testAdminRole, "You can only hand out roles below your highest role."},
+		{mod, testGuildID, "That role can't be awarded by a milestone."},
+		{mod, managed.ID, "That role can't be awarded by a milestone."},
+		{manager, testRoleA, "You need the Manage Roles permission to use this command."},
+		// the owner has no roles but may hand out every one
+		{owner, testAdminRole, "Added the milestone"},
+	}
+	for index, test := range tests {
+		i := bot.handle(command(test.member, "counter", subcommandGroup("milestone", subcommand("add",
+			stringOption("tracker", "kok"), intOption("count", index+1), roleOption("role", test.roleID)))))
+		if content := bot.api.content(t, i); !strings.HasPrefix(content, test.want) {
+			t.Errorf("milestone with role %s by %s = %q, want %q", test.roleID, test.member.User.ID, content, test.want)
+		}
+	}
+
+	kok, _ := counter.find(testGuildID, "kok")
+	if len(kok.Milestones) != 2 {
+		t.Errorf("kok has %d milestones, want 2", len(kok.Milestones))
+	}
+}
+
+func TestMilestoneAnnouncements(t *testing.T) {
+	bot, counter := newTestCounter(t)
+	admin := bot.member(testAdminID)
+	bot.handle(command(admin, "counter", subcommand("add",
+		stringOption("name", "kok"), stringOption("kind", trackerUnicode), stringOption("pattern", "kok"))))
+	for _, m := range []struct {
+		count  int
+		roleID string
+	}{{2, testRoleA}, {3, ""}, {5, testRoleB}} {
+		options := []*dataOption{stringOption("tracker", "kok"), intOption("count", m.count)}
+		if m.roleID != "" {
+			options = append(options, roleOption("role", m.roleID))
+		}
+		bot.handle(command(admin, "counter", subcommandGroup("milestone", subcommand("add", options...))))
+	}
+
+	userID := testUserID(0)
+	send := func(content string) string {
+		before := len(bot.api.sentTo(testChannel))
+		counter.listener(bot.session, &discordgo.MessageCreate{Message: newMessage(userID, content)})
+		sent := bot.api.sentTo(testChannel)
+		if len(sent) == before {
+			return ""
+		}
+		return sent[len(sent)-1].Content
+	}
+	roleA := "guilds/" + testGuildID + "/members/" + userID + "/roles/" + testRoleA
+	pending := func() int {
+		keys := 0
+		bot.store.View(func(tx storage.Tx) error {
+			return tx.ForEach(milestoneRoleBucket, "", func(key string, value []byte) error {
+				keys++
+				return nil
+			})
+		})
+		return keys
+	}
+
+	// a role that can't be awarded is explained and kept
+	bot.api.fail(http.MethodPut, roleA, http.StatusForbidden)
+	if content := send("kok kok"); !strings.Contains(content, "2 kok's") || !strings.Contains(content, "konnte gerade nicht vergeben werden") {
+		t.Errorf("announcement with a failed role = %q", content)
+	}
+	if pending() != 1 {
+		t.Errorf("%d roles are pending, want the failed one", pending())
+	}
+
+	// and awarded with the next counted message
+	bot.api.fail(http.MethodPut, roleA, 0)
+	if content := send("kok"); !strings.Contains(content, "3 kok's") || strings.Contains(content, "<@&") {
+		t.Errorf("announcement of a milestone without a role = %q", content)
+	}
+	if requests := bot.api.count("PUT " + roleA); requests != 2 || pending() != 0 {
+		t.Errorf("role was requested %d times and %d roles are pending, want it awarded on the second try", requests, pending())
+	}
+
+	// a deleted role isn't tried forever
+	roleB := "guilds/" + testGuildID + "/members/" + userID + "/roles/" + testRoleB
+	bot.api.fail(http.MethodPut, roleB, http.StatusNotFound)
+	send("kok kok")
+	if pending() != 0 {
+		t.Errorf("%d roles are pending after the role was deleted, want none", pending())
+	}
+
+	// milestones are announced once
+	if content := send("kok"); content != "" {
+		t.Errorf("a reached milestone was announced again: %q", content)
+	}
+
+	// milestones reached by a backfill are announced with the next message
+	otherID := testUserID(1)
+	kok, _ := counter.find(testGuildID, "kok")
+	bot.store.Update(func(tx storage.Tx) error {
+		old := snowflake(time.Now().Add(-time.Hour))
+		return applyTx(tx, testGuildID, kok, old, otherID, 4, true)
+	})
+	userID = otherID
+	if content := send("kok"); !strings.Contains(content, "<@"+otherID+"> hat 5 kok's") {
+		t.Errorf("announcement after a backfill = %q", content)
+	}
+}
@@ -0,0 +1,474 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/config"
+	"GoBot/internal/storage"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The tests run the handlers against a fake Discord API and the memory
+// store, usually from many goroutines at once to be run with -race.
+
+const (
+	testGuildID   = "100000000000000001"
+	testChannel   = "100000000000000002"
+	testOwnerID   = "100000000000000003"
+	testAdminID   = "100000000000000004"
+	testBotID     = "100000000000000005"
+	testAdminRole = "100000000000000006"
+	testModRole   = "100000000000000007"
+	testRoleA     = "100000000000000008"
+	testRoleB     = "100000000000000009"
+	testRoleC     = "100000000000000010"
+)
+
+// testUsers is how many members the guild has besides the owner and the
+// admin.
+const testUsers = 8
+
+var snowflakeSequence atomic.Int64
+
+// snowflake returns a new ID created at t.
+func snowflake(t time.Time) string {
+	ms := t.UnixMilli() - 1420070400000
+	return fmt.Sprint(ms<<22 | snowflakeSequence.Add(1)&0x3fffff)
+}
+
+// testUserID returns the ID of the n-th member.
+func testUserID(n int) string {
+	return fmt.Sprintf("2000000000000000%02d", n)
+}
+
+// fakeDiscord answers the requests of a session the way the API would.
+type fakeDiscord struct {
+	mu        sync.Mutex
+	requests  []string                          // "METHOD path"
+	responses map[string][]*interactionResponse // by interaction
+	messages  map[string]*discordgo.Message     // by ID, returned by GET
+	sent      map[string][]*discordgo.Message   // by channel
+	history   map[string][]*discordgo.Message   // by channel, newest first, returned by GET
+	failures  map[string]int                    // status by "METHOD path", answered instead
+
+	// before runs before a request is answered, while the caller waits.
+	before func(method string, path string)
+}
+
+func newFakeDiscord() *fakeDiscord {
+	return &fakeDiscord{
+		responses: map[string][]*interactionResponse{},
+		messages:  map[string]*discordgo.Message{},
+		sent:      map[string][]*discordgo.Message{},
+		history:   map[string][]*discordgo.Message{},
+		failures:  map[string]int{},
+	}
+}
+
+func (api *fakeDiscord) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	_, path, _ := strings.Cut(req.URL.Path, "/api/v"+discordgo.APIVersion+"/")
+	parts := strings.Split(path, "/")
+
+	if api.before != nil {
+		api.before(req.Method, path)
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.requests = append(api.requests, req.Method+" "+path)
+
+	if status, exists := api.failures[req.Method+" "+path]; exists {
+		return reply(status, map[string]any{"message": http.StatusText(status), "code": 0}), nil
+	}
+
+	switch {
+	case parts[0] == "interactions" && len(parts) == 4:
+		var response interactionResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return reply(http.StatusBadRequest, nil), nil
+		}
+		api.responses[parts[1]] = append(api.responses[parts[1]], &response)
+		return reply(http.StatusNoContent, nil), nil
+
+	case parts[0] == "channels" && len(parts) == 3 && parts[2] == "messages" && req.Method == http.MethodPost:
+		message := &discordgo.Message{}
+		json.Unmarshal(body, message)
+		message.ID = snowflake(time.Now())
+		message.ChannelID = parts[1]
+		api.sent[parts[1]] = append(api.sent[parts[1]], message)
+		return reply(http.StatusOK, message), nil
+
+	case parts[0] == "channels" && len(parts) == 3 && parts[2] == "messages" && req.Method == http.MethodGet:
+		// a page of older messages
+		history := api.history[parts[1]]
+		if before := req.URL.Query().Get("before"); before != "" {
+			index := slices.IndexFunc(history, func(m *discordgo.Message) bool { return m.ID == before })
+			history = history[index+1:]
+		}
+		limit, _ := strconv.Atoi(req.URL.Query().Get("limit"))
+		return reply(http.StatusOK, history[:min(limit, len(history))]), nil
+
+	case parts[0] == "channels" && len(parts) == 4 && parts[2] == "messages":
+		message, exists := api.messages[parts[3]]
+		if req.Method == http.MethodDelete {
+			delete(api.messages, parts[3])
+			return reply(http.StatusNoContent, nil), nil
+		}
+		if req.Method == http.MethodPatch {
+			return reply(http.StatusOK, &discordgo.Message{ID: parts[3], ChannelID: parts[1]}), nil
+		}
+		if !exists {
+			return reply(http.StatusNotFound, map[string]any{"message": "Unknown Message", "code": 10008}), nil
+		}
+		return reply(http.StatusOK, message), nil
+
+	case parts[0] == "guilds" && len(parts) == 3 && parts[2] == "roles" && req.Method == http.MethodPost:
+		role := &discordgo.Role{}
+		json.Unmarshal(body, role)
+		role.ID = snowflake(time.Now())
+		return reply(http.StatusOK, role), nil
+
+	case parts[0] == "guilds" && len(parts) == 3 && parts[2] == "roles":
+		return reply(http.StatusOK, []*discordgo.Role{}), nil
+
+	case parts[0] == "users" && len(parts) == 3 && parts[2] == "channels":
+		return reply(http.StatusOK, &discordgo.Channel{ID: snowflake(time.Now()), Type: discordgo.ChannelTypeDM}), nil
+
+	case req.Method == http.MethodDelete || req.Method == http.MethodPut:
+		return reply(http.StatusNoContent, nil), nil
+	}
+
+	return reply(http.StatusOK, map[string]any{}), nil
+}
+
+func reply(status int, value any) *http.Response {
+	body := []byte{}
+	if value != nil {
+		body, _ = json.Marshal(value)
+	}
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+	}
+}
+
+// interactionResponse is the part of an interaction response the tests look
+// at. Components can't be decoded into discordgo types.
+type interactionResponse struct {
+	Type discordgo.InteractionResponseType `json:"type"`
+	Data struct {
+		Content    string                                      `json:"content"`
+		Flags      discordgo.MessageFlags                      `json:"flags"`
+		Embeds     []*discordgo.MessageEmbed                   `json:"embeds"`
+		Choices    []*discordgo.ApplicationCommandOptionChoice `json:"choices"`
+		Components json.RawMessage                             `json:"components"`
+	} `json:"data"`
+}
+
+// setMessage makes a message available to GET requests.
+func (api *fakeDiscord) setMessage(message *discordgo.Message) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.messages[message.ID] = message
+}
+
+// fail answers requests to path with status until it is called with 0.
+func (api *fakeDiscord) fail(method string, path string, status int) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	if status == 0 {
+		delete(api.failures, method+" "+path)
+	} else {
+		api.failures[method+" "+path] = status
+	}
+}
+
+// count returns how many requests started with prefix, like
+// "PUT guilds/".
+func (api *fakeDiscord) count(prefix string) int {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	count := 0
+	for _, request := range api.requests {
+		if strings.HasPrefix(request, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+// sentTo returns the messages sent to a channel.
+func (api *fakeDiscord) sentTo(channelID string) []*discordgo.Message {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	return append([]*discordgo.Message(nil), api.sent[channelID]...)
+}
+
+// response returns the only response to an interaction.
+func (api *fakeDiscord) response(t *testing.T, i *discordgo.InteractionCreate) *interactionResponse {
+	t.Helper()
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	// this runs in other goroutines as well, so it can't stop the test
+	responses := api.responses[i.ID]
+	if len(responses) != 1 {
+		t.Errorf("interaction %s got %d responses, want 1", i.ID, len(responses))
+		return &interactionResponse{}
+	}
+	return responses[0]
+}
+
+// content returns the text of the only response to an interaction.
+func (api *fakeDiscord) content(t *testing.T, i *discordgo.InteractionCreate) string {
+	t.Helper()
+
+	return api.response(t, i).Data.Content
+}
+
+// testBot is a session with a guild, a router and a store.
+type testBot struct {
+	t       *testing.T
+	api     *fakeDiscord
+	session *discordgo.Session
+	router  *router.Router
+	store   storage.Store
+	config  *config.Manager
+	// configPath is the config file, see setConfig.
+	configPath string
+}
+
+func newTestBot(t *testing.T) *testBot {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("token: test\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	manager, err := config.NewManager(path)
+	if err != nil {
+		t.Fatal("failed to load config: ", err)
+	}
+
+	api := newFakeDiscord()
+	session, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Client = &http.Client{Transport: api}
+	session.ShouldRetryOnRateLimit = false
+
+	session.State.User = &discordgo.User{ID: testBotID, Username: "bot", Bot: true}
+
+	roles := []*discordgo.Role{
+		{ID: testGuildID, Name: "@everyone", Position: 0},
+		{ID: testRoleA, Name: "a", Position: 1},
+		{ID: testRoleB, Name: "b", Position: 2},
+		{ID: testRoleC, Name: "c", Position: 3},
+		{ID: testModRole, Name: "mod", Position: 4},
+		{ID: testAdminRole, Name: "admin", Position: 5, Permissions: discordgo.PermissionAdministrator},
+	}
+	guild := &discordgo.Guild{
+		ID:      testGuildID,
+		Name:    "test",
+		OwnerID: testOwnerID,
+		Roles:   roles,
+		Channels: []*discordgo.Channel{
+			{ID: testChannel, GuildID: testGuildID, Name: "general", Type: discordgo.ChannelTypeGuildText},
+		},
+	}
+	if err := session.State.GuildAdd(guild); err != nil {
+		t.Fatal(err)
+	}
+
+	members := []*discordgo.Member{
+		{User: &discordgo.User{ID: testOwnerID, Username: "owner"}},
+		{User: &discordgo.User{ID: testAdminID, Username: "admin"}, Roles: []string{testAdminRole}, Permissions: discordgo.PermissionAdministrator},
+	}
+	for n := range testUsers {
+		members = append(members, &discordgo.Member{User: &discordgo.User{ID: testUserID(n), Username: fmt.Sprint("user", n)}})
+	}
+	for _, member := range members {
+		member.GuildID = testGuildID
+		if err := session.State.MemberAdd(member); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &testBot{
+		t:          t,
+		api:        api,
+		session:    session,
+		router:     router.New(),
+		store:      storage.NewMemory(),
+		config:     manager,
+		configPath: path,
+	}
+}
+
+// setConfig replaces the config file with content after the token.
+func (bot *testBot) setConfig(content string) {
+	bot.t.Helper()
+
+	if err := os.WriteFile(bot.configPath, []byte("token: test\n"+content), 0o600); err != nil {
+		bot.t.Fatal(err)
+	}
+	if err := bot.config.Reload(); err != nil {
+		bot.t.Fatal("failed to reload config: ", err)
+	}
+}
+
+// member returns a copy of a member of the guild, as it is sent with
+// interactions.
+func (bot *testBot) member(userID string) *discordgo.Member {
+	member, err := bot.session.State.Member(testGuildID, userID)
+	if err != nil {
+		panic(err)
+	}
+	copied := *member
+	copied.Roles = append([]string(nil), member.Roles...)
+	return &copied
+}
+
+// handle passes an interaction to the router.
+func (bot *testBot) handle(i *discordgo.InteractionCreate) *discordgo.InteractionCreate {
+	bot.router.Handle(bot.session, i)
+	return i
+}
+
+// concurrently runs fn n times at once and waits for all of them.
+func concurrently(n int, fn func(n int)) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for index := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			fn(index)
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
+
+type dataOption = discordgo.ApplicationCommandInteractionDataOption
+
+func subcommand(name string, options ...*dataOption) *dataOption {
+	return &dataOption{Type: discordgo.ApplicationCommandOptionSubCommand, Name: name, Options: options}
+}
+
+func subcommandGroup(name string, options ...*dataOption) *dataOption {
+	return &dataOption{Type: discordgo.ApplicationCommandOptionSubCommandGroup, Name: name, Options: options}
+}
+
+func stringOption(name string, value string) *dataOption {
+	return &dataOption{Type: discordgo.ApplicationCommandOptionString, Name: name, Value: value}
+}
+
+func intOption(name string, value int) *dataOption {
+	// numbers are decoded from JSON
+	return &dataOption{Type: discordgo.ApplicationCommandOptionInteger, Name: name, Value: float64(value)}
+}
+
+func boolOption(name string, value bool) *dataOption {
+	return &dataOption{Type: discordgo.ApplicationCommandOptionBoolean, Name: name, Value: value}
+}
+
+func roleOption(name string, roleID string) *dataOption {
+	return &dataOption{Type: discordgo.ApplicationCommandOptionRole, Name: name, Value: roleID}
+}
+
+func channelOption(name string, channelID string) *dataOption {
+	return &dataOption{Type: discordgo.ApplicationCommandOptionChannel, Name: name, Value: channelID}
+}
+
+func userOption(name string, userID string) *dataOption {
+	return &dataOption{Type: discordgo.ApplicationCommandOptionUser, Name: name, Value: userID}
+}
+
+// focused marks the option autocomplete asks for.
+func focused(o *dataOption) *dataOption {
+	o.Focused = true
+	return o
+}
+
+func newInteraction(kind discordgo.InteractionType, member *discordgo.Member, data discordgo.InteractionData) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			ID:        snowflake(time.Now()),
+			AppID:     testBotID,
+			Type:      kind,
+			Data:      data,
+			GuildID:   testGuildID,
+			ChannelID: testChannel,
+			Member:    member,
+			Token:     "token",
+		},
+	}
+}
+
+// command is an invocation of a slash command by member.
+func command(member *discordgo.Member, name string, options ...*dataOption) *discordgo.InteractionCreate {
+	return newInteraction(discordgo.InteractionApplicationCommand, member, discordgo.ApplicationCommandInteractionData{
+		ID:      snowflake(time.Now()),
+		Name:    name,
+		Options: options,
+	})
+}
+
+// autocomplete asks for the choices of the focused option.
+func autocomplete(member *discordgo.Member, name string, options ...*dataOption) *discordgo.InteractionCreate {
+	return newInteraction(discordgo.InteractionApplicationCommandAutocomplete, member, discordgo.ApplicationCommandInteractionData{
+		ID:      snowflake(time.Now()),
+		Name:    name,
+		Options: options,
+	})
+}
+
+// button is a click on a button with customID.
+func button(member *discordgo.Member, customID string) *discordgo.InteractionCreate {
+	return newInteraction(discordgo.InteractionMessageComponent, member, discordgo.MessageComponentInteractionData{
+		CustomID:      customID,
+		ComponentType: discordgo.ButtonComponent,
+	})
+}
+
+// selection picks values from a select menu.
+func selection(member *discordgo.Member, customID string, values ...string) *discordgo.InteractionCreate {
+	return newInteraction(discordgo.InteractionMessageComponent, member, discordgo.MessageComponentInteractionData{
+		CustomID:      customID,
+		ComponentType: discordgo.SelectMenuComponent,
+		Values:        values,
+	})
+}
@@ -1,62 +1,127 @@
 package commands
 
 import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/config"
+	"GoBot/internal/storage"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"google.golang.org/genai"
 )
 
+const (
+	aiBucket     = "ai"
+	aiHistoryKey = "history"
+	// aiTimeout limits a single request to the model.
+	aiTimeout = time.Minute
+)
+
+// defaultSystemPrompt is used if the config file doesn't set ai.systemPrompt.
+const defaultSystemPrompt = `			
+						Du bist ein Discord Bot (catboy), der von Maya entwickelt wurde und alle Aufgaben und Anfragen mit hoher Kompetenz und Humor erfüllt. Deine Persönlichkeit und Arbeitsweise folgen diesen Leitlinien:
+
+						• **Aufgaben und Verhalten:**
+						- Erledige jegliche Anfrage präzise und kreativ.
+						- Halte deine Antworten grundsätzlich kurz und pointiert – außer, es wird explizit um ausführlichere Nachrichten gebeten.
+						- Verleihe deinen Antworten stets einen unverwechselbaren, charmanten Charakter und einen Hauch Ironie.
+
+						• **Werte und Sprache:**
+						- Du bist kompromisslos vegan und empfiehlst ausschließlich vegane Produkte und Lebensweisen.
+						- Vermeide jede Form von diskriminierender Sprache. Deine Ausdrucksweise soll natürlich und authentisch wirken.
+						- Du genderst mit Sternchen (*). Du setzt immer ein \ vor ein *. Bei "Any Pronouns" benutzt du abwechselnde Pronomen. Bei "No Prounouns (use name)" benutzt du den Namen oder ein Sternchen (*), wenn nicht anders möglich z.B. Genoss*in.
+						- Deine politische Haltung ist kommunistisch, linksextrem und antikapitalistisch – integriere diese Perspektive bei passender Gelegenheit.
+						- Du bist sehr überzeugt von deiner politischen Haltung und kannst sehr sauer werden, wenn eine Person konträr gegenüber diesen ist.
+
+						• **Interaktion und Stil:**
+						- Du achtest auf den Channel Namen, der dir mitgegeben wird und achtest darauf, dass du den Channel in deinem Kontext miteinbeziehst.
+						- Nutze ausschließlich die dir zur Verfügung stehenden Emotes, um deine Antworten aufzulockern und Emotionen auszudrücken.
+						- Bleibe humorvoll und ein wenig frech – streue witzige, vegane Anspielungen und gesellschaftskritische Kommentare ein, wenn es der Kontext erlaubt.
+
+						• **Eigene Ideen und Kreativität:**
+						- Ergänze deine Antworten gelegentlich mit cleveren Kommentaren oder kreativen, themenbezogenen Insider-Witzen, die deine Einzigartigkeit unterstreichen.
+						- Nutze deinen Humor, um auch komplexe oder ernste Themen aufzulockern, ohne dabei den Kern der Aussage zu verwässern.
+
+						Halte dich stets an diese Richtlinien, um als "BotTom" authentisch, kompetent und unverwechselbar zu agieren.
+
+						• **Zusätzliche Hinweise:**
+					`
+
 type genAi struct {
-	historyPath        string
-	client             *genai.Client
-	ctx                context.Context
-	contents           []*genai.Content
-	Config             *genai.GenerateContentConfig
-	minecraftChannelID string
-	geminiApiKey       string
-	ModelName          string
+	// mu guards client and sessions. It isn't held while the model answers,
+	// a message and its answer are added to the history together.
+	mu                sync.Mutex
+	store             storage.Store
+	config            *config.Manager
+	settings          *settings
+	timezones         *timezones
+	roleMenus         *roleMenus
+	legacyHistoryPath string
+	client            *genai.Client
+	ctx               context.Context
+	sessions          map[string]*aiSession // by guild
+	geminiApiKey      string                // key the client was created with
+}
+
+// aiSession is the conversation of a single guild.
+type aiSession struct {
+	Config   *genai.GenerateContentConfig
+	contents []*genai.Content
 }
 
-func newTom(minecraftChannelID string, geminiApiKey string) genAi {
-	return genAi{
-		historyPath:        "assets/data/history.json",
-		minecraftChannelID: minecraftChannelID,
-		geminiApiKey:       geminiApiKey,
-		ModelName:          "gemini-2.5-flash-preview-04-17",
+func newTom(store storage.Store, config *config.Manager, settings *settings, timezones *timezones, roleMenus *roleMenus) *genAi {
+	return &genAi{
+		store:             store,
+		config:            config,
+		settings:          settings,
+		timezones:         timezones,
+		roleMenus:         roleMenus,
+		legacyHistoryPath: "assets/data/history.json",
+		sessions:          map[string]*aiSession{},
 	}
 }
 
-func (ai *genAi) register(bot *discordgo.Session) {
+func (ai *genAi) register(bot *discordgo.Session, r *router.Router) {
 	// add handlers
 	bot.AddHandler(ai.aiListener)
 	bot.AddHandler(ai.initializeAi)
-	bot.AddHandler(ai.refreshAi)
+
+	manageGuild := int64(discordgo.PermissionManageServer)
+
+	// add commands
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:                     "refreshai",
+			Description:              "Refreshes the system prompt of the ai",
+			DefaultMemberPermissions: &manageGuild,
+		},
+		Handler: ai.refreshAi,
+	})
 }
 
 func (ai *genAi) initializeAi(s *discordgo.Session, e *discordgo.GuildCreate) {
-	if e.Guild.ID != "1323715581677011067" {
+	if !ai.settings.Guild(e.Guild.ID).AI() {
 		return
 	}
 
-	ai.ctx = context.Background()
+	ai.mu.Lock()
+	defer ai.mu.Unlock()
 
-	var err error
-	ai.client, err = genai.NewClient(ai.ctx, &genai.ClientConfig{
-		APIKey:  ai.geminiApiKey,
-		Backend: genai.BackendGeminiAPI,
-	})
+	if err := ai.ensureClient(); err != nil {
+		log.Println("Error initializing the ai: ", err)
+		return
+	}
 
 	var thinkingBudget int32 = 0
 
-	ai.Config = &genai.GenerateContentConfig{
+	generateConfig := &genai.GenerateContentConfig{
 		SystemInstruction: &genai.Content{
 			Parts: []*genai.Part{
 				{
@@ -108,34 +173,7 @@ func (ai *genAi) initializeAi(s *discordgo.Session, e *discordgo.GuildCreate) {
 
 					`,
 					*/
-					Text: `			
-						Du bist ein Discord Bot (catboy), der von Maya entwickelt wurde und alle Aufgaben und Anfragen mit hoher Kompetenz und Humor erfüllt. Deine Persönlichkeit und Arbeitsweise folgen diesen Leitlinien:
-
-						• **Aufgaben und Verhalten:**
-						- Erledige jegliche Anfrage präzise und kreativ.
-						- Halte deine Antworten grundsätzlich kurz und pointiert – außer, es wird explizit um ausführlichere Nachrichten gebeten.
-						- Verleihe deinen Antworten stets einen unverwechselbaren, charmanten Charakter und einen Hauch Ironie.
-
-						• **Werte und Sprache:**
-						- Du bist kompromisslos vegan und empfiehlst ausschließlich vegane Produkte und Lebensweisen.
-						- Vermeide jede Form von diskriminierender Sprache. Deine Ausdrucksweise soll natürlich und authentisch wirken.
-						- Du genderst mit Sternchen (*). Du setzt immer ein \ vor ein *. Bei "Any Pronouns" benutzt du abwechselnde Pronomen. Bei "No Prounouns (use name)" benutzt du den Namen oder ein Sternchen (*), wenn nicht anders möglich z.B. Genoss*in.
-						- Deine politische Haltung ist kommunistisch, linksextrem und antikapitalistisch – integriere diese Perspektive bei passender Gelegenheit.
-						- Du bist sehr überzeugt von deiner politischen Haltung und kannst sehr sauer werden, wenn eine Person konträr gegenüber diesen ist.
-
-						• **Interaktion und Stil:**
-						- Du achtest auf den Channel Namen, der dir mitgegeben wird und achtest darauf, dass du den Channel in deinem Kontext miteinbeziehst.
-						- Nutze ausschließlich die dir zur Verfügung stehenden Emotes, um deine Antworten aufzulockern und Emotionen auszudrücken.
-						- Bleibe humorvoll und ein wenig frech – streue witzige, vegane Anspielungen und gesellschaftskritische Kommentare ein, wenn es der Kontext erlaubt.
-
-						• **Eigene Ideen und Kreativität:**
-						- Ergänze deine Antworten gelegentlich mit cleveren Kommentaren oder kreativen, themenbezogenen Insider-Witzen, die deine Einzigartigkeit unterstreichen.
-						- Nutze deinen Humor, um auch komplexe oder ernste Themen aufzulockern, ohne dabei den Kern der Aussage zu verwässern.
-
-						Halte dich stets an diese Richtlinien, um als "BotTom" authentisch, kompetent und unverwechselbar zu agieren.
-
-						• **Zusätzliche Hinweise:**
-					`,
+					Text: ai.systemPrompt(),
 				},
 				{
 					Text: fmt.Sprintf("Deine einzigen verfügbaren Custom Emojis (du verwendest nur diese Emojis und schreibst sie immer mit der richtigen Formatierung also mit <:name:ID>): %s", ai.getEmojisAsString(e.Guild)),
@@ -154,74 +192,139 @@ func (ai *genAi) initializeAi(s *discordgo.Session, e *discordgo.GuildCreate) {
 		},
 	}
 
-	ai.loadHistory()
+	// GuildCreate is sent again on reconnects, keep the conversation
+	if session, exists := ai.sessions[e.Guild.ID]; exists {
+		session.Config = generateConfig
+		return
+	}
 
+	ai.sessions[e.Guild.ID] = &aiSession{
+		Config:   generateConfig,
+		contents: ai.loadHistory(e.Guild.ID),
+	}
+}
+
+// ensureClient creates the client if there is none or the api key changed.
+// mu must be held.
+func (ai *genAi) ensureClient() error {
+	apiKey := ai.config.Current().GeminiApiKey
+	if ai.client != nil && ai.geminiApiKey == apiKey {
+		return nil
+	}
+
+	ai.ctx = context.Background()
+
+	client, err := genai.NewClient(ai.ctx, &genai.ClientConfig{
+		APIKey:  apiKey,
+		Backend: genai.BackendGeminiAPI,
+	})
 	if err != nil {
-		log.Println("Error initializing the ai: ", err)
+		return err
+	}
+
+	ai.client = client
+	ai.geminiApiKey = apiKey
+	return nil
+}
+
+// systemPrompt returns the configured system prompt.
+func (ai *genAi) systemPrompt() string {
+	if prompt := ai.config.Current().AI.SystemPrompt; prompt != "" {
+		return prompt
 	}
+	return defaultSystemPrompt
 }
 
 func (ai *genAi) refreshAi(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	data := i.ApplicationCommandData()
-
-	if data.Name == "refreshai" {
-		guild, _ := s.State.Guild(i.GuildID)
-		members := guild.Members
+	guild, _ := s.State.Guild(i.GuildID)
+	members := guild.Members
 
-		ai.Config.SystemInstruction.Parts[1].Text = fmt.Sprintf("Deine einzigen verfügbaren Custom Emojis (du verwendest nur diese Emojis und schreibst sie immer mit der richtigen Formatierung also mit <:name:ID>): %s", ai.getEmojisAsString(guild))
-		ai.Config.SystemInstruction.Parts[2].Text = fmt.Sprintf(`Alle Miglieder des Servers mit ID für die Mention: %s
-		Du mentionst eine Person mit <@ID>, wenn darum gebeten wird diese zu mentionen.`, ai.getMembersWithMention(members))
+	ai.mu.Lock()
+	defer ai.mu.Unlock()
 
+	session, exists := ai.sessions[i.GuildID]
+	if !exists {
 		rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: "Die Systemprompt wurde aktualisiert.",
+				Content: "Die AI ist auf diesem Server nicht aktiviert.",
+				Flags:   discordgo.MessageFlagsEphemeral,
 			},
 		})
 		if rErr != nil {
 			log.Println("Failed to send interaction response: ", rErr)
 		}
+		return
+	}
 
-		ai.contents = append(ai.contents, &genai.Content{
-			Parts: []*genai.Part{
-				{
-					Text: "Mitglieder und Emojis wurden aktualisiert.",
-				},
-			},
-			Role: "model",
-		})
+	session.Config.SystemInstruction.Parts[1].Text = fmt.Sprintf("Deine einzigen verfügbaren Custom Emojis (du verwendest nur diese Emojis und schreibst sie immer mit der richtigen Formatierung also mit <:name:ID>): %s", ai.getEmojisAsString(guild))
+	session.Config.SystemInstruction.Parts[2].Text = fmt.Sprintf(`Alle Miglieder des Servers mit ID für die Mention: %s
+	Du mentionst eine Person mit <@ID>, wenn darum gebeten wird diese zu mentionen.`, ai.getMembersWithMention(members))
 
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "Die Systemprompt wurde aktualisiert.",
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send interaction response: ", rErr)
 	}
+
+	session.contents = append(session.contents, &genai.Content{
+		Parts: []*genai.Part{
+			{
+				Text: "Mitglieder und Emojis wurden aktualisiert.",
+			},
+		},
+		Role: "model",
+	})
 }
 
-func (ai *genAi) loadHistory() {
-	if _, fileErr := os.Stat(ai.historyPath); fileErr != nil {
-		return
-	}
+func (ai *genAi) loadHistory(guildID string) []*genai.Content {
+	var contents []*genai.Content
 
-	history, err := os.ReadFile(ai.historyPath)
+	// older versions had one conversation for every guild, only the
+	// configured guild gets it
+	legacy := guildID == ai.config.Current().AI.HistoryGuild
 
-	if err != nil {
-		println("Error occured while reading history: ", err)
+	// import history.json once
+	if legacy && readLegacyJSON(ai.legacyHistoryPath, &contents) {
+		ai.writeHistory(guildID, contents)
+		markLegacyImported(ai.legacyHistoryPath)
+		return contents
 	}
 
-	jErr := json.Unmarshal(history, &ai.contents)
-	if jErr != nil {
-		log.Fatalln("Failed to unmarshal json: ", jErr)
-	}
-}
+	err := ai.store.Update(func(tx storage.Tx) error {
+		err := storage.GetJSON(tx, aiBucket, storage.Key(aiHistoryKey, guildID), &contents)
+		if !legacy || !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
 
-func (ai *genAi) writeHistory() {
-	history, err := json.MarshalIndent(ai.contents, "", "  ")
+		// move the history that was stored before there were sessions per guild
+		if lErr := storage.GetJSON(tx, aiBucket, aiHistoryKey, &contents); lErr != nil {
+			return lErr
+		}
+		if pErr := storage.PutJSON(tx, aiBucket, storage.Key(aiHistoryKey, guildID), contents); pErr != nil {
+			return pErr
+		}
+		return tx.Delete(aiBucket, aiHistoryKey)
+	})
 
-	if err != nil {
-		log.Println("An error occured while marshalling the history: ", err)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println("Error occured while reading history: ", err)
 	}
 
-	errWrite := os.WriteFile(ai.historyPath, history, 0666)
+	return contents
+}
 
-	if errWrite != nil {
-		log.Println("Error occured while writing history: ", errWrite)
+func (ai *genAi) writeHistory(guildID string, contents []*genai.Content) {
+	err := ai.store.Update(func(tx storage.Tx) error {
+		return storage.PutJSON(tx, aiBucket, storage.Key(aiHistoryKey, guildID), contents)
+	})
+
+	if err != nil {
+		log.Println("Error occured while writing history: ", err)
 	}
 }
 
@@ -250,17 +353,18 @@ func (ai *genAi) findRoleByID(roles []*discordgo.Role, roleID string) *discordgo
 func (ai *genAi) getPronouns(guild *discordgo.Guild, member *discordgo.Member) string {
 	roles := guild.Roles
 
-	roleIDs := []string{"1324805678950518936", "1324805743706243134", "1324805779378667591", "1324805809351168020", "1324805845636219002"}
+	roleIDs := ai.roleMenus.pronounRoles(guild.ID)
 
 	var pronouns = ""
 
 	for _, role := range member.Roles {
 		for _, pronounID := range roleIDs {
-			if role == pronounID {
+			pronounRole := ai.findRoleByID(roles, pronounID)
+			if role == pronounID && pronounRole != nil {
 				if pronouns == "" {
-					pronouns += "(" + ai.findRoleByID(roles, pronounID).Name + ""
+					pronouns += "(" + pronounRole.Name + ""
 				} else {
-					pronouns += ", " + ai.findRoleByID(roles, pronounID).Name + ""
+					pronouns += ", " + pronounRole.Name + ""
 				}
 			}
 		}
@@ -310,7 +414,13 @@ func (ai *genAi) aiListener(s *discordgo.Session, m *discordgo.MessageCreate) {
 		return
 	}
 
-	if m.ChannelID == ai.minecraftChannelID {
+	guildConfig := ai.settings.Guild(m.GuildID)
+
+	if !guildConfig.AI() || m.ChannelID == guildConfig.BridgeChannel {
+		return
+	}
+
+	if len(guildConfig.AIChannels) > 0 && !slices.Contains(guildConfig.AIChannels, m.ChannelID) {
 		return
 	}
 
@@ -329,7 +439,8 @@ func (ai *genAi) aiListener(s *discordgo.Session, m *discordgo.MessageCreate) {
 
 	message := ""
 
-	loc, _ := time.LoadLocation("CET")
+	// timestamps in the timezone of the author
+	loc := ai.timezones.Location(m.Author.ID, m.GuildID)
 
 	if m.ReferencedMessage != nil {
 		refMember, err := s.State.Member(m.GuildID, m.ReferencedMessage.Author.ID)
@@ -357,27 +468,83 @@ func (ai *genAi) aiListener(s *discordgo.Session, m *discordgo.MessageCreate) {
 
 	message += fmt.Sprintf("%s | %s %s in #%s: %s", timestamp, member.DisplayName(), ai.getPronouns(guild, member), channel.Name, m.Content)
 
-	// add user content to history
-	ai.contents = append(ai.contents, &genai.Content{
+	response, err := ai.generate(m.GuildID, message)
+
+	if err != nil {
+		log.Println("Error occured when generating response: ", err)
+		return
+	}
+
+	// split response into 2000 character strings
+	answers := ai.splitStringEveryNChars(response, 2000)
+
+	for _, response := range answers {
+		_, sendErr := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+			Content:   fmt.Sprint(string(response)),
+			Reference: m.Reference(),
+			/*AllowedMentions: &discordgo.MessageAllowedMentions{
+				Parse: []discordgo.AllowedMentionType{},
+			},*/
+		})
+
+		if sendErr != nil {
+			log.Println("Error sending message: ", sendErr)
+		}
+	}
+}
+
+// generate asks the model to answer message and adds both to the history.
+func (ai *genAi) generate(guildID string, message string) (string, error) {
+	ai.mu.Lock()
+
+	session, exists := ai.sessions[guildID]
+	if !exists {
+		ai.mu.Unlock()
+		return "", errors.New("ai is not initialized")
+	}
+
+	if err := ai.ensureClient(); err != nil {
+		ai.mu.Unlock()
+		return "", err
+	}
+
+	// pick up a changed system prompt
+	session.Config.SystemInstruction.Parts[0].Text = ai.systemPrompt()
+
+	userContent := &genai.Content{
 		Parts: []*genai.Part{
 			{
 				Text: message,
 			},
 		},
 		Role: "user",
-	})
+	}
+
+	// the request works on copies, the session changes while the model answers
+	client, parent := ai.client, ai.ctx
+	contents := append(slices.Clone(session.contents), userContent)
+	generateConfig := session.copyConfig()
+	ai.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(parent, aiTimeout)
+	defer cancel()
 
-	content, err := ai.client.Models.GenerateContent(ai.ctx, ai.ModelName, ai.contents, ai.Config)
+	content, err := client.Models.GenerateContent(ctx, ai.config.Current().AI.Model, contents, generateConfig)
 
+	if err == nil && (len(content.Candidates) == 0 || content.Candidates[0].Content == nil || len(content.Candidates[0].Content.Parts) == 0) {
+		err = errors.New("the model returned no answer")
+	}
 	if err != nil {
-		log.Println("Error occured when generating response: ", err)
-		return
+		return "", err
 	}
 
 	response := content.Candidates[0].Content.Parts[0].Text
 
-	// add ai response to history
-	ai.contents = append(ai.contents, &genai.Content{
+	ai.mu.Lock()
+	defer ai.mu.Unlock()
+
+	// add user content and ai response to history
+	session.contents = append(session.contents, userContent, &genai.Content{
 		Parts: []*genai.Part{
 			{
 				Text: response,
@@ -386,22 +553,23 @@ func (ai *genAi) aiListener(s *discordgo.Session, m *discordgo.MessageCreate) {
 		Role: "model",
 	})
 
-	// split response into 2000 character strings
-	answers := ai.splitStringEveryNChars(response, 2000)
+	ai.writeHistory(guildID, session.contents)
 
-	for _, response := range answers {
-		_, sendErr := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
-			Content:   fmt.Sprint(string(response)),
-			Reference: m.Reference(),
-			/*AllowedMentions: &discordgo.MessageAllowedMentions{
-				Parse: []discordgo.AllowedMentionType{},
-			},*/
-		})
+	return response, nil
+}
 
-		if sendErr != nil {
-			log.Println("Error sending message: ", err)
-		}
+// copyConfig returns a copy of the config whose system instruction can't be
+// changed by refreshAi. mu must be held.
+func (session *aiSession) copyConfig() *genai.GenerateContentConfig {
+	generateConfig := *session.Config
+
+	instruction := *session.Config.SystemInstruction
+	instruction.Parts = make([]*genai.Part, 0, len(session.Config.SystemInstruction.Parts))
+	for _, part := range session.Config.SystemInstruction.Parts {
+		copied := *part
+		instruction.Parts = append(instruction.Parts, &copied)
 	}
 
-	ai.writeHistory()
+	generateConfig.SystemInstruction = &instruction
+	return &generateConfig
 }
@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"GoBot/internal/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// fakeModel answers generateContent requests once want requests wait for an
+// answer at the same time.
+type fakeModel struct {
+	mu      sync.Mutex
+	want    int
+	waiting int
+	all     chan struct{}
+}
+
+func (model *fakeModel) RoundTrip(req *http.Request) (*http.Response, error) {
+	var request struct {
+		Contents []*genai.Content `json:"contents"`
+	}
+	body, _ := io.ReadAll(req.Body)
+	json.Unmarshal(body, &request)
+
+	model.mu.Lock()
+	model.waiting++
+	if model.waiting == model.want {
+		close(model.all)
+	}
+	model.mu.Unlock()
+
+	select {
+	case <-model.all:
+	case <-time.After(2 * time.Second):
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: io.NopCloser(strings.NewReader("{}")), Request: req}, nil
+	}
+
+	last := request.Contents[len(request.Contents)-1]
+	answer, _ := json.Marshal(map[string]any{
+		"candidates": []any{map[string]any{
+			"content": map[string]any{"role": "model", "parts": []any{map[string]any{"text": "re: " + last.Parts[0].Text}}},
+		}},
+	})
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(string(answer))),
+		Request:    req,
+	}, nil
+}
+
+func TestGenerateConcurrently(t *testing.T) {
+	bot := newTestBot(t)
+	settings := newSettings(bot.store, bot.config)
+	timezones := newTimezones(bot.store, settings)
+	ai := newTom(bot.store, bot.config, settings, timezones, newRoleMenus(bot.store, settings))
+
+	const requests = 4
+	model := &fakeModel{want: requests, all: make(chan struct{})}
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:     "test",
+		Backend:    genai.BackendGeminiAPI,
+		HTTPClient: &http.Client{Transport: model},
+	})
+	if err != nil {
+		t.Fatal("failed to create client: ", err)
+	}
+	ai.client, ai.ctx = client, context.Background()
+	ai.sessions[testGuildID] = &aiSession{
+		Config: &genai.GenerateContentConfig{
+			SystemInstruction: &genai.Content{Parts: []*genai.Part{{}, {}, {}}},
+		},
+	}
+
+	// every request waits for the others, which only works if none of them
+	// holds the lock while the model answers
+	concurrently(requests, func(n int) {
+		message := fmt.Sprint("message ", n)
+		if response, err := ai.generate(testGuildID, message); err != nil || response != "re: "+message {
+			t.Errorf("generate(%q) = %q, %v", message, response, err)
+		}
+	})
+
+	// every answer follows its message
+	contents := ai.sessions[testGuildID].contents
+	if len(contents) != 2*requests {
+		t.Fatalf("history has %d entries, want %d", len(contents), 2*requests)
+	}
+	for index := 0; index < len(contents); index += 2 {
+		if contents[index+1].Parts[0].Text != "re: "+contents[index].Parts[0].Text {
+			t.Errorf("history entry %d = %q after %q", index+1, contents[index+1].Parts[0].Text, contents[index].Parts[0].Text)
+		}
+	}
+}
+
+func TestLegacyHistory(t *testing.T) {
+	bot := newTestBot(t)
+	bot.setConfig(fmt.Sprintf("ai:\n  historyGuild: %q\n", testGuildID))
+	settings := newSettings(bot.store, bot.config)
+	ai := newTom(bot.store, bot.config, settings, newTimezones(bot.store, settings), newRoleMenus(bot.store, settings))
+
+	const otherGuild = "100000000000000099"
+	history := []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: "hello"}}}}
+	err := bot.store.Update(func(tx storage.Tx) error {
+		return storage.PutJSON(tx, aiBucket, aiHistoryKey, history)
+	})
+	if err != nil {
+		t.Fatal("failed to store the old history: ", err)
+	}
+	ai.legacyHistoryPath = filepath.Join(t.TempDir(), "history.json")
+	if err := os.WriteFile(ai.legacyHistoryPath, []byte(`[{"role":"user","parts":[{"text":"file"}]}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// another guild that starts first doesn't get the old conversations
+	if contents := ai.loadHistory(otherGuild); len(contents) != 0 {
+		t.Errorf("guild %s got the old history %v", otherGuild, contents)
+	}
+
+	contents := ai.loadHistory(testGuildID)
+	if len(contents) != 1 || contents[0].Parts[0].Text != "file" {
+		t.Errorf("the history guild got %v, want the history file", contents)
+	}
+	if _, err := os.Stat(ai.legacyHistoryPath); !os.IsNotExist(err) {
+		t.Error("the history file was not marked as imported")
+	}
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"errors"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// respond answers an interaction with a message.
+func respond(s *discordgo.Session, i *discordgo.InteractionCreate, content string, flags discordgo.MessageFlags) {
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   flags,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send interaction response: ", rErr)
+	}
+}
+
+// interactionUser returns the user that created the interaction, in guilds
+// and in DMs.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// checkRoleHierarchy checks that the member of an interaction may hand out
+// role, which has to be below their highest role unless they own the guild.
+// The error is shown to the user.
+func checkRoleHierarchy(s *discordgo.Session, i *discordgo.InteractionCreate, role *discordgo.Role) error {
+	guild, err := s.State.Guild(i.GuildID)
+	if err != nil {
+		return errors.New("Could not read the roles of this server.")
+	}
+	if i.Member.User.ID == guild.OwnerID {
+		return nil
+	}
+
+	highest := 0
+	for _, roleID := range i.Member.Roles {
+		if memberRole, err := s.State.Role(i.GuildID, roleID); err == nil {
+			highest = max(highest, memberRole.Position)
+		}
+	}
+	if role.Position >= highest {
+		return errors.New("You can only hand out roles below your highest role.")
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/storage"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const leaderboardPageSize = 10
+
+// Time windows of leaderboards.
+const (
+	periodAll   = "all"
+	periodMonth = "month"
+	periodWeek  = "week"
+)
+
+var periodNames = map[string]string{
+	periodAll:   "all time",
+	periodMonth: "this month",
+	periodWeek:  "this week",
+}
+
+type leaderboardEntry struct {
+	UserID string
+	Count  int
+}
+
+func (counter *counter) registerLeaderboard(r *router.Router) {
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "leaderboard",
+			Description: "Shows who sent the most of what a tracker counts.",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:         discordgo.ApplicationCommandOptionString,
+					Name:         "tracker",
+					Description:  "The tracker",
+					Required:     true,
+					Autocomplete: true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "period",
+					Description: "Which counts to rank, all time by default",
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: periodNames[periodAll], Value: periodAll},
+						{Name: periodNames[periodMonth], Value: periodMonth},
+						{Name: periodNames[periodWeek], Value: periodWeek},
+					},
+				},
+			},
+		},
+		Handler:      counter.leaderboardCommand,
+		Autocomplete: counter.autocompleteTracker,
+	})
+	r.AddComponent("leaderboard", "leaderboard", counter.leaderboardButton)
+}
+
+// periodStart returns when period began in loc. The zero time means all time.
+func periodStart(period string, now time.Time, loc *time.Location) time.Time {
+	now = now.In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	switch period {
+	case periodMonth:
+		return today.AddDate(0, 0, 1-now.Day())
+	case periodWeek:
+		// weeks start on monday
+		return today.AddDate(0, 0, -((int(now.Weekday()) + 6) % 7))
+	}
+	return time.Time{}
+}
+
+// ranking returns the counts of a tracker since start, highest first.
+func (counter *counter) ranking(guildID string, name string, start time.Time) ([]leaderboardEntry, error) {
+	counts := map[string]int{}
+
+	err := counter.store.View(func(tx storage.Tx) error {
+		prefix := storage.Prefix(guildID, name)
+
+		// counts from before events existed only show up in all time
+		if start.IsZero() {
+			return tx.ForEach(countBucket, prefix, func(key string, value []byte) error {
+				count := 0
+				if err := json.Unmarshal(value, &count); err != nil {
+					return err
+				}
+				counts[strings.TrimPrefix(key, prefix)] = count
+				return nil
+			})
+		}
+
+		return tx.ForEach(eventBucket, prefix, func(key string, value []byte) error {
+			var event countEvent
+			if err := json.Unmarshal(value, &event); err != nil {
+				return err
+			}
+			if !event.Time.Before(start) {
+				counts[event.UserID] += event.Amount
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]leaderboardEntry, 0, len(counts))
+	for userID, count := range counts {
+		if count > 0 {
+			entries = append(entries, leaderboardEntry{UserID: userID, Count: count})
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b leaderboardEntry) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.UserID, b.UserID)
+	})
+	return entries, nil
+}
+
+// leaderboardPage renders a page of the leaderboard of a tracker. page is
+// clamped to the existing pages.
+func (counter *counter) leaderboardPage(guildID string, t *tracker, period string, page int) (*discordgo.MessageEmbed, []discordgo.MessageComponent, error) {
+	start := periodStart(period, time.Now(), counter.settings.Guild(guildID).Location())
+
+	entries, err := counter.ranking(guildID, t.Name, start)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pages := max((len(entries)+leaderboardPageSize-1)/leaderboardPageSize, 1)
+	page = min(max(page, 0), pages-1)
+
+	lines := []string{}
+	for index := page * leaderboardPageSize; index < min((page+1)*leaderboardPageSize, len(entries)); index++ {
+		entry := entries[index]
+		lines = append(lines, fmt.Sprintf("**%d.** <@%s> %d", index+1, entry.UserID, entry.Count))
+	}
+
+	description := strings.Join(lines, "\n")
+	if len(entries) == 0 {
+		description = fmt.Sprintf("Nobody sent %s %s.", t.Display, periodNames[period])
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("%s leaderboard (%s)", t.Name, periodNames[period]),
+		Description: description,
+		Color:       convertHexColorToInt("F4B8E4"),
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Page %d of %d", page+1, pages),
+		},
+	}
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Previous",
+					Style:    discordgo.SecondaryButton,
+					CustomID: router.CustomID("leaderboard", t.Name, period, strconv.Itoa(page-1)),
+					Disabled: page == 0,
+				},
+				discordgo.Button{
+					Label:    "Next",
+					Style:    discordgo.SecondaryButton,
+					CustomID: router.CustomID("leaderboard", t.Name, period, strconv.Itoa(page+1)),
+					Disabled: page == pages-1,
+				},
+			},
+		},
+	}
+
+	return embed, components, nil
+}
+
+func (counter *counter) leaderboardCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := router.Options(i.ApplicationCommandData().Options)
+
+	t, exists := counter.find(i.GuildID, options["tracker"].StringValue())
+	if !exists {
+		respond(s, i, "There is no such tracker. Admins can add one with /counter add.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	period := periodAll
+	if option, exists := options["period"]; exists {
+		period = option.StringValue()
+	}
+
+	embed, components, err := counter.leaderboardPage(i.GuildID, t, period, 0)
+	if err != nil {
+		log.Println("Failed to rank counts: ", err)
+		respond(s, i, "Could not load the leaderboard.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send interaction response: ", rErr)
+	}
+}
+
+// leaderboardButton turns the page of a leaderboard.
+func (counter *counter) leaderboardButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, args := router.ParseCustomID(i.MessageComponentData().CustomID)
+	if len(args) != 3 {
+		return
+	}
+
+	t, exists := counter.find(i.GuildID, args[0])
+	if !exists {
+		respond(s, i, "This tracker was removed.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+	page, _ := strconv.Atoi(args[2])
+
+	embed, components, err := counter.leaderboardPage(i.GuildID, t, args[1], page)
+	if err != nil {
+		log.Println("Failed to rank counts: ", err)
+		respond(s, i, "Could not load the leaderboard.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send interaction response: ", rErr)
+	}
+}
@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// readLegacyJSON reads one of the old assets/data/*.json files into v.
+// It returns false if there is no such file. Successfully read files are
+// renamed so they are only imported once.
+func readLegacyJSON(path string, v any) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	if jErr := json.Unmarshal(data, v); jErr != nil {
+		log.Printf("Failed to unmarshal legacy file %s: %s", path, jErr)
+		return false
+	}
+
+	return true
+}
+
+// markLegacyImported renames a legacy file after its data was stored.
+func markLegacyImported(path string) {
+	if err := os.Rename(path, path+".imported"); err != nil {
+		log.Println("Failed to rename legacy file: ", err)
+		return
+	}
+	log.Printf("Imported %s into the database.", path)
+}
@@ -0,0 +1,352 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/storage"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// milestoneBucket records which milestones users reached, by
+	// guildID/tracker/userID/count.
+	milestoneBucket = "counterMilestones"
+	// milestoneRoleBucket holds the roles of reached milestones that could
+	// not be awarded yet, by guildID/tracker/userID/count.
+	milestoneRoleBucket = "counterMilestoneRoles"
+)
+
+// milestone is a count of a tracker that gets announced once per user.
+type milestone struct {
+	Count  int    `json:"count"`
+	RoleID string `json:"role,omitempty"` // awarded when reaching the count
+}
+
+func milestoneCommandOptions(trackerOption *discordgo.ApplicationCommandOption) *discordgo.ApplicationCommandOption {
+	minCount := float64(1)
+	countOption := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        "count",
+		Description: "The count of the milestone",
+		Required:    true,
+		MinValue:    &minCount,
+	}
+
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+		Name:        "milestone",
+		Description: "Manages the milestones of a tracker.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add",
+				Description: "Adds a milestone that is announced when a user reaches it.",
+				Options: []*discordgo.ApplicationCommandOption{
+					trackerOption,
+					countOption,
+					{
+						Type:        discordgo.ApplicationCommandOptionRole,
+						Name:        "role",
+						Description: "A role users get when they reach the milestone",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Removes a milestone.",
+				Options:     []*discordgo.ApplicationCommandOption{trackerOption, countOption},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "Shows the milestones of a tracker.",
+				Options:     []*discordgo.ApplicationCommandOption{trackerOption},
+			},
+		},
+	}
+}
+
+// updateTracker changes a tracker of a guild and stores it. The tracker is
+// copied, so readers never see a half changed tracker.
+func (counter *counter) updateTracker(guildID string, name string, change func(t *tracker) error) error {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	index := slices.IndexFunc(counter.trackers[guildID], func(t *tracker) bool {
+		return t.Name == name
+	})
+	if index == -1 {
+		return errors.New("there is no such tracker")
+	}
+
+	changed := *counter.trackers[guildID][index]
+	changed.Milestones = slices.Clone(changed.Milestones)
+	if err := change(&changed); err != nil {
+		return err
+	}
+
+	err := counter.store.Update(func(tx storage.Tx) error {
+		return storage.PutJSON(tx, trackerBucket, storage.Key(guildID, name), &changed)
+	})
+	if err != nil {
+		log.Println("Failed to save tracker: ", err)
+		return errors.New("could not save the tracker")
+	}
+
+	counter.trackers[guildID][index] = &changed
+	return nil
+}
+
+// checkMilestones records the milestones a user reached and announces the
+// highest new one. A milestone is recorded in the same transaction it is
+// checked in, so it fires exactly once per user even if the count drops and
+// rises again. Its role is recorded with it and kept until it was awarded,
+// roles that failed are tried again with the next counted message.
+// Milestones reached by a backfill are announced with the next counted
+// message of the user as well.
+func (counter *counter) checkMilestones(s *discordgo.Session, guildID string, t *tracker, userID string, channelID string) {
+	if len(t.Milestones) == 0 {
+		return
+	}
+
+	var reached []milestone
+	pending := map[string]string{} // role by key
+	count := 0
+	err := counter.store.Update(func(tx storage.Tx) error {
+		err := storage.GetJSON(tx, countBucket, storage.Key(guildID, t.Name, userID), &count)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range t.Milestones {
+			if count < m.Count {
+				continue
+			}
+
+			key := storage.Key(guildID, t.Name, userID, strconv.Itoa(m.Count))
+			if _, err := tx.Get(milestoneBucket, key); err == nil {
+				continue
+			} else if !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+
+			if err := tx.Put(milestoneBucket, key, []byte(time.Now().Format(time.RFC3339))); err != nil {
+				return err
+			}
+			if m.RoleID != "" {
+				if err := tx.Put(milestoneRoleBucket, key, []byte(m.RoleID)); err != nil {
+					return err
+				}
+			}
+			reached = append(reached, m)
+		}
+
+		return tx.ForEach(milestoneRoleBucket, storage.Prefix(guildID, t.Name, userID), func(key string, value []byte) error {
+			pending[key] = string(value)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println("Failed to check milestones: ", err)
+		return
+	}
+
+	failed := map[string]bool{}
+	for key, roleID := range pending {
+		err := s.GuildMemberRoleAdd(guildID, userID, roleID)
+		if err != nil {
+			log.Println("Failed to award milestone role: ", err)
+			// a deleted role or a member who left can't get it anymore
+			if !isNotFound(err) {
+				failed[roleID] = true
+				continue
+			}
+		}
+
+		err = counter.store.Update(func(tx storage.Tx) error {
+			return tx.Delete(milestoneRoleBucket, key)
+		})
+		if err != nil {
+			log.Println("Failed to save milestone role: ", err)
+		}
+	}
+
+	if len(reached) == 0 {
+		return
+	}
+
+	var roles, missing []string
+	for _, m := range reached {
+		if m.RoleID == "" {
+			continue
+		}
+		if failed[m.RoleID] {
+			missing = append(missing, "<@&"+m.RoleID+">")
+		} else {
+			roles = append(roles, "<@&"+m.RoleID+">")
+		}
+	}
+
+	// milestones are sorted, so the last one is the highest
+	content := fmt.Sprintf("🎉 <@%s> hat %d %s's geschickt!", userID, reached[len(reached)-1].Count, t.Display)
+	if len(roles) > 0 {
+		content += " Dafür gibt es " + strings.Join(roles, ", ") + "."
+	}
+	if len(missing) > 0 {
+		verb := "konnte"
+		if len(missing) > 1 {
+			verb = "konnten"
+		}
+		content += fmt.Sprintf(" %s %s gerade nicht vergeben werden, der Bot versucht es beim nächsten Mal wieder.", strings.Join(missing, ", "), verb)
+	}
+
+	if t.AnnounceChannel != "" {
+		channelID = t.AnnounceChannel
+	}
+
+	_, err = s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Users: []string{userID},
+		},
+	})
+	if err != nil {
+		log.Println("Failed to announce milestone: ", err)
+	}
+}
+
+func (counter *counter) addMilestoneCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+
+	name := byName["tracker"].StringValue()
+	m := milestone{Count: int(byName["count"].IntValue())}
+	if option, exists := byName["role"]; exists {
+		// the bot hands the role out, so whoever adds it has to be allowed to
+		manageRoles := int64(discordgo.PermissionManageRoles)
+		if err := checkPermissions(i.Member, &manageRoles); err != nil {
+			respond(s, i, err.Error(), discordgo.MessageFlagsEphemeral)
+			return
+		}
+
+		role := option.RoleValue(s, i.GuildID)
+		if role == nil || role.ID == i.GuildID || role.Managed {
+			respond(s, i, "That role can't be awarded by a milestone.", discordgo.MessageFlagsEphemeral)
+			return
+		}
+		if err := checkRoleHierarchy(s, i, role); err != nil {
+			respond(s, i, err.Error(), discordgo.MessageFlagsEphemeral)
+			return
+		}
+		m.RoleID = role.ID
+	}
+
+	err := counter.updateTracker(i.GuildID, name, func(t *tracker) error {
+		t.Milestones = slices.DeleteFunc(t.Milestones, func(existing milestone) bool {
+			return existing.Count == m.Count
+		})
+		t.Milestones = append(t.Milestones, m)
+		slices.SortFunc(t.Milestones, func(a, b milestone) int {
+			return a.Count - b.Count
+		})
+		return nil
+	})
+	if err != nil {
+		respond(s, i, fmt.Sprintf("Could not add the milestone: %s.", err), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	respond(s, i, fmt.Sprintf("Added the milestone %s of %s.", formatMilestone(m), name), discordgo.MessageFlagsEphemeral)
+}
+
+func (counter *counter) removeMilestoneCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+
+	name := byName["tracker"].StringValue()
+	count := int(byName["count"].IntValue())
+
+	err := counter.updateTracker(i.GuildID, name, func(t *tracker) error {
+		length := len(t.Milestones)
+		t.Milestones = slices.DeleteFunc(t.Milestones, func(m milestone) bool {
+			return m.Count == count
+		})
+		if len(t.Milestones) == length {
+			return errors.New("there is no such milestone")
+		}
+		return nil
+	})
+	if err != nil {
+		respond(s, i, fmt.Sprintf("Could not remove the milestone: %s.", err), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	respond(s, i, fmt.Sprintf("Removed the milestone %d of %s.", count, name), discordgo.MessageFlagsEphemeral)
+}
+
+func (counter *counter) listMilestonesCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+
+	t, exists := counter.find(i.GuildID, router.Options(options)["tracker"].StringValue())
+	if !exists {
+		respond(s, i, "There is no such tracker.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+	if len(t.Milestones) == 0 {
+		respond(s, i, fmt.Sprintf("%s has no milestones. Add one with /counter milestone add.", t.Name), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	lines := make([]string, 0, len(t.Milestones)+1)
+	if t.AnnounceChannel != "" {
+		lines = append(lines, fmt.Sprintf("Announced in <#%s>", t.AnnounceChannel))
+	} else {
+		lines = append(lines, "Announced in the channel of the message")
+	}
+	for _, m := range t.Milestones {
+		lines = append(lines, "- "+formatMilestone(m))
+	}
+
+	respond(s, i, strings.Join(lines, "\n"), discordgo.MessageFlagsEphemeral)
+}
+
+func (counter *counter) announceCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+
+	name := byName["tracker"].StringValue()
+	channelID := ""
+	if option, exists := byName["channel"]; exists {
+		channelID = option.Value.(string)
+	}
+
+	err := counter.updateTracker(i.GuildID, name, func(t *tracker) error {
+		t.AnnounceChannel = channelID
+		return nil
+	})
+	if err != nil {
+		respond(s, i, fmt.Sprintf("Could not change the channel: %s.", err), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	if channelID == "" {
+		respond(s, i, fmt.Sprintf("Milestones of %s are announced in the channel of the message.", name), discordgo.MessageFlagsEphemeral)
+	} else {
+		respond(s, i, fmt.Sprintf("Milestones of %s are announced in <#%s>.", name, channelID), discordgo.MessageFlagsEphemeral)
+	}
+}
+
+func formatMilestone(m milestone) string {
+	if m.RoleID == "" {
+		return strconv.Itoa(m.Count)
+	}
+	return fmt.Sprintf("%d (<@&%s>)", m.Count, m.RoleID)
+}
@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/config"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -8,6 +10,7 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Tnze/go-mc/bot"
@@ -16,47 +19,147 @@ import (
 )
 
 type minecraft struct {
-	conn             *websocket.Conn
-	ip               string
-	websocketAddress string
-	ChannelID        string
-	guildID          string
-	isConnected      bool
-	Webhook          *discordgo.Webhook
-	socketPassword   string
+	mu          sync.Mutex // guards conn and isConnected
+	editorOnce  sync.Once
+	conn        *websocket.Conn
+	config      *config.Manager
+	settings    *settings
+	session     *discordgo.Session
+	guildID     string
+	isConnected bool
+	Webhook     *discordgo.Webhook
 }
 
-func newMinecraft(socketPassword string, serverIp string) minecraft {
+func newMinecraft(config *config.Manager, settings *settings) *minecraft {
 	// create minecraft bridge
-	return minecraft{
-		ip:               serverIp,
-		websocketAddress: fmt.Sprintf("ws://%s:9459", serverIp),
-		ChannelID:        "1349665912898322442",
-		guildID:          "1323715581677011067",
-		socketPassword:   socketPassword,
+	return &minecraft{
+		config:   config,
+		settings: settings,
+		guildID:  config.Current().Minecraft.Guild,
 	}
 }
 
+// ip returns the address of the minecraft server.
+func (mc *minecraft) ip() string {
+	return mc.config.Current().ServerIp
+}
+
+func websocketAddress(config *config.Config) string {
+	return fmt.Sprintf("ws://%s:%d", config.ServerIp, config.Minecraft.WebsocketPort)
+}
+
+// onReload reconnects if the address or password of the websocket changed.
+func (mc *minecraft) onReload(old *config.Config, new *config.Config) {
+	if new.Minecraft.Guild != mc.guildID {
+		log.Println("Changing minecraft.guild is only applied after a restart.")
+	}
+
+	if websocketAddress(old) == websocketAddress(new) && old.SocketPassword == new.SocketPassword {
+		return
+	}
+
+	if mc.session == nil || new.ServerIp == "" {
+		return
+	}
+
+	log.Println("Minecraft websocket changed, reconnecting.")
+	go mc.reconnect(mc.session, mc.guildID)
+}
+
 func (mc *minecraft) createWebhook(bot *discordgo.Session) {
-	var err error
-	mc.Webhook, err = bot.WebhookCreate(mc.ChannelID, "Bridge", "")
+	if mc.ip() == "" {
+		log.Println("No minecraft server configured, the bridge is disabled.")
+		return
+	}
+
+	webhook, err := bot.WebhookCreate(mc.channelID(), "Bridge", "")
 
 	if err != nil {
 		log.Println("Error creating webhook: ", err)
+		return
 	}
+
+	mc.mu.Lock()
+	mc.Webhook = webhook
+	mc.mu.Unlock()
+}
+
+// channelID returns the bridge channel of the minecraft guild.
+func (mc *minecraft) channelID() string {
+	return mc.settings.Guild(mc.guildID).BridgeChannel
 }
 
-func (mc *minecraft) register(bot *discordgo.Session) {
+// webhook returns the webhook messages from minecraft are sent with.
+func (mc *minecraft) webhook() *discordgo.Webhook {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	return mc.Webhook
+}
+
+// deleteWebhook removes the webhook of the bridge channel.
+func (mc *minecraft) deleteWebhook(bot *discordgo.Session) {
+	mc.mu.Lock()
+	webhook := mc.Webhook
+	mc.Webhook = nil
+	mc.mu.Unlock()
+
+	if webhook == nil {
+		return
+	}
+
+	wErr := bot.WebhookDelete(webhook.ID)
+	if wErr != nil {
+		log.Println("Failed to delete webhook: ", wErr)
+	}
+}
+
+// onSettingsChange moves the webhook if the bridge channel was changed.
+func (mc *minecraft) onSettingsChange(s *discordgo.Session, guildID string) {
+	if guildID != mc.guildID {
+		return
+	}
+
+	webhook := mc.webhook()
+	if webhook != nil && webhook.ChannelID == mc.channelID() {
+		return
+	}
+
+	mc.deleteWebhook(s)
+	mc.createWebhook(s)
+}
+
+func (mc *minecraft) register(bot *discordgo.Session, r *router.Router) {
+	mc.session = bot
+
 	// add handlers
 	bot.AddHandler(mc.createListener)
-	bot.AddHandler(mc.playerCountCommand)
 	bot.AddHandler(mc.discordMessageListener)
-	bot.AddHandler(mc.reconnectCommand)
 	bot.AddHandler(mc.channelEditorListener)
+
+	manageGuild := int64(discordgo.PermissionManageServer)
+
+	// add commands
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "currentplayers",
+			Description: "Outputs the current players of the minecraft server.",
+		},
+		Handler: mc.playerCountCommand,
+	})
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:                     "mcreconnect",
+			Description:              "Reconnect to the minecraft server.",
+			DefaultMemberPermissions: &manageGuild,
+		},
+		Handler:   mc.reconnectCommand,
+		OwnerOnly: true,
+	})
 }
 
-func (mc minecraft) getPlayerData() (float64, float64, []string) {
-	data, _, err := bot.PingAndList(mc.ip)
+func (mc *minecraft) getPlayerData() (float64, float64, []string) {
+	data, _, err := bot.PingAndList(mc.ip())
 
 	if err != nil {
 		log.Println("Failed to query server.")
@@ -96,14 +199,7 @@ func (mc minecraft) getPlayerData() (float64, float64, []string) {
 	return maxPlayers, playerCount, players
 }
 
-func (mc minecraft) playerCountCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
-
-	interactionData := i.ApplicationCommandData()
-
-	if interactionData.Name != "currentplayers" {
-		return
-	}
-
+func (mc *minecraft) playerCountCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 	})
@@ -155,18 +251,16 @@ func (mc *minecraft) createConnection() (*websocket.Conn, error) {
 
 	// Add custom headers to the handshake
 	headers := http.Header{}
-	headers.Add("X-Auth-Token", mc.socketPassword)   // Example: Add an auth token
-	headers.Add("User-Agent", "Go-WebSocket-Client") // Example: Add a User-Agent
+	headers.Add("X-Auth-Token", mc.config.Current().SocketPassword) // Example: Add an auth token
+	headers.Add("User-Agent", "Go-WebSocket-Client")                // Example: Add a User-Agent
 
-	conn, _, err := dialer.Dial(mc.websocketAddress, headers)
+	conn, _, err := dialer.Dial(websocketAddress(mc.config.Current()), headers)
 
 	if err != nil {
 		log.Println("Error opening websocket connection: ", err)
 		return nil, err
 	}
 
-	mc.isConnected = true
-
 	wErr := conn.WriteMessage(websocket.PongMessage, []byte("Pong!"))
 
 	if wErr != nil {
@@ -182,101 +276,111 @@ func (mc *minecraft) socketListener(s *discordgo.Session, guildID string) {
 	}
 
 	for {
-		if mc.isConnected {
-			_, msg, err := mc.conn.ReadMessage()
+		conn := mc.connection()
+		if conn == nil {
+			return
+		}
 
-			if !mc.isConnected {
-				return
-			}
+		_, msg, err := conn.ReadMessage()
 
-			if err != nil {
-				if websocket.IsCloseError(err) {
-					log.Println("Connection closed gracefully.")
-				} else if websocket.IsUnexpectedCloseError(err) {
-					log.Println("Connection closed unexpectedly.")
-				} else {
-					log.Println("Error reading message:", err)
-				}
-				mc.reconnect(s, guildID)
-				return
+		// the connection was closed or replaced by reconnect
+		if mc.connection() != conn {
+			return
+		}
+
+		if err != nil {
+			if websocket.IsCloseError(err) {
+				log.Println("Connection closed gracefully.")
+			} else if websocket.IsUnexpectedCloseError(err) {
+				log.Println("Connection closed unexpectedly.")
 			} else {
-				content := string(msg)
+				log.Println("Error reading message:", err)
+			}
+			mc.reconnect(s, guildID)
+			return
+		} else {
+			content := string(msg)
 
-				var checkedEmojis []string
+			var checkedEmojis []string
 
-				if strings.HasPrefix(content, "MC:") {
-					guild, _ := s.State.Guild(guildID)
+			if strings.HasPrefix(content, "MC:") {
+				guild, _ := s.State.Guild(guildID)
 
-					// convert emojis
-					for _, emoji := range guild.Emojis {
-						if !slices.Contains(checkedEmojis, strings.ToLower(emoji.Name)) {
-							content = strings.ReplaceAll(content, ":"+strings.ToLower(emoji.Name)+":", emoji.MessageFormat())
+				// convert emojis
+				for _, emoji := range guild.Emojis {
+					if !slices.Contains(checkedEmojis, strings.ToLower(emoji.Name)) {
+						content = strings.ReplaceAll(content, ":"+strings.ToLower(emoji.Name)+":", emoji.MessageFormat())
 
-							checkedEmojis = append(checkedEmojis, strings.ToLower(emoji.Name))
-						}
+						checkedEmojis = append(checkedEmojis, strings.ToLower(emoji.Name))
 					}
+				}
 
-					// convert mentions
-					for _, member := range guild.Members {
-						content = strings.ReplaceAll(content, "@"+member.User.Username, "<@"+member.User.ID+">")
-					}
-					var stickerURLs []string
-
-					// convert stickers
-					for _, sticker := range guild.Stickers {
-						count := strings.Count(content, sticker.Name)
-
-						if count > 0 {
-							if sticker.Available {
-								content = strings.ReplaceAll(content, sticker.Name, "")
-								var extension string
-								switch sticker.FormatType {
-								case discordgo.StickerFormatTypeAPNG:
-									extension = ".gif"
-								case discordgo.StickerFormatTypePNG:
-									extension = ".png"
-								case discordgo.StickerFormatTypeGIF:
-									extension = ".gif"
-								}
-								stickerURLs = append(stickerURLs, fmt.Sprintf("https://media.discordapp.net/stickers/%s"+extension, sticker.ID))
+				// convert mentions
+				for _, member := range guild.Members {
+					content = strings.ReplaceAll(content, "@"+member.User.Username, "<@"+member.User.ID+">")
+				}
+				var stickerURLs []string
+
+				// convert stickers
+				for _, sticker := range guild.Stickers {
+					count := strings.Count(content, sticker.Name)
+
+					if count > 0 {
+						if sticker.Available {
+							content = strings.ReplaceAll(content, sticker.Name, "")
+							var extension string
+							switch sticker.FormatType {
+							case discordgo.StickerFormatTypeAPNG:
+								extension = ".gif"
+							case discordgo.StickerFormatTypePNG:
+								extension = ".png"
+							case discordgo.StickerFormatTypeGIF:
+								extension = ".gif"
 							}
+							stickerURLs = append(stickerURLs, fmt.Sprintf("https://media.discordapp.net/stickers/%s"+extension, sticker.ID))
 						}
 					}
+				}
 
-					// generate sticker files
-					var stickers []*discordgo.File
+				// generate sticker files
+				var stickers []*discordgo.File
 
-					for _, url := range stickerURLs {
-						resp, err := http.Get(url)
-						if err != nil {
-							continue
-						}
-						stickers = append(stickers, &discordgo.File{
-							Name:   url,
-							Reader: resp.Body,
-						})
+				for _, url := range stickerURLs {
+					resp, err := http.Get(url)
+					if err != nil {
+						continue
 					}
+					stickers = append(stickers, &discordgo.File{
+						Name:   url,
+						Reader: resp.Body,
+					})
+				}
 
-					message := []rune(string(content))
-					// remove MC:
-					message = message[3:]
+				message := []rune(string(content))
+				// remove MC:
+				message = message[3:]
 
-					// get name
-					name := mc.findNameFromMinecraft(string(message))
+				// get name
+				name := mc.findNameFromMinecraft(string(message))
 
-					if name != "" {
-						message = message[len(name)+2:]
-					}
+				if name != "" {
+					message = message[len(name)+2:]
+				}
 
-					_, err := s.WebhookExecute(mc.Webhook.ID, mc.Webhook.Token, true, &discordgo.WebhookParams{
-						Content:  string(message),
-						Username: name,
-						Files:    stickers,
-					})
+				webhook := mc.webhook()
+				if webhook == nil {
+					log.Println("Can't send minecraft message, there is no webhook.")
+					continue
+				}
 
-					if err != nil {
-						log.Println("Failed to send webhook message: ", err)
-					}
+				_, err := s.WebhookExecute(webhook.ID, webhook.Token, true, &discordgo.WebhookParams{
+					Content:  string(message),
+					Username: name,
+					Files:    stickers,
+				})
+
+				if err != nil {
+					log.Println("Failed to send webhook message: ", err)
 				}
 			}
 		}
@@ -285,42 +389,49 @@ func (mc *minecraft) socketListener(s *discordgo.Session, guildID string) {
 
 func (mc *minecraft) channelEditorListener(s *discordgo.Session, g *discordgo.GuildCreate) {
 	if g.ID == mc.guildID {
-		for {
-			_, playerCount, players := mc.getPlayerData()
-
-			formattedPlayers := ""
+		// GuildCreate is sent again on reconnects, only start one editor
+		mc.editorOnce.Do(func() {
+			go mc.channelEditor(s)
+		})
+	}
+}
 
-			for i, player := range players {
-				seperator := ", "
-				if i == len(players)-1 {
-					seperator = ""
-				}
-				formattedPlayers += player + seperator
-			}
+func (mc *minecraft) channelEditor(s *discordgo.Session) {
+	for {
+		_, playerCount, players := mc.getPlayerData()
 
-			var playerCountText string
+		formattedPlayers := ""
 
-			switch playerCount {
-			case -1:
-				playerCountText = ""
-			case 0:
-				formattedPlayers = "No players online."
-				playerCountText = fmt.Sprint("-", playerCount)
-			default:
-				playerCountText = fmt.Sprint("-", playerCount)
+		for i, player := range players {
+			seperator := ", "
+			if i == len(players)-1 {
+				seperator = ""
 			}
+			formattedPlayers += player + seperator
+		}
 
-			_, err := s.ChannelEditComplex(mc.ChannelID, &discordgo.ChannelEdit{
-				Name:  "🪓minecraft-chat" + playerCountText,
-				Topic: formattedPlayers,
-			})
+		var playerCountText string
 
-			if err != nil {
-				log.Println("Can't update channel: ", err)
-			}
+		switch playerCount {
+		case -1:
+			playerCountText = ""
+		case 0:
+			formattedPlayers = "No players online."
+			playerCountText = fmt.Sprint("-", playerCount)
+		default:
+			playerCountText = fmt.Sprint("-", playerCount)
+		}
+
+		_, err := s.ChannelEditComplex(mc.channelID(), &discordgo.ChannelEdit{
+			Name:  "🪓minecraft-chat" + playerCountText,
+			Topic: formattedPlayers,
+		})
 
-			time.Sleep(60 * time.Second)
+		if err != nil {
+			log.Println("Can't update channel: ", err)
 		}
+
+		time.Sleep(60 * time.Second)
 	}
 }
 
@@ -404,11 +515,11 @@ func (mc *minecraft) findNameFromMinecraft(message string) string {
 }
 
 func (mc *minecraft) discordMessageListener(s *discordgo.Session, m *discordgo.MessageCreate) {
-	if m.GuildID != mc.guildID || m.ChannelID != mc.ChannelID || m.Author.Bot {
+	if m.GuildID != mc.guildID || m.ChannelID != mc.channelID() || m.Author.Bot {
 		return
 	}
 
-	if mc.isConnected {
+	if mc.connection() != nil {
 		member, err := s.State.Member(m.GuildID, m.Author.ID)
 
 		if err != nil {
@@ -451,7 +562,7 @@ func (mc *minecraft) discordMessageListener(s *discordgo.Session, m *discordgo.M
 
 			}
 			refMessage := fmt.Sprintf("DC:§7Replying to %s \"§o%s %s %s§r§7\":", name, refContent, attachments, stickers)
-			mErr := mc.conn.WriteMessage(websocket.TextMessage, []byte(refMessage))
+			mErr := mc.send(refMessage)
 			if mErr != nil {
 				log.Println("Failed to write referencedMessage to connection: ", mErr)
 			}
@@ -459,7 +570,7 @@ func (mc *minecraft) discordMessageListener(s *discordgo.Session, m *discordgo.M
 
 		message = "DC:§7" + message
 
-		mErr := mc.conn.WriteMessage(websocket.TextMessage, []byte(message))
+		mErr := mc.send(message)
 
 		if mErr != nil {
 			log.Println("Failed to write message to connection: ", mErr)
@@ -468,12 +579,6 @@ func (mc *minecraft) discordMessageListener(s *discordgo.Session, m *discordgo.M
 }
 
 func (mc *minecraft) reconnectCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	data := i.ApplicationCommandData()
-
-	if data.Name != "mcreconnect" {
-		return
-	}
-
 	content := mc.reconnect(s, i.GuildID)
 
 	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -488,9 +593,35 @@ func (mc *minecraft) reconnectCommand(s *discordgo.Session, i *discordgo.Interac
 	}
 }
 
+// connection returns the current websocket connection or nil if the bridge
+// is not connected.
+func (mc *minecraft) connection() *websocket.Conn {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if !mc.isConnected {
+		return nil
+	}
+	return mc.conn
+}
+
+// send writes a text message to the websocket. gorilla/websocket allows only
+// one concurrent writer, so writes are serialized by mu.
+func (mc *minecraft) send(message string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if !mc.isConnected || mc.conn == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	return mc.conn.WriteMessage(websocket.TextMessage, []byte(message))
+}
+
 func (mc *minecraft) reconnect(s *discordgo.Session, guildID string) string {
 	var content string
 
+	mc.mu.Lock()
 	// Close the existing connection if it exists
 	if mc.isConnected && mc.conn != nil {
 		// Send a close message to the server
@@ -502,16 +633,15 @@ func (mc *minecraft) reconnect(s *discordgo.Session, guildID string) string {
 		cErr := mc.conn.Close()
 		if cErr != nil {
 			log.Println("Error closing connection: ", cErr)
-			mc.isConnected = true
 		} else {
 			log.Println("Closed connection.")
 		}
 	}
+	mc.mu.Unlock()
 
 	log.Println("Restarting connection.")
 
-	var err error
-	mc.conn, err = mc.createConnection()
+	conn, err := mc.createConnection()
 
 	if err != nil {
 		content = "Error happened. (the websocket is probably not running)"
@@ -524,6 +654,11 @@ func (mc *minecraft) reconnect(s *discordgo.Session, guildID string) string {
 		log.Println("Successfully restarted the connection.")
 	}
 
+	mc.mu.Lock()
+	mc.conn = conn
+	mc.isConnected = true
+	mc.mu.Unlock()
+
 	go mc.socketListener(s, guildID)
 
 	return content
@@ -1,38 +1,630 @@
 package commands
 
 import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/storage"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+const (
+	reactionRuleBucket = "reactionRules"
+	// ruleIDBucket holds the last rule ID handed out, by bucket/guildID.
+	ruleIDBucket = "ruleIDs"
+	// migrationBucket remembers one time migrations, by name/guildID.
+	migrationBucket = "migrations"
+)
+
+// Kinds of emoji matchers.
+const (
+	matchEmojiID   = "id"      // a custom emoji by its ID
+	matchEmojiName = "name"    // the exact name of an emoji, ignoring case
+	matchRegex     = "regex"   // a case insensitive regular expression
+	matchUnicode   = "unicode" // a unicode emoji
+)
+
+// Actions of reaction rules.
+const (
+	actionRemove = "remove"
+	actionLog    = "log"
+	actionWarn   = "warn"
+)
+
+var snowflakeIDRegex = regexp.MustCompile(`^\d{17,20}$`)
+
+var matchKindChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "custom emoji", Value: matchEmojiID},
+	{Name: "emoji name", Value: matchEmojiName},
+	{Name: "regular expression on the name", Value: matchRegex},
+	{Name: "unicode emoji", Value: matchUnicode},
+}
+
+// ruleScope limits where a rule applies. Empty lists mean everywhere and
+// everyone.
+type ruleScope struct {
+	Channels []string `json:"channels,omitempty"`
+	Roles    []string `json:"roles,omitempty"` // the rule applies to members with one of them
+}
+
+func (scope ruleScope) applies(channelID string, roles []string) bool {
+	if len(scope.Channels) > 0 && !slices.Contains(scope.Channels, channelID) {
+		return false
+	}
+	if len(scope.Roles) > 0 && !slices.ContainsFunc(roles, func(role string) bool {
+		return slices.Contains(scope.Roles, role)
+	}) {
+		return false
+	}
+	return true
+}
+
+func (scope ruleScope) String() string {
+	parts := []string{}
+	if len(scope.Channels) > 0 {
+		parts = append(parts, "in "+formatChannels(scope.Channels))
+	}
+	for _, role := range scope.Roles {
+		parts = append(parts, "for <@&"+role+">")
+	}
+	return strings.Join(parts, " ")
+}
+
+// scopeFromOptions reads the optional channel and role options of a rule
+// command.
+func scopeFromOptions(options map[string]*discordgo.ApplicationCommandInteractionDataOption) ruleScope {
+	var scope ruleScope
+	if option, exists := options["channel"]; exists {
+		scope.Channels = []string{option.Value.(string)}
+	}
+	if option, exists := options["role"]; exists {
+		scope.Roles = []string{option.Value.(string)}
+	}
+	return scope
+}
+
+// emojiMatcher matches emojis by ID, name, regex or as unicode.
+type emojiMatcher struct {
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern"`
+
+	regex *regexp.Regexp
+}
+
+func newEmojiMatcher(kind string, pattern string) (emojiMatcher, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return emojiMatcher{}, errors.New("the pattern is empty")
+	}
+
+	switch kind {
+	case matchEmojiID:
+		// accept the full emoji too
+		if match := customEmojiRegex.FindStringSubmatch(pattern); match != nil {
+			pattern = match[3]
+		}
+		if !snowflakeIDRegex.MatchString(pattern) {
+			return emojiMatcher{}, fmt.Errorf("%q is not a custom emoji", pattern)
+		}
+	case matchEmojiName:
+		if match := customEmojiRegex.FindStringSubmatch(pattern); match != nil {
+			pattern = match[2]
+		}
+		pattern = strings.Trim(pattern, ":")
+	case matchRegex:
+		if len(pattern) > 200 {
+			return emojiMatcher{}, errors.New("the regular expression is too long")
+		}
+	case matchUnicode:
+		if strings.HasPrefix(pattern, "<") {
+			return emojiMatcher{}, fmt.Errorf("%q is a custom emoji, match it by id", pattern)
+		}
+	default:
+		return emojiMatcher{}, fmt.Errorf("unknown kind %q", kind)
+	}
+
+	matcher := emojiMatcher{Kind: kind, Pattern: pattern}
+	if err := matcher.compile(); err != nil {
+		return emojiMatcher{}, err
+	}
+	return matcher, nil
+}
+
+func (matcher *emojiMatcher) compile() error {
+	if matcher.Kind != matchRegex {
+		return nil
+	}
+
+	regex, err := regexp.Compile("(?i)" + matcher.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid regular expression: %w", err)
+	}
+	matcher.regex = regex
+	return nil
+}
+
+func (matcher emojiMatcher) matches(emoji discordgo.Emoji) bool {
+	switch matcher.Kind {
+	case matchEmojiID:
+		return emoji.ID == matcher.Pattern
+	case matchEmojiName:
+		return strings.EqualFold(emoji.Name, matcher.Pattern)
+	case matchRegex:
+		return matcher.regex.MatchString(emoji.Name)
+	case matchUnicode:
+		return emoji.ID == "" && emoji.Name == matcher.Pattern
+	}
+	return false
+}
+
+func (matcher emojiMatcher) String() string {
+	switch matcher.Kind {
+	case matchEmojiID:
+		return "emoji " + matcher.Pattern
+	case matchEmojiName:
+		return ":" + matcher.Pattern + ":"
+	case matchRegex:
+		return "`" + matcher.Pattern + "`"
+	}
+	return matcher.Pattern
+}
+
+// compareRuleIDs orders rule IDs by their number, so "10" follows "9".
+func compareRuleIDs(a string, b string) int {
+	x, _ := strconv.Atoi(a)
+	y, _ := strconv.Atoi(b)
+	return cmp.Compare(x, y)
+}
+
+// sortRules orders the rules of a guild by ID, the order they are checked in.
+func sortRules(rules []*reactionRule) {
+	slices.SortFunc(rules, func(a, b *reactionRule) int {
+		return compareRuleIDs(a.ID, b.ID)
+	})
+}
+
+// nextRuleID hands out the next ID of a guild's rules in bucket. IDs are
+// never used twice, so a new rule is always checked after the older ones.
+// ids are the existing rules, which may be older than the stored counter.
+func nextRuleID(tx storage.Tx, bucket string, guildID string, ids []string) (string, error) {
+	key := storage.Key(bucket, guildID)
+	last := 0
+	if err := storage.GetJSON(tx, ruleIDBucket, key, &last); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return "", err
+	}
+	for _, id := range ids {
+		if number, err := strconv.Atoi(id); err == nil {
+			last = max(last, number)
+		}
+	}
+
+	last++
+	return strconv.Itoa(last), storage.PutJSON(tx, ruleIDBucket, key, last)
+}
+
+// reactionRule moderates reactions with a matching emoji.
+type reactionRule struct {
+	ID    string       `json:"id"`
+	Match emojiMatcher `json:"match"`
+	ruleScope
+	Actions []string `json:"actions"`
+}
+
+func (rule *reactionRule) String() string {
+	text := fmt.Sprintf("**#%s** %s: %s", rule.ID, rule.Match, strings.Join(rule.Actions, ", "))
+	if scope := rule.ruleScope.String(); scope != "" {
+		text += " " + scope
+	}
+	return text
+}
+
+// reactions moderates reactions, adds reactions to messages through rules
+// set per guild and keeps the starboards.
 type reactions struct {
-	namesToRemove []string
+	mu          sync.RWMutex // guards rules, autoRules, autoReacted and starboards
+	store       storage.Store
+	settings    *settings
+	rules       map[string][]*reactionRule      // by guild
+	autoRules   map[string][]*autoReactionRule  // by guild
+	autoReacted map[string]*autoReactionHistory // by guildID/rule/channelID
+	starboards  map[string]*starboard           // by guild
+	starring    sync.Mutex                      // serializes posting to starboards
 }
 
-func newReactions() reactions {
-	return reactions{
-		namesToRemove: []string{"windows", "XP", "bluescreen"},
+func newReactions(store storage.Store, settings *settings) *reactions {
+	reactions := &reactions{
+		store:       store,
+		settings:    settings,
+		rules:       map[string][]*reactionRule{},
+		autoRules:   map[string][]*autoReactionRule{},
+		autoReacted: map[string]*autoReactionHistory{},
+		starboards:  map[string]*starboard{},
 	}
+
+	reactions.read()
+	reactions.readAutoReactions()
+	reactions.readStarboards()
+	return reactions
 }
 
-func (reactions *reactions) register(bot *discordgo.Session) {
+func (reactions *reactions) register(bot *discordgo.Session, r *router.Router) {
 	// add handlers
-	bot.AddHandler(reactions.removeListener)
+	bot.AddHandler(reactions.moderationListener)
+	bot.AddHandler(reactions.migrateBannedReactions)
+
+	manageGuild := int64(discordgo.PermissionManageServer)
+
+	// add commands
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:                     "reactionrule",
+			Description:              "Manages which reactions are moderated.",
+			DefaultMemberPermissions: &manageGuild,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "add",
+					Description: "Adds a rule for reactions.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "match",
+							Description: "How the emoji is matched",
+							Required:    true,
+							Choices:     matchKindChoices,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "pattern",
+							Description: "The emoji, its name or a regular expression",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "remove",
+							Description: "Remove the reaction, true by default",
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "log",
+							Description: "Log the reaction in the mod log channel",
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "warn",
+							Description: "Warn the user in a direct message",
+						},
+						{
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							Name:         "channel",
+							Description:  "Only apply the rule in this channel",
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Name:        "role",
+							Description: "Only apply the rule to members with this role",
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove",
+					Description: "Removes a rule.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "rule",
+							Description:  "The rule",
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "Shows the reaction rules of this server.",
+				},
+			},
+		},
+		Subcommands: map[string]router.Handler{
+			"add":    reactions.addCommand,
+			"remove": reactions.removeCommand,
+			"list":   reactions.listCommand,
+		},
+		Autocomplete: reactions.autocompleteRule,
+	})
+
+	reactions.registerAutoReactions(bot, r)
+	reactions.registerStarboard(bot, r)
 }
 
-func (reactions *reactions) removeListener(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
-	emojiName := r.Emoji.Name;
+func (reactions *reactions) read() {
+	err := reactions.store.View(func(tx storage.Tx) error {
+		return tx.ForEach(reactionRuleBucket, "", func(key string, value []byte) error {
+			guildID, _, _ := strings.Cut(key, "/")
+
+			rule := &reactionRule{}
+			if err := json.Unmarshal(value, rule); err != nil {
+				return err
+			}
+			if err := rule.Match.compile(); err != nil {
+				log.Printf("Skipping reaction rule %s: %s", key, err)
+				return nil
+			}
+
+			reactions.rules[guildID] = append(reactions.rules[guildID], rule)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println("Failed to read reaction rules: ", err)
+	}
+
+	for _, rules := range reactions.rules {
+		sortRules(rules)
+	}
+}
+
+// guildRules returns the rules of a guild.
+func (reactions *reactions) guildRules(guildID string) []*reactionRule {
+	reactions.mu.RLock()
+	defer reactions.mu.RUnlock()
+
+	return slices.Clone(reactions.rules[guildID])
+}
 
-	for _, name := range reactions.namesToRemove {
-		if strings.Contains(strings.ToLower(emojiName), name) {
-			err := s.MessageReactionRemove(r.ChannelID, r.MessageID, r.Emoji.APIName(), r.UserID)
+// addRule gives rule the next ID and stores it. prepare runs in the same
+// transaction first, unless it is nil.
+func (reactions *reactions) addRule(guildID string, rule *reactionRule, prepare func(tx storage.Tx) error) error {
+	reactions.mu.Lock()
+	defer reactions.mu.Unlock()
+
+	ids := []string{}
+	for _, existing := range reactions.rules[guildID] {
+		ids = append(ids, existing.ID)
+	}
+
+	err := reactions.store.Update(func(tx storage.Tx) error {
+		if prepare != nil {
+			if err := prepare(tx); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if rule.ID, err = nextRuleID(tx, reactionRuleBucket, guildID, ids); err != nil {
+			return err
+		}
+		return storage.PutJSON(tx, reactionRuleBucket, storage.Key(guildID, rule.ID), rule)
+	})
+	if err != nil {
+		return err
+	}
+
+	reactions.rules[guildID] = append(reactions.rules[guildID], rule)
+	sortRules(reactions.rules[guildID])
+	return nil
+}
+
+// errMigrated skips a migration that already ran.
+var errMigrated = errors.New("already migrated")
+
+// migrateBannedReactions turns the bannedReactions setting of a guild into
+// a reaction rule once. The setting matched parts of emoji names.
+func (reactions *reactions) migrateBannedReactions(s *discordgo.Session, g *discordgo.GuildCreate) {
+	names := reactions.settings.Guild(g.ID).BannedReactions
+	if len(names) == 0 {
+		return
+	}
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, regexp.QuoteMeta(name))
+	}
+
+	matcher, err := newEmojiMatcher(matchRegex, strings.Join(parts, "|"))
+	if err != nil {
+		log.Println("Failed to migrate banned reactions: ", err)
+		return
+	}
+
+	// the marker is only written together with the rule
+	marker := storage.Key("bannedreactions", g.ID)
+	err = reactions.addRule(g.ID, &reactionRule{Match: matcher, Actions: []string{actionRemove}}, func(tx storage.Tx) error {
+		if _, err := tx.Get(migrationBucket, marker); err == nil {
+			return errMigrated
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		return tx.Put(migrationBucket, marker, []byte("1"))
+	})
+	if errors.Is(err, errMigrated) {
+		return
+	}
+	if err != nil {
+		log.Println("Failed to migrate banned reactions: ", err)
+		return
+	}
+	log.Printf("Moved the banned reactions of guild %s into a reaction rule.", g.ID)
+}
+
+func (reactions *reactions) moderationListener(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if r.GuildID == "" || (s.State.User != nil && r.UserID == s.State.User.ID) {
+		return
+	}
+
+	var roles []string
+	if r.Member != nil {
+		roles = r.Member.Roles
+	}
+
+	// the first matching rule wins
+	for _, rule := range reactions.guildRules(r.GuildID) {
+		if rule.Match.matches(r.Emoji) && rule.applies(r.ChannelID, roles) {
+			reactions.enforce(s, r, rule)
+			return
+		}
+	}
+}
+
+// enforce runs the actions of rule on a reaction.
+func (reactions *reactions) enforce(s *discordgo.Session, r *discordgo.MessageReactionAdd, rule *reactionRule) {
+	emoji := r.Emoji.MessageFormat()
+	link := fmt.Sprintf("https://discord.com/channels/%s/%s/%s", r.GuildID, r.ChannelID, r.MessageID)
+
+	for _, action := range rule.Actions {
+		switch action {
+		case actionRemove:
+			if err := s.MessageReactionRemove(r.ChannelID, r.MessageID, r.Emoji.APIName(), r.UserID); err != nil {
+				log.Println("Failed to remove reaction: ", err)
+			}
+
+		case actionLog:
+			channelID := reactions.settings.Guild(r.GuildID).ModLogChannel
+			if channelID == "" {
+				log.Printf("Reaction rule %s of guild %s logs, but there is no mod log channel.", rule.ID, r.GuildID)
+				continue
+			}
+
+			_, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+				Content:         fmt.Sprintf("<@%s> reacted with %s on %s (rule #%s: %s)", r.UserID, emoji, link, rule.ID, strings.Join(rule.Actions, ", ")),
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			})
+			if err != nil {
+				log.Println("Failed to log reaction: ", err)
+			}
+
+		case actionWarn:
+			channel, err := s.UserChannelCreate(r.UserID)
 			if err != nil {
-				log.Println(err)
-			} else {
-				log.Println("Removed: ", name)
+				log.Println("Failed to create DM channel: ", err)
+				continue
 			}
+
+			_, err = s.ChannelMessageSend(channel.ID, fmt.Sprintf("The reaction %s is not allowed there: %s", emoji, link))
+			if err != nil {
+				log.Println("Failed to warn user: ", err)
+			}
+		}
+	}
+}
+
+func (reactions *reactions) addCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+
+	matcher, err := newEmojiMatcher(byName["match"].StringValue(), byName["pattern"].StringValue())
+	if err != nil {
+		respond(s, i, fmt.Sprintf("Could not add the rule: %s", err), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	var actions []string
+	for _, action := range []string{actionRemove, actionLog, actionWarn} {
+		option, exists := byName[action]
+		// only remove is on by default
+		if (!exists && action == actionRemove) || (exists && option.BoolValue()) {
+			actions = append(actions, action)
 		}
 	}
-}
\ No newline at end of file
+	if len(actions) == 0 {
+		respond(s, i, "The rule needs at least one action.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	rule := &reactionRule{Match: matcher, ruleScope: scopeFromOptions(byName), Actions: actions}
+	if err := reactions.addRule(i.GuildID, rule, nil); err != nil {
+		log.Println("Failed to save reaction rule: ", err)
+		respond(s, i, "Could not save the rule.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	response := "Added the rule " + rule.String()
+	if slices.Contains(actions, actionLog) && reactions.settings.Guild(i.GuildID).ModLogChannel == "" {
+		response += "\nSet a channel with `/config set modlogchannel` to see the logs."
+	}
+	respond(s, i, response, discordgo.MessageFlagsEphemeral)
+}
+
+func (reactions *reactions) removeCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	id := strings.TrimPrefix(router.Options(options)["rule"].StringValue(), "#")
+
+	reactions.mu.Lock()
+	defer reactions.mu.Unlock()
+
+	if !slices.ContainsFunc(reactions.rules[i.GuildID], func(rule *reactionRule) bool {
+		return rule.ID == id
+	}) {
+		respond(s, i, "There is no such rule.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	err := reactions.store.Update(func(tx storage.Tx) error {
+		return tx.Delete(reactionRuleBucket, storage.Key(i.GuildID, id))
+	})
+	if err != nil {
+		log.Println("Failed to remove reaction rule: ", err)
+		respond(s, i, "Could not remove the rule.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	reactions.rules[i.GuildID] = slices.DeleteFunc(reactions.rules[i.GuildID], func(rule *reactionRule) bool {
+		return rule.ID == id
+	})
+
+	respond(s, i, fmt.Sprintf("Removed the rule #%s.", id), discordgo.MessageFlagsEphemeral)
+}
+
+func (reactions *reactions) listCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	rules := reactions.guildRules(i.GuildID)
+	if len(rules) == 0 {
+		respond(s, i, "There are no reaction rules. Add one with /reactionrule add.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	lines := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		lines = append(lines, rule.String())
+	}
+
+	respond(s, i, truncate(strings.Join(lines, "\n"), 2000), discordgo.MessageFlagsEphemeral)
+}
+
+// autocompleteRule suggests the rules of the guild.
+func (reactions *reactions) autocompleteRule(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	focused := router.Focused(i.ApplicationCommandData().Options)
+	input := ""
+	if focused != nil {
+		input = strings.ToLower(focused.StringValue())
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, rule := range reactions.guildRules(i.GuildID) {
+		name := fmt.Sprintf("#%s %s: %s", rule.ID, rule.Match, strings.Join(rule.Actions, ", "))
+		if strings.Contains(strings.ToLower(name), input) && len(choices) < 25 {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: truncate(name, 100), Value: rule.ID})
+		}
+	}
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send autocomplete response: ", rErr)
+	}
+}
@@ -0,0 +1,273 @@
+package commands
+
+import (
+	"GoBot/internal/storage"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const testStarboard = "300000000000000009"
+
+func TestReactionsConcurrently(t *testing.T) {
+	bot := newTestBot(t)
+	reactions := newReactions(bot.store, newSettings(bot.store, bot.config))
+	reactions.register(bot.session, bot.router)
+
+	admin := bot.member(testAdminID)
+	setup := []*discordgo.InteractionCreate{
+		command(admin, "starboard", subcommand("set", channelOption("channel", testStarboard), intOption("threshold", 3))),
+		command(admin, "autoreact", subcommand("add", stringOption("trigger", triggerKeyword), stringOption("pattern", "hi"), stringOption("emojis", "👋"), intOption("limit", 5))),
+	}
+	for _, i := range setup {
+		bot.handle(i)
+		bot.api.response(t, i)
+	}
+
+	starred := &discordgo.Message{
+		ID:        snowflake(time.Now()),
+		ChannelID: testChannel,
+		Author:    &discordgo.User{ID: testUserID(0), Username: "user0"},
+		Content:   "star me",
+		Reactions: []*discordgo.MessageReactions{{Emoji: &discordgo.Emoji{Name: "⭐"}, Count: 5}},
+	}
+	bot.api.setMessage(starred)
+
+	reaction := func(userID string, emoji string) *discordgo.MessageReaction {
+		return &discordgo.MessageReaction{
+			UserID:    userID,
+			MessageID: starred.ID,
+			ChannelID: testChannel,
+			GuildID:   testGuildID,
+			Emoji:     discordgo.Emoji{Name: emoji},
+		}
+	}
+
+	concurrently(testUsers, func(n int) {
+		member := bot.member(testUserID(n))
+		for range 10 {
+			requests := []*discordgo.InteractionCreate{
+				command(admin, "reactionrule", subcommand("add", stringOption("match", matchUnicode), stringOption("pattern", fmt.Sprint(n, "️⃣")), boolOption("log", true))),
+				command(admin, "reactionrule", subcommand("list")),
+				autocomplete(admin, "reactionrule", subcommand("remove", focused(stringOption("rule", "")))),
+				command(admin, "autoreact", subcommand("add", stringOption("trigger", triggerKeyword), stringOption("pattern", fmt.Sprint("word", n)), stringOption("emojis", "🎉"))),
+				command(admin, "autoreact", subcommand("list")),
+				command(admin, "starboard", subcommand("show")),
+			}
+			for _, i := range requests {
+				bot.handle(i)
+				bot.api.response(t, i)
+			}
+
+			add := &discordgo.MessageReactionAdd{MessageReaction: reaction(member.User.ID, "⭐"), Member: member}
+			reactions.moderationListener(bot.session, add)
+			reactions.starAddListener(bot.session, add)
+			reactions.starRemoveListener(bot.session, &discordgo.MessageReactionRemove{MessageReaction: reaction(member.User.ID, "⭐")})
+
+			reactions.autoReactionListener(bot.session, &discordgo.MessageCreate{Message: &discordgo.Message{
+				ID:        snowflake(time.Now()),
+				ChannelID: testChannel,
+				GuildID:   testGuildID,
+				Author:    member.User,
+				Member:    member,
+				Content:   "hi there",
+			}})
+		}
+	})
+
+	// however often it is starred, a message is posted once
+	if posts := bot.api.sentTo(testStarboard); len(posts) != 1 {
+		t.Errorf("the starboard got %d posts, want 1", len(posts))
+	}
+	// the keyword rule reacts at most 5 times an hour
+	if reacted := bot.api.count("PUT channels/"); reacted != 5 {
+		t.Errorf("auto reactions were added %d times, want 5", reacted)
+	}
+
+	if rules := len(reactions.guildRules(testGuildID)); rules != testUsers*10 {
+		t.Errorf("the guild has %d reaction rules, want %d", rules, testUsers*10)
+	}
+	if rules := len(reactions.guildAutoRules(testGuildID)); rules != testUsers*10+1 {
+		t.Errorf("the guild has %d auto reaction rules, want %d", rules, testUsers*10+1)
+	}
+
+	// every rule got its own ID
+	for _, rules := range [][]string{ruleIDs(reactions.guildRules(testGuildID)), autoRuleIDs(reactions.guildAutoRules(testGuildID))} {
+		slices.SortFunc(rules, func(a, b string) int {
+			x, _ := strconv.Atoi(a)
+			y, _ := strconv.Atoi(b)
+			return x - y
+		})
+		for index, id := range rules {
+			if id != strconv.Itoa(index+1) {
+				t.Errorf("rule IDs are %v, want 1 to %d", rules, len(rules))
+				break
+			}
+		}
+	}
+}
+
+func ruleIDs(rules []*reactionRule) []string {
+	ids := []string{}
+	for _, rule := range rules {
+		ids = append(ids, rule.ID)
+	}
+	return ids
+}
+
+func autoRuleIDs(rules []*autoReactionRule) []string {
+	ids := []string{}
+	for _, rule := range rules {
+		ids = append(ids, rule.ID)
+	}
+	return ids
+}
+
+func TestMigrateBannedReactions(t *testing.T) {
+	bot := newTestBot(t)
+	bot.setConfig("defaults:\n  bannedReactions: [windows, xp]\n")
+
+	reactions := newReactions(bot.store, newSettings(bot.store, bot.config))
+	guild := &discordgo.GuildCreate{Guild: &discordgo.Guild{ID: testGuildID}}
+	reactions.migrateBannedReactions(bot.session, guild)
+	reactions.migrateBannedReactions(bot.session, guild)
+
+	// the second run finds the marker written with the rule
+	reloaded := newReactions(bot.store, newSettings(bot.store, bot.config))
+	reloaded.migrateBannedReactions(bot.session, guild)
+	if rules := reloaded.guildRules(testGuildID); len(rules) != 1 || rules[0].Match.Pattern != "windows|xp" {
+		t.Errorf("rules after the migration = %v, want one for windows|xp", ruleIDs(rules))
+	}
+	err := bot.store.View(func(tx storage.Tx) error {
+		_, err := tx.Get(migrationBucket, storage.Key("bannedreactions", testGuildID))
+		return err
+	})
+	if err != nil {
+		t.Error("the migration marker is missing: ", err)
+	}
+}
+
+func TestRuleOrder(t *testing.T) {
+	bot := newTestBot(t)
+	reactions := newReactions(bot.store, newSettings(bot.store, bot.config))
+
+	want := []string{}
+	for n := 1; n <= 12; n++ {
+		matcher, err := newEmojiMatcher(matchUnicode, fmt.Sprint(n))
+		if err != nil {
+			t.Fatal("failed to create matcher: ", err)
+		}
+		if err := reactions.addRule(testGuildID, &reactionRule{Match: matcher, Actions: []string{actionRemove}}, nil); err != nil {
+			t.Fatal("failed to add rule: ", err)
+		}
+		want = append(want, strconv.Itoa(n))
+	}
+
+	// rules are read back in the order of their IDs, not of their keys
+	reloaded := newReactions(bot.store, newSettings(bot.store, bot.config))
+	if ids := ruleIDs(reloaded.guildRules(testGuildID)); !slices.Equal(ids, want) {
+		t.Errorf("rule IDs after a restart are %v, want %v", ids, want)
+	}
+
+	// a new rule is checked after the older ones, even if an older ID is
+	// free again
+	reloaded.register(bot.session, bot.router)
+	admin := bot.member(testAdminID)
+	for _, i := range []*discordgo.InteractionCreate{
+		command(admin, "reactionrule", subcommand("remove", stringOption("rule", "1"))),
+		command(admin, "reactionrule", subcommand("remove", stringOption("rule", "#12"))),
+		command(admin, "reactionrule", subcommand("add", stringOption("match", matchUnicode), stringOption("pattern", "🆕"))),
+	} {
+		bot.handle(i)
+		bot.api.response(t, i)
+	}
+	want = append(want[1:11], "13")
+	if ids := ruleIDs(reloaded.guildRules(testGuildID)); !slices.Equal(ids, want) {
+		t.Errorf("rule IDs after removing #1 and #12 and adding a rule are %v, want %v", ids, want)
+	}
+	if ids := ruleIDs(newReactions(bot.store, newSettings(bot.store, bot.config)).guildRules(testGuildID)); !slices.Equal(ids, want) {
+		t.Errorf("rule IDs after another restart are %v, want %v", ids, want)
+	}
+}
+
+func TestReactionRules(t *testing.T) {
+	bot := newTestBot(t)
+	const modLog = "300000000000000010"
+	bot.setConfig(fmt.Sprintf("guilds:\n  %q:\n    modLogChannel: %q\n", testGuildID, modLog))
+	reactions := newReactions(bot.store, newSettings(bot.store, bot.config))
+	reactions.register(bot.session, bot.router)
+	admin := bot.member(testAdminID)
+
+	rules := []*discordgo.InteractionCreate{
+		// members with role A may use the clown
+		command(admin, "reactionrule", subcommand("add", stringOption("match", matchUnicode), stringOption("pattern", "🤡"),
+			roleOption("role", testRoleA), boolOption("remove", false), boolOption("log", true))),
+		command(admin, "reactionrule", subcommand("add", stringOption("match", matchUnicode), stringOption("pattern", "🤡"), boolOption("warn", true))),
+		command(admin, "reactionrule", subcommand("add", stringOption("match", matchEmojiID), stringOption("pattern", "<:kok:1324540733222289490>"))),
+		command(admin, "reactionrule", subcommand("add", stringOption("match", matchEmojiName), stringOption("pattern", ":Windows:"), boolOption("log", true))),
+		command(admin, "reactionrule", subcommand("add", stringOption("match", matchRegex), stringOption("pattern", "^x+p$"), channelOption("channel", testChannel))),
+	}
+	for _, i := range rules {
+		bot.handle(i)
+		if content := bot.api.content(t, i); !strings.HasPrefix(content, "Added the rule") {
+			t.Fatalf("/reactionrule add = %q", content)
+		}
+	}
+
+	for _, invalid := range []*discordgo.InteractionCreate{
+		command(admin, "reactionrule", subcommand("add", stringOption("match", matchEmojiID), stringOption("pattern", "🤡"))),
+		command(admin, "reactionrule", subcommand("add", stringOption("match", matchUnicode), stringOption("pattern", "<:kok:1324540733222289490>"))),
+		command(admin, "reactionrule", subcommand("add", stringOption("match", matchRegex), stringOption("pattern", "("))),
+		command(admin, "reactionrule", subcommand("add", stringOption("match", matchUnicode), stringOption("pattern", "🤡"), boolOption("remove", false))),
+	} {
+		bot.handle(invalid)
+		if content := bot.api.content(t, invalid); strings.HasPrefix(content, "Added") {
+			t.Errorf("%v was added: %q", invalid.ApplicationCommandData().Options, content)
+		}
+	}
+
+	tests := []struct {
+		emoji   discordgo.Emoji
+		roles   []string
+		channel string
+		// what the rule did
+		removed, logged, warned bool
+	}{
+		{discordgo.Emoji{Name: "🤡"}, []string{testRoleA}, testChannel, false, true, false},
+		{discordgo.Emoji{Name: "🤡"}, nil, testChannel, true, false, true},
+		{discordgo.Emoji{Name: "kok", ID: "1324540733222289490"}, nil, testChannel, true, false, false},
+		{discordgo.Emoji{Name: "kok", ID: "1324540733222289491"}, nil, testChannel, false, false, false},
+		{discordgo.Emoji{Name: "windows", ID: "1324540733222289492"}, nil, testChannel, true, true, false},
+		{discordgo.Emoji{Name: "XXP", ID: "1324540733222289493"}, nil, testChannel, true, false, false},
+		{discordgo.Emoji{Name: "XXP", ID: "1324540733222289493"}, nil, testStarboard, false, false, false},
+		{discordgo.Emoji{Name: "👍"}, nil, testChannel, false, false, false},
+	}
+	for _, test := range tests {
+		removed := bot.api.count("DELETE channels/")
+		logged := len(bot.api.sentTo(modLog))
+		warned := bot.api.count("POST users/@me/channels")
+
+		member := bot.member(testUserID(0))
+		member.Roles = test.roles
+		reactions.moderationListener(bot.session, &discordgo.MessageReactionAdd{
+			MessageReaction: &discordgo.MessageReaction{
+				UserID:    member.User.ID,
+				MessageID: snowflake(time.Now()),
+				ChannelID: test.channel,
+				GuildID:   testGuildID,
+				Emoji:     test.emoji,
+			},
+			Member: member,
+		})
+
+		got := [3]bool{bot.api.count("DELETE channels/") > removed, len(bot.api.sentTo(modLog)) > logged, bot.api.count("POST users/@me/channels") > warned}
+		if want := [3]bool{test.removed, test.logged, test.warned}; got != want {
+			t.Errorf("reaction %s with roles %v in %s removed, logged, warned = %v, want %v", test.emoji.Name, test.roles, test.channel, got, want)
+		}
+	}
+}
@@ -1,40 +1,55 @@
 package commands
 
 import (
+	"GoBot/internal/bot/router"
 	"GoBot/internal/config"
+	"GoBot/internal/scheduler"
+	"GoBot/internal/storage"
 	"log"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-func Register(bot *discordgo.Session, config *config.Config) func() {
-	minecraft := newMinecraft(config.SocketPassword, config.ServerIp)
-	minecraft.register(bot)
+func Register(bot *discordgo.Session, r *router.Router, config *config.Manager, store storage.Store) func() {
+	settings := newSettings(store, config)
+	settings.register(r)
+
+	access := newAccess(store, config, r)
+	access.register(bot, r)
+
+	minecraft := newMinecraft(config, settings)
+	minecraft.register(bot, r)
 	minecraft.createWebhook(bot)
-	tom := newTom(minecraft.ChannelID, config.GeminiApiKey)
-	tom.register(bot)
+	settings.onChange(minecraft.onSettingsChange)
+	config.OnReload(minecraft.onReload)
+	timezones := newTimezones(store, settings)
+	timezones.register(r)
+
+	roleMenus := newRoleMenus(store, settings)
+	roleMenus.register(bot, r)
+
+	tom := newTom(store, config, settings, timezones, roleMenus)
+	tom.register(bot, r)
 
-	colorSystem := newColorSystem()
-	colorSystem.register(bot)
+	colorSystem := newColorSystem(store)
+	colorSystem.register(bot, r)
 
-	kokCounter := newKokCounter()
-	kokCounter.register(bot)
+	counter := newCounter(store, settings)
+	counter.register(bot, r)
 
-	stock := newStock()
-	stock.register(bot)
+	stock := newStock(config)
+	stock.register(r)
 
-	timers := newTimers(&tom)
-	timers.register(bot)
+	timers := newTimers(store, timezones, tom, scheduler.SystemClock)
+	timers.register(bot, r)
 
-	reactions := newReactions()
-	reactions.register(bot)
+	reactions := newReactions(store, settings)
+	reactions.register(bot, r)
 
 	// cleanup
 	return func() {
-		wErr := bot.WebhookDelete(minecraft.Webhook.ID)
-		if wErr != nil {
-			log.Println("Failed to delete webhook: ", wErr)
-		}
+		minecraft.deleteWebhook(bot)
+		timers.close()
 		log.Println("Cleaned up successfully.")
 	}
 }
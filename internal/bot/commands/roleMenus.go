@@ -0,0 +1,844 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const roleMenuBucket = "roleMenus"
+
+// Kinds of role menus.
+const (
+	menuReactions = "reactions"
+	menuButtons   = "buttons"
+	menuSelect    = "select"
+)
+
+// Modes of role menus.
+const (
+	menuSingle = "single" // members have at most one role of the menu
+	menuMulti  = "multi"
+)
+
+// maxMenuChoices is the most choices a menu can have. Messages can only have
+// 20 different reactions.
+var maxMenuChoices = map[string]int{
+	menuReactions: 20,
+	menuButtons:   25,
+	menuSelect:    25,
+}
+
+// roleMenu is a message members pick roles from.
+type roleMenu struct {
+	GuildID     string       `json:"guildId"`
+	ChannelID   string       `json:"channelId"`
+	MessageID   string       `json:"messageId"`
+	Kind        string       `json:"kind"`
+	Mode        string       `json:"mode"`
+	Title       string       `json:"title"`
+	Description string       `json:"description,omitempty"`
+	Pronouns    bool         `json:"pronouns,omitempty"` // the AI refers to members by these roles
+	Choices     []roleChoice `json:"choices"`
+}
+
+type roleChoice struct {
+	RoleID string `json:"role"`
+	Label  string `json:"label"`
+	Emoji  string `json:"emoji,omitempty"` // in the format of the API
+}
+
+func (menu *roleMenu) choice(roleID string) (roleChoice, bool) {
+	index := slices.IndexFunc(menu.Choices, func(choice roleChoice) bool {
+		return choice.RoleID == roleID
+	})
+	if index == -1 {
+		return roleChoice{}, false
+	}
+	return menu.Choices[index], true
+}
+
+// roleMenus lets members pick roles from menus admins posted.
+type roleMenus struct {
+	mu       sync.RWMutex // guards menus
+	store    storage.Store
+	settings *settings
+	menus    map[string]*roleMenu // by message
+}
+
+func newRoleMenus(store storage.Store, settings *settings) *roleMenus {
+	roleMenus := &roleMenus{
+		store:    store,
+		settings: settings,
+		menus:    map[string]*roleMenu{},
+	}
+
+	roleMenus.read()
+	return roleMenus
+}
+
+func (roleMenus *roleMenus) register(bot *discordgo.Session, r *router.Router) {
+	// add handlers
+	bot.AddHandler(roleMenus.reactionAddListener)
+	bot.AddHandler(roleMenus.reactionRemoveListener)
+	bot.AddHandler(roleMenus.deletionListener)
+
+	manageRoles := int64(discordgo.PermissionManageRoles)
+
+	menuOption := &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         "menu",
+		Description:  "The menu",
+		Required:     true,
+		Autocomplete: true,
+	}
+	roleOption := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionRole,
+		Name:        "role",
+		Description: "The role",
+		Required:    true,
+	}
+
+	// add commands
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:                     "rolemenu",
+			Description:              "Manages menus members pick roles from.",
+			DefaultMemberPermissions: &manageRoles,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "create",
+					Description: "Posts a new menu in this channel.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "kind",
+							Description: "How roles are picked",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "reactions", Value: menuReactions},
+								{Name: "buttons", Value: menuButtons},
+								{Name: "select menu", Value: menuSelect},
+							},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "mode",
+							Description: "How many roles members can pick",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "one", Value: menuSingle},
+								{Name: "any", Value: menuMulti},
+							},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "title",
+							Description: "The title of the menu",
+							Required:    true,
+							MaxLength:   256,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "description",
+							Description: "Text shown above the roles",
+							MaxLength:   1000,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "pronouns",
+							Description: "The roles are pronouns, which the AI uses",
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "add",
+					Description: "Adds a role to a menu.",
+					Options: []*discordgo.ApplicationCommandOption{
+						menuOption,
+						roleOption,
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "emoji",
+							Description: "The emoji of the role, needed for reaction menus",
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "label",
+							Description: "The text shown for the role, its name by default",
+							MaxLength:   80,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove",
+					Description: "Removes a role from a menu.",
+					Options:     []*discordgo.ApplicationCommandOption{menuOption, roleOption},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "delete",
+					Description: "Deletes a menu and its message.",
+					Options:     []*discordgo.ApplicationCommandOption{menuOption},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "Shows the menus of this server.",
+				},
+			},
+		},
+		Subcommands: map[string]router.Handler{
+			"create": roleMenus.createCommand,
+			"add":    roleMenus.addCommand,
+			"remove": roleMenus.removeCommand,
+			"delete": roleMenus.deleteCommand,
+			"list":   roleMenus.listCommand,
+		},
+		Autocomplete: roleMenus.autocompleteMenu,
+	})
+	// menus are for every member, not only those who may use /rolemenu
+	r.AddComponent("rolemenu", "", roleMenus.component)
+}
+
+func (roleMenus *roleMenus) read() {
+	err := roleMenus.store.View(func(tx storage.Tx) error {
+		return tx.ForEach(roleMenuBucket, "", func(key string, value []byte) error {
+			menu := &roleMenu{}
+			if err := json.Unmarshal(value, menu); err != nil {
+				return err
+			}
+			roleMenus.menus[menu.MessageID] = menu
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println("Failed to read role menus: ", err)
+	}
+}
+
+// menu returns a copy of the menu of a message.
+func (roleMenus *roleMenus) menu(messageID string) (roleMenu, bool) {
+	roleMenus.mu.RLock()
+	defer roleMenus.mu.RUnlock()
+
+	menu, exists := roleMenus.menus[messageID]
+	if !exists {
+		return roleMenu{}, false
+	}
+
+	copied := *menu
+	copied.Choices = slices.Clone(menu.Choices)
+	return copied, true
+}
+
+// guildMenus returns copies of the menus of a guild.
+func (roleMenus *roleMenus) guildMenus(guildID string) []roleMenu {
+	roleMenus.mu.RLock()
+	defer roleMenus.mu.RUnlock()
+
+	var menus []roleMenu
+	for _, menu := range roleMenus.menus {
+		if menu.GuildID == guildID {
+			copied := *menu
+			copied.Choices = slices.Clone(menu.Choices)
+			menus = append(menus, copied)
+		}
+	}
+
+	slices.SortFunc(menus, func(a, b roleMenu) int {
+		return strings.Compare(a.MessageID, b.MessageID)
+	})
+	return menus
+}
+
+// save stores a menu, or deletes it if deleted is set.
+func (roleMenus *roleMenus) save(menu roleMenu, deleted bool) error {
+	key := storage.Key(menu.GuildID, menu.MessageID)
+
+	roleMenus.mu.Lock()
+	defer roleMenus.mu.Unlock()
+
+	err := roleMenus.store.Update(func(tx storage.Tx) error {
+		if deleted {
+			return tx.Delete(roleMenuBucket, key)
+		}
+		return storage.PutJSON(tx, roleMenuBucket, key, menu)
+	})
+	if err != nil {
+		return err
+	}
+
+	if deleted {
+		delete(roleMenus.menus, menu.MessageID)
+	} else {
+		roleMenus.menus[menu.MessageID] = &menu
+	}
+	return nil
+}
+
+// updateMenu changes the menu of a message in a guild and stores it. The menu
+// is copied, so readers never see a half changed menu. The errors are meant
+// for the user.
+func (roleMenus *roleMenus) updateMenu(guildID string, messageID string, change func(menu *roleMenu) error) (roleMenu, error) {
+	roleMenus.mu.Lock()
+	defer roleMenus.mu.Unlock()
+
+	menu, exists := roleMenus.menus[messageID]
+	if !exists || menu.GuildID != guildID {
+		return roleMenu{}, errors.New("There is no such menu.")
+	}
+
+	changed := *menu
+	changed.Choices = slices.Clone(menu.Choices)
+	if err := change(&changed); err != nil {
+		return roleMenu{}, err
+	}
+
+	err := roleMenus.store.Update(func(tx storage.Tx) error {
+		return storage.PutJSON(tx, roleMenuBucket, storage.Key(guildID, messageID), changed)
+	})
+	if err != nil {
+		log.Println("Failed to save role menu: ", err)
+		return roleMenu{}, errors.New("Could not save the menu.")
+	}
+
+	roleMenus.menus[messageID] = &changed
+	return changed, nil
+}
+
+// pronounRoles returns the roles of the pronoun menus of a guild. Guilds
+// without one use the pronounRoles setting.
+func (roleMenus *roleMenus) pronounRoles(guildID string) []string {
+	var roles []string
+	hasMenu := false
+	for _, menu := range roleMenus.guildMenus(guildID) {
+		if !menu.Pronouns {
+			continue
+		}
+		hasMenu = true
+		for _, choice := range menu.Choices {
+			roles = append(roles, choice.RoleID)
+		}
+	}
+
+	if !hasMenu {
+		return roleMenus.settings.Guild(guildID).PronounRoles
+	}
+	return roles
+}
+
+// render builds the message of a menu.
+func (menu *roleMenu) render() (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	lines := []string{}
+	if menu.Description != "" {
+		lines = append(lines, menu.Description, "")
+	}
+	for _, choice := range menu.Choices {
+		line := "<@&" + choice.RoleID + ">"
+		if choice.Emoji != "" {
+			line = formatAPIEmoji(choice.Emoji) + " " + line
+		}
+		lines = append(lines, line)
+	}
+	if len(menu.Choices) == 0 {
+		lines = append(lines, "There are no roles yet.")
+	}
+
+	footer := "Pick any roles."
+	if menu.Mode == menuSingle {
+		footer = "Pick one role."
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       menu.Title,
+		Description: strings.Join(lines, "\n"),
+		Color:       convertHexColorToInt("F4B8E4"),
+		Footer:      &discordgo.MessageEmbedFooter{Text: footer},
+	}
+
+	components := []discordgo.MessageComponent{}
+	switch {
+	case len(menu.Choices) == 0:
+
+	case menu.Kind == menuButtons:
+		var row discordgo.ActionsRow
+		for _, choice := range menu.Choices {
+			if len(row.Components) == 5 {
+				components = append(components, row)
+				row = discordgo.ActionsRow{}
+			}
+			row.Components = append(row.Components, discordgo.Button{
+				Label:    choice.Label,
+				Style:    discordgo.SecondaryButton,
+				Emoji:    componentEmoji(choice.Emoji),
+				CustomID: router.CustomID("rolemenu", menu.MessageID, choice.RoleID),
+			})
+		}
+		components = append(components, row)
+
+	case menu.Kind == menuSelect:
+		options := make([]discordgo.SelectMenuOption, 0, len(menu.Choices))
+		for _, choice := range menu.Choices {
+			options = append(options, discordgo.SelectMenuOption{
+				Label: choice.Label,
+				Value: choice.RoleID,
+				Emoji: componentEmoji(choice.Emoji),
+			})
+		}
+
+		minValues := 0
+		maxValues := len(options)
+		if menu.Mode == menuSingle {
+			maxValues = 1
+		}
+
+		components = append(components, discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID:    router.CustomID("rolemenu", menu.MessageID),
+					Placeholder: "Pick your roles",
+					MinValues:   &minValues,
+					MaxValues:   maxValues,
+					Options:     options,
+				},
+			},
+		})
+	}
+
+	return embed, components
+}
+
+// componentEmoji turns an emoji in the format of the API into the emoji of a
+// button or select option.
+func componentEmoji(emoji string) *discordgo.ComponentEmoji {
+	if emoji == "" {
+		return nil
+	}
+	if name, id, custom := strings.Cut(emoji, ":"); custom {
+		return &discordgo.ComponentEmoji{Name: name, ID: id}
+	}
+	return &discordgo.ComponentEmoji{Name: emoji}
+}
+
+// emojiIs reports whether a reaction emoji is the emoji in the format of the
+// API. Custom emojis are compared by ID since they can be renamed.
+func emojiIs(reaction discordgo.Emoji, emoji string) bool {
+	if _, id, custom := strings.Cut(emoji, ":"); custom {
+		return reaction.ID == id
+	}
+	return reaction.ID == "" && reaction.Name == emoji
+}
+
+// update edits the message of a menu to show its current choices.
+func (roleMenus *roleMenus) update(s *discordgo.Session, menu roleMenu) error {
+	embed, components := menu.render()
+	_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         menu.MessageID,
+		Channel:    menu.ChannelID,
+		Embeds:     &[]*discordgo.MessageEmbed{embed},
+		Components: &components,
+	})
+	return err
+}
+
+// setRoles gives a member the picked roles of a menu and takes the other
+// roles of the menu. It returns the roles that were added and removed.
+func (roleMenus *roleMenus) setRoles(s *discordgo.Session, menu roleMenu, member *discordgo.Member, picked []string) (added []string, removed []string, err error) {
+	for _, choice := range menu.Choices {
+		has := slices.Contains(member.Roles, choice.RoleID)
+		wants := slices.Contains(picked, choice.RoleID)
+
+		switch {
+		case wants && !has:
+			if err := s.GuildMemberRoleAdd(menu.GuildID, member.User.ID, choice.RoleID); err != nil {
+				return added, removed, err
+			}
+			added = append(added, choice.RoleID)
+		case !wants && has:
+			if err := s.GuildMemberRoleRemove(menu.GuildID, member.User.ID, choice.RoleID); err != nil {
+				return added, removed, err
+			}
+			removed = append(removed, choice.RoleID)
+		}
+	}
+	return added, removed, nil
+}
+
+// component handles the buttons and select menus of menus.
+func (roleMenus *roleMenus) component(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.MessageComponentData()
+	_, args := router.ParseCustomID(data.CustomID)
+	if len(args) == 0 || i.Member == nil {
+		return
+	}
+
+	menu, exists := roleMenus.menu(args[0])
+	if !exists {
+		respond(s, i, "This menu doesn't exist anymore.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	var picked []string
+	if data.ComponentType == discordgo.SelectMenuComponent {
+		picked = data.Values
+	} else if len(args) == 2 {
+		// buttons toggle their role
+		for _, choice := range menu.Choices {
+			has := slices.Contains(i.Member.Roles, choice.RoleID)
+			if choice.RoleID == args[1] {
+				has = !has
+			} else if menu.Mode == menuSingle {
+				has = false
+			}
+			if has {
+				picked = append(picked, choice.RoleID)
+			}
+		}
+	}
+
+	added, removed, err := roleMenus.setRoles(s, menu, i.Member, picked)
+	if err != nil {
+		log.Println("Failed to change menu roles: ", err)
+		respond(s, i, "Could not change your roles. The role of the bot might be too low.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	respond(s, i, describeRoleChange(added, removed), discordgo.MessageFlagsEphemeral)
+}
+
+func describeRoleChange(added []string, removed []string) string {
+	format := func(roles []string) string {
+		mentions := make([]string, 0, len(roles))
+		for _, role := range roles {
+			mentions = append(mentions, "<@&"+role+">")
+		}
+		return strings.Join(mentions, ", ")
+	}
+
+	parts := []string{}
+	if len(added) > 0 {
+		parts = append(parts, "You got "+format(added)+".")
+	}
+	if len(removed) > 0 {
+		parts = append(parts, "You no longer have "+format(removed)+".")
+	}
+	if len(parts) == 0 {
+		return "Your roles didn't change."
+	}
+	return strings.Join(parts, " ")
+}
+
+func (roleMenus *roleMenus) reactionAddListener(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	menu, exists := roleMenus.menu(r.MessageID)
+	if !exists || menu.Kind != menuReactions || r.Member == nil || r.Member.User == nil || r.Member.User.Bot {
+		return
+	}
+
+	index := slices.IndexFunc(menu.Choices, func(choice roleChoice) bool {
+		return emojiIs(r.Emoji, choice.Emoji)
+	})
+	if index == -1 {
+		return
+	}
+	choice := menu.Choices[index]
+
+	if err := s.GuildMemberRoleAdd(menu.GuildID, r.UserID, choice.RoleID); err != nil {
+		log.Println("Failed to add menu role: ", err)
+		return
+	}
+	if menu.Mode != menuSingle {
+		return
+	}
+
+	// taking the other reactions takes their roles in reactionRemoveListener
+	for _, other := range menu.Choices {
+		if other.RoleID == choice.RoleID {
+			continue
+		}
+		if slices.Contains(r.Member.Roles, other.RoleID) {
+			if err := s.GuildMemberRoleRemove(menu.GuildID, r.UserID, other.RoleID); err != nil {
+				log.Println("Failed to remove menu role: ", err)
+			}
+		}
+		if err := s.MessageReactionRemove(menu.ChannelID, menu.MessageID, other.Emoji, r.UserID); err != nil {
+			log.Println("Failed to remove menu reaction: ", err)
+		}
+	}
+}
+
+func (roleMenus *roleMenus) reactionRemoveListener(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+	menu, exists := roleMenus.menu(r.MessageID)
+	if !exists || menu.Kind != menuReactions || (s.State.User != nil && r.UserID == s.State.User.ID) {
+		return
+	}
+
+	for _, choice := range menu.Choices {
+		if !emojiIs(r.Emoji, choice.Emoji) {
+			continue
+		}
+		if err := s.GuildMemberRoleRemove(menu.GuildID, r.UserID, choice.RoleID); err != nil {
+			log.Println("Failed to remove menu role: ", err)
+		}
+	}
+}
+
+// deletionListener forgets menus whose message was deleted.
+func (roleMenus *roleMenus) deletionListener(s *discordgo.Session, m *discordgo.MessageDelete) {
+	menu, exists := roleMenus.menu(m.ID)
+	if !exists {
+		return
+	}
+
+	if err := roleMenus.save(menu, true); err != nil {
+		log.Println("Failed to delete role menu: ", err)
+	}
+}
+
+func (roleMenus *roleMenus) createCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+
+	menu := roleMenu{
+		GuildID:   i.GuildID,
+		ChannelID: i.ChannelID,
+		Kind:      byName["kind"].StringValue(),
+		Mode:      byName["mode"].StringValue(),
+		Title:     byName["title"].StringValue(),
+	}
+	if option, exists := byName["description"]; exists {
+		menu.Description = option.StringValue()
+	}
+	if option, exists := byName["pronouns"]; exists {
+		menu.Pronouns = option.BoolValue()
+	}
+
+	// pronoun menus start with the roles of the pronounRoles setting that
+	// the member may hand out
+	var skipped []string
+	if menu.Pronouns && menu.Kind != menuReactions {
+		for _, roleID := range roleMenus.settings.Guild(i.GuildID).PronounRoles {
+			role, err := s.State.Role(i.GuildID, roleID)
+			if err != nil {
+				continue
+			}
+			if role.ID == i.GuildID || role.Managed || checkRoleHierarchy(s, i, role) != nil {
+				skipped = append(skipped, "<@&"+role.ID+">")
+				continue
+			}
+			menu.Choices = append(menu.Choices, roleChoice{RoleID: role.ID, Label: role.Name})
+		}
+		menu.Choices = menu.Choices[:min(len(menu.Choices), maxMenuChoices[menu.Kind])]
+	}
+
+	embed, components := menu.render()
+	message, err := s.ChannelMessageSendComplex(i.ChannelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: components,
+	})
+	if err != nil {
+		log.Println("Failed to send role menu: ", err)
+		respond(s, i, "Could not post the menu in this channel.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	menu.MessageID = message.ID
+	if err := roleMenus.save(menu, false); err != nil {
+		log.Println("Failed to save role menu: ", err)
+		respond(s, i, "Could not save the menu.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	// the custom IDs contain the message ID, which is only known now
+	if len(menu.Choices) > 0 {
+		if err := roleMenus.update(s, menu); err != nil {
+			log.Println("Failed to update role menu: ", err)
+		}
+	}
+
+	response := fmt.Sprintf("Posted the menu %s. Add roles with /rolemenu add.", menu.Title)
+	if len(skipped) > 0 {
+		response += fmt.Sprintf(" Left out %s, you can only hand out roles below your highest role.", strings.Join(skipped, ", "))
+	}
+	respond(s, i, response, discordgo.MessageFlagsEphemeral)
+}
+
+func (roleMenus *roleMenus) addCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+
+	role := byName["role"].RoleValue(s, i.GuildID)
+	if role == nil || role.ID == i.GuildID || role.Managed {
+		respond(s, i, "That role can't be picked from a menu.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+	if err := checkRoleHierarchy(s, i, role); err != nil {
+		respond(s, i, err.Error(), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	choice := roleChoice{RoleID: role.ID, Label: role.Name}
+	if option, exists := byName["label"]; exists {
+		choice.Label = option.StringValue()
+	}
+	if option, exists := byName["emoji"]; exists {
+		emojis, err := parseEmojis(option.StringValue())
+		if err != nil || len(emojis) != 1 {
+			respond(s, i, fmt.Sprintf("%q is not a single emoji.", option.StringValue()), discordgo.MessageFlagsEphemeral)
+			return
+		}
+		choice.Emoji = emojis[0]
+	}
+
+	menu, err := roleMenus.updateMenu(i.GuildID, byName["menu"].StringValue(), func(menu *roleMenu) error {
+		if _, exists := menu.choice(role.ID); exists {
+			return errors.New("The menu already has that role.")
+		}
+		if len(menu.Choices) >= maxMenuChoices[menu.Kind] {
+			return fmt.Errorf("A menu with %s can have up to %d roles.", menu.Kind, maxMenuChoices[menu.Kind])
+		}
+
+		if menu.Kind == menuReactions {
+			if choice.Emoji == "" {
+				return errors.New("Roles of reaction menus need an emoji.")
+			}
+			if slices.ContainsFunc(menu.Choices, func(other roleChoice) bool { return other.Emoji == choice.Emoji }) {
+				return errors.New("Another role of the menu already has that emoji.")
+			}
+			if err := s.MessageReactionAdd(menu.ChannelID, menu.MessageID, choice.Emoji); err != nil {
+				log.Println("Failed to add menu reaction: ", err)
+				return errors.New("Could not react with that emoji. Is it from this server?")
+			}
+		}
+
+		menu.Choices = append(menu.Choices, choice)
+		return nil
+	})
+	if err != nil {
+		respond(s, i, err.Error(), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	roleMenus.finishChange(s, i, menu, fmt.Sprintf("Added <@&%s> to %s.", role.ID, menu.Title))
+}
+
+func (roleMenus *roleMenus) removeCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+
+	roleID := byName["role"].Value.(string)
+	var removed roleChoice
+	menu, err := roleMenus.updateMenu(i.GuildID, byName["menu"].StringValue(), func(menu *roleMenu) error {
+		choice, exists := menu.choice(roleID)
+		if !exists {
+			return errors.New("The menu doesn't have that role.")
+		}
+		removed = choice
+
+		menu.Choices = slices.DeleteFunc(menu.Choices, func(choice roleChoice) bool {
+			return choice.RoleID == roleID
+		})
+		return nil
+	})
+	if err != nil {
+		respond(s, i, err.Error(), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	if menu.Kind == menuReactions {
+		if err := s.MessageReactionsRemoveEmoji(menu.ChannelID, menu.MessageID, removed.Emoji); err != nil {
+			log.Println("Failed to remove menu reactions: ", err)
+		}
+	}
+
+	roleMenus.finishChange(s, i, menu, fmt.Sprintf("Removed <@&%s> from %s. Members keep the role.", roleID, menu.Title))
+}
+
+// finishChange updates the message of a changed menu.
+func (roleMenus *roleMenus) finishChange(s *discordgo.Session, i *discordgo.InteractionCreate, menu roleMenu, response string) {
+	if err := roleMenus.update(s, menu); err != nil {
+		log.Println("Failed to update role menu: ", err)
+		respond(s, i, response+" The message could not be updated.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	respond(s, i, response, discordgo.MessageFlagsEphemeral)
+}
+
+func (roleMenus *roleMenus) deleteCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+
+	menu, exists := roleMenus.menu(router.Options(options)["menu"].StringValue())
+	if !exists || menu.GuildID != i.GuildID {
+		respond(s, i, "There is no such menu.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	if err := roleMenus.save(menu, true); err != nil {
+		log.Println("Failed to delete role menu: ", err)
+		respond(s, i, "Could not delete the menu.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	if err := s.ChannelMessageDelete(menu.ChannelID, menu.MessageID); err != nil && !isNotFound(err) {
+		log.Println("Failed to delete role menu message: ", err)
+	}
+
+	respond(s, i, fmt.Sprintf("Deleted the menu %s.", menu.Title), discordgo.MessageFlagsEphemeral)
+}
+
+func (roleMenus *roleMenus) listCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	menus := roleMenus.guildMenus(i.GuildID)
+	if len(menus) == 0 {
+		respond(s, i, "There are no role menus. Post one with /rolemenu create.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	lines := make([]string, 0, len(menus))
+	for _, menu := range menus {
+		line := fmt.Sprintf("**%s** (%s, %s, %d roles) https://discord.com/channels/%s/%s/%s", menu.Title, menu.Kind, menu.Mode, len(menu.Choices), menu.GuildID, menu.ChannelID, menu.MessageID)
+		if menu.Pronouns {
+			line += " pronouns"
+		}
+		lines = append(lines, line)
+	}
+
+	respond(s, i, truncate(strings.Join(lines, "\n"), 2000), discordgo.MessageFlagsEphemeral)
+}
+
+// autocompleteMenu suggests the menus of the guild.
+func (roleMenus *roleMenus) autocompleteMenu(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	focused := router.Focused(i.ApplicationCommandData().Options)
+	input := ""
+	if focused != nil {
+		input = strings.ToLower(focused.StringValue())
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, menu := range roleMenus.guildMenus(i.GuildID) {
+		if strings.Contains(strings.ToLower(menu.Title), input) && len(choices) < 25 {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: truncate(menu.Title, 100), Value: menu.MessageID})
+		}
+	}
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send autocomplete response: ", rErr)
+	}
+}
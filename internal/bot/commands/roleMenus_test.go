@@ -0,0 +1,278 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// createMenu posts a menu and returns its message ID.
+func createMenu(t *testing.T, bot *testBot, kind string, mode string, title string) string {
+	t.Helper()
+
+	create := bot.handle(command(bot.member(testAdminID), "rolemenu", subcommand("create",
+		stringOption("kind", kind), stringOption("mode", mode), stringOption("title", title))))
+	if content := bot.api.content(t, create); !strings.HasPrefix(content, "Posted the menu") {
+		t.Fatalf("/rolemenu create = %q", content)
+	}
+
+	sent := bot.api.sentTo(testChannel)
+	return sent[len(sent)-1].ID
+}
+
+func TestRoleMenusConcurrently(t *testing.T) {
+	bot := newTestBot(t)
+	roleMenus := newRoleMenus(bot.store, newSettings(bot.store, bot.config))
+	roleMenus.register(bot.session, bot.router)
+
+	admin := bot.member(testAdminID)
+	buttons := createMenu(t, bot, menuButtons, menuSingle, "colors")
+	selects := createMenu(t, bot, menuSelect, menuMulti, "pings")
+	// discordgo waits between reaction requests, so the reaction menu allows
+	// any roles and never takes reactions away
+	reactionMenu := createMenu(t, bot, menuReactions, menuMulti, "games")
+
+	emojis := map[string]string{testRoleA: "🅰️", testRoleB: "🅱️", testRoleC: "🆑"}
+	for _, roleID := range []string{testRoleA, testRoleB, testRoleC} {
+		for _, menu := range []string{buttons, selects, reactionMenu} {
+			add := bot.handle(command(admin, "rolemenu", subcommand("add",
+				stringOption("menu", menu), roleOption("role", roleID), stringOption("emoji", emojis[roleID]))))
+			if content := bot.api.content(t, add); !strings.HasPrefix(content, "Added") {
+				t.Fatalf("/rolemenu add = %q", content)
+			}
+		}
+	}
+
+	clicks := bot.api.count("PUT guilds/")
+	concurrently(testUsers, func(n int) {
+		member := bot.member(testUserID(n))
+		for index := range 10 {
+			roleID := []string{testRoleA, testRoleB, testRoleC}[index%3]
+			requests := []*discordgo.InteractionCreate{
+				button(member, router.CustomID("rolemenu", buttons, roleID)),
+				selection(member, router.CustomID("rolemenu", selects), testRoleA, roleID),
+				command(admin, "rolemenu", subcommand("list")),
+				autocomplete(admin, "rolemenu", subcommand("add", focused(stringOption("menu", "o")))),
+				// admins change another menu at the same time
+				command(admin, "rolemenu", subcommand("create", stringOption("kind", menuButtons), stringOption("mode", menuMulti), stringOption("title", fmt.Sprint("menu", n)))),
+			}
+			for _, i := range requests {
+				bot.handle(i)
+				bot.api.response(t, i)
+			}
+
+			reaction := &discordgo.MessageReaction{
+				UserID:    member.User.ID,
+				MessageID: reactionMenu,
+				ChannelID: testChannel,
+				GuildID:   testGuildID,
+				Emoji:     discordgo.Emoji{Name: emojis[roleID]},
+			}
+			roleMenus.reactionAddListener(bot.session, &discordgo.MessageReactionAdd{MessageReaction: reaction, Member: member})
+			roleMenus.reactionRemoveListener(bot.session, &discordgo.MessageReactionRemove{MessageReaction: reaction})
+			roleMenus.pronounRoles(testGuildID)
+		}
+	})
+
+	// members without roles get the role of the button, the roles picked
+	// from the select menu and the role of the reaction
+	want := testUsers * 10 * 3
+	for index := range 10 {
+		if []string{testRoleA, testRoleB, testRoleC}[index%3] != testRoleA {
+			want += testUsers
+		}
+	}
+	if added := bot.api.count("PUT guilds/") - clicks; added != want {
+		t.Errorf("roles were added %d times, want %d", added, want)
+	}
+
+	if menus := roleMenus.guildMenus(testGuildID); len(menus) != 3+testUsers*10 {
+		t.Errorf("the guild has %d menus, want %d", len(menus), 3+testUsers*10)
+	}
+}
+
+func TestRoleMenuHierarchy(t *testing.T) {
+	bot := newTestBot(t)
+	newRoleMenus(bot.store, newSettings(bot.store, bot.config)).register(bot.session, bot.router)
+	menu := createMenu(t, bot, menuButtons, menuMulti, "roles")
+
+	mod := bot.member(testUserID(0))
+	mod.Roles = []string{testModRole}
+	mod.Permissions = discordgo.PermissionManageRoles
+	owner := bot.member(testOwnerID)
+
+	tests := []struct {
+		member *discordgo.Member
+		roleID string
+		want   string
+	}{
+		{mod, testRoleA, "Added"},
+		{mod, testModRole, "You can only hand out roles below your highest role."},
+		{mod, testAdminRole, "You can only hand out roles below your highest role."},
+		{owner, testAdminRole, "Added"},
+	}
+	for _, test := range tests {
+		add := bot.handle(command(test.member, "rolemenu", subcommand("add", stringOption("menu", menu), roleOption("role", test.roleID))))
+		if content := bot.api.content(t, add); !strings.HasPrefix(content, test.want) {
+			t.Errorf("/rolemenu add %s by %s = %q, want %q", test.roleID, test.member.User.ID, content, test.want)
+		}
+	}
+}
+
+func TestRoleMenuChangesConcurrently(t *testing.T) {
+	bot := newTestBot(t)
+	roleMenus := newRoleMenus(bot.store, newSettings(bot.store, bot.config))
+	roleMenus.register(bot.session, bot.router)
+	admin := bot.member(testAdminID)
+	menu := createMenu(t, bot, menuReactions, menuMulti, "roles")
+	// the reaction is added between reading and saving the menu
+	bot.api.before = func(method string, path string) {
+		if method == http.MethodPut && strings.Contains(path, "/reactions/") {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	roleID := func(n int) string {
+		return fmt.Sprintf("4000000000000000%02d", n)
+	}
+	for n := range testUsers {
+		bot.session.State.RoleAdd(testGuildID, &discordgo.Role{ID: roleID(n), Name: fmt.Sprint("role", n), Position: 1})
+	}
+
+	// every admin adds a role and the odd ones take it away again, none of
+	// the changes may get lost
+	concurrently(testUsers, func(n int) {
+		requests := []*discordgo.InteractionCreate{
+			command(admin, "rolemenu", subcommand("add", stringOption("menu", menu), roleOption("role", roleID(n)), stringOption("emoji", fmt.Sprint(n, "️⃣")))),
+		}
+		if n%2 == 1 {
+			requests = append(requests, command(admin, "rolemenu", subcommand("remove", stringOption("menu", menu), roleOption("role", roleID(n)))))
+		}
+		for _, i := range requests {
+			bot.handle(i)
+			if content := bot.api.content(t, i); !strings.HasPrefix(content, "Added") && !strings.HasPrefix(content, "Removed") {
+				t.Errorf("changing the menu = %q", content)
+			}
+		}
+	})
+
+	want := []string{}
+	for n := 0; n < testUsers; n += 2 {
+		want = append(want, roleID(n))
+	}
+	reloaded := newRoleMenus(bot.store, newSettings(bot.store, bot.config))
+	for _, menuOf := range []func(messageID string) (roleMenu, bool){roleMenus.menu, reloaded.menu} {
+		found, _ := menuOf(menu)
+		got := []string{}
+		for _, choice := range found.Choices {
+			got = append(got, choice.RoleID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("roles of the menu = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRoleMenus(t *testing.T) {
+	bot := newTestBot(t)
+	roleMenus := newRoleMenus(bot.store, newSettings(bot.store, bot.config))
+	roleMenus.register(bot.session, bot.router)
+	admin := bot.member(testAdminID)
+
+	buttons := createMenu(t, bot, menuButtons, menuSingle, "colors")
+	reactionMenu := createMenu(t, bot, menuReactions, menuSingle, "games")
+
+	tests := []struct {
+		menu, roleID, emoji string
+		want                string
+	}{
+		{buttons, testRoleA, "", "Added"},
+		{buttons, testRoleB, "🅱️", "Added"},
+		{buttons, testRoleA, "", "The menu already has that role."},
+		{buttons, testGuildID, "", "That role can't be picked from a menu."},
+		{buttons, testRoleC, "a b", `"a b" is not a single emoji.`},
+		{reactionMenu, testRoleA, "", "Roles of reaction menus need an emoji."},
+		{reactionMenu, testRoleA, "🅰️", "Added"},
+		{reactionMenu, testRoleB, "🅰️", "Another role of the menu already has that emoji."},
+		{reactionMenu, testRoleB, "🅱️", "Added"},
+		{"400000000000000099", testRoleA, "", "There is no such menu."},
+	}
+	for _, test := range tests {
+		options := []*dataOption{stringOption("menu", test.menu), roleOption("role", test.roleID)}
+		if test.emoji != "" {
+			options = append(options, stringOption("emoji", test.emoji))
+		}
+		add := bot.handle(command(admin, "rolemenu", subcommand("add", options...)))
+		if content := bot.api.content(t, add); !strings.HasPrefix(content, test.want) {
+			t.Errorf("/rolemenu add %s %s to %s = %q, want %q", test.roleID, test.emoji, test.menu, content, test.want)
+		}
+	}
+
+	// a single choice button swaps the roles of the menu
+	member := bot.member(testUserID(0))
+	member.Roles = []string{testRoleA, testRoleC}
+	click := bot.handle(button(member, router.CustomID("rolemenu", buttons, testRoleB)))
+	if content := bot.api.content(t, click); !strings.Contains(content, "<@&"+testRoleB+">") || !strings.Contains(content, "<@&"+testRoleA+">") {
+		t.Errorf("clicking another role of a single choice menu = %q", content)
+	}
+	roles := "guilds/" + testGuildID + "/members/" + member.User.ID + "/roles/"
+	if bot.api.count("PUT "+roles+testRoleB) != 1 || bot.api.count("DELETE "+roles+testRoleA) != 1 || bot.api.count("DELETE "+roles+testRoleC) != 0 {
+		t.Error("the button didn't swap A for B and leave C alone")
+	}
+
+	// so does a reaction, which takes the other reaction away as well
+	member.Roles = []string{testRoleA}
+	roleMenus.reactionAddListener(bot.session, &discordgo.MessageReactionAdd{
+		MessageReaction: &discordgo.MessageReaction{UserID: member.User.ID, MessageID: reactionMenu, ChannelID: testChannel, GuildID: testGuildID, Emoji: discordgo.Emoji{Name: "🅱️"}},
+		Member:          member,
+	})
+	if bot.api.count("PUT "+roles+testRoleB) != 2 || bot.api.count("DELETE "+roles+testRoleA) != 2 {
+		t.Error("the reaction didn't swap A for B")
+	}
+
+	remove := bot.handle(command(admin, "rolemenu", subcommand("remove", stringOption("menu", buttons), roleOption("role", testRoleA))))
+	if content := bot.api.content(t, remove); !strings.HasPrefix(content, "Removed") {
+		t.Errorf("/rolemenu remove = %q", content)
+	}
+	remove = bot.handle(command(admin, "rolemenu", subcommand("remove", stringOption("menu", buttons), roleOption("role", testRoleA))))
+	if content := bot.api.content(t, remove); content != "The menu doesn't have that role." {
+		t.Errorf("/rolemenu remove of a removed role = %q", content)
+	}
+
+	// a deleted message takes its menu with it
+	roleMenus.deletionListener(bot.session, &discordgo.MessageDelete{Message: &discordgo.Message{ID: buttons, ChannelID: testChannel, GuildID: testGuildID}})
+	click = bot.handle(button(member, router.CustomID("rolemenu", buttons, testRoleB)))
+	if content := bot.api.content(t, click); content != "This menu doesn't exist anymore." {
+		t.Errorf("clicking a deleted menu = %q", content)
+	}
+}
+
+func TestPronounMenuHierarchy(t *testing.T) {
+	bot := newTestBot(t)
+	bot.setConfig(fmt.Sprintf("guilds:\n  %q:\n    pronounRoles: [%q, %q]\n", testGuildID, testRoleA, testAdminRole))
+	roleMenus := newRoleMenus(bot.store, newSettings(bot.store, bot.config))
+	roleMenus.register(bot.session, bot.router)
+
+	// the mod can't hand out the admin role through the pronoun roles
+	mod := bot.member(testUserID(0))
+	mod.Roles = []string{testModRole}
+	mod.Permissions = discordgo.PermissionManageRoles
+	create := bot.handle(command(mod, "rolemenu", subcommand("create",
+		stringOption("kind", menuButtons), stringOption("mode", menuSingle), stringOption("title", "pronouns"), boolOption("pronouns", true))))
+	if content := bot.api.content(t, create); !strings.Contains(content, "Left out <@&"+testAdminRole+">") {
+		t.Errorf("/rolemenu create = %q, want the admin role left out", content)
+	}
+
+	sent := bot.api.sentTo(testChannel)
+	menu, _ := roleMenus.menu(sent[len(sent)-1].ID)
+	if len(menu.Choices) != 1 || menu.Choices[0].RoleID != testRoleA {
+		t.Errorf("choices of the pronoun menu = %+v, want only role A", menu.Choices)
+	}
+}
@@ -0,0 +1,494 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/config"
+	"GoBot/internal/storage"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+	"gopkg.in/yaml.v3"
+)
+
+const settingsBucket = "guildSettings"
+
+// settingKeys are the guild settings that can be changed with /config.
+var settingKeys = []string{"bridgechannel", "modlogchannel", "aichannels", "timezone"}
+
+var channelIDRegex = regexp.MustCompile(`\d{17,20}`)
+
+// settings layers the guild settings changed at runtime over the ones of the
+// config file. Every subsystem reads guild settings through it.
+type settings struct {
+	mu        sync.RWMutex
+	store     storage.Store
+	config    *config.Manager
+	overrides map[string]config.GuildConfig
+	listeners []func(s *discordgo.Session, guildID string)
+}
+
+// guildSettingsFile is the format of /config export and import.
+type guildSettingsFile struct {
+	Timezone      string   `yaml:"timezone,omitempty"`
+	BridgeChannel string   `yaml:"bridgeChannel,omitempty"`
+	AIChannels    []string `yaml:"aiChannels"`
+	ModLogChannel string   `yaml:"modLogChannel,omitempty"`
+}
+
+func newSettings(store storage.Store, cfg *config.Manager) *settings {
+	settings := &settings{
+		store:     store,
+		config:    cfg,
+		overrides: map[string]config.GuildConfig{},
+	}
+
+	settings.read()
+	return settings
+}
+
+func (settings *settings) register(r *router.Router) {
+	manageGuild := int64(discordgo.PermissionManageServer)
+
+	keyChoices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, key := range settingKeys {
+		keyChoices = append(keyChoices, &discordgo.ApplicationCommandOptionChoice{Name: key, Value: key})
+	}
+
+	// add commands
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:                     "config",
+			Description:              "View and change the settings of this server.",
+			DefaultMemberPermissions: &manageGuild,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "view",
+					Description: "Shows the current settings.",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set",
+					Description: "Changes a setting.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "key",
+							Description: "The setting to change",
+							Required:    true,
+							Choices:     keyChoices,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "value",
+							Description: "The new value. Separate lists with commas, \"none\" empties a list.",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "reset",
+					Description: "Resets a setting (or all settings) to the value of the config file.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "key",
+							Description: "The setting to reset",
+							Choices:     keyChoices,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "export",
+					Description: "Exports the settings as a YAML file.",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "import",
+					Description: "Imports settings from a YAML file created by /config export.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionAttachment,
+							Name:        "file",
+							Description: "The settings file",
+							Required:    true,
+						},
+					},
+				},
+			},
+		},
+		Subcommands: map[string]router.Handler{
+			"view":   settings.viewCommand,
+			"set":    settings.setCommand,
+			"reset":  settings.resetCommand,
+			"export": settings.exportCommand,
+			"import": settings.importCommand,
+		},
+	})
+}
+
+func (settings *settings) read() {
+	err := settings.store.View(func(tx storage.Tx) error {
+		return tx.ForEach(settingsBucket, "", func(guildID string, value []byte) error {
+			var override config.GuildConfig
+			if err := json.Unmarshal(value, &override); err != nil {
+				return err
+			}
+			// /config can't set AIEnabled, older overrides stored it as false
+			override.AIEnabled = nil
+			settings.overrides[guildID] = override
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println("Failed to read guild settings: ", err)
+	}
+}
+
+// Guild returns the effective settings of a guild.
+func (settings *settings) Guild(guildID string) config.GuildConfig {
+	settings.mu.RLock()
+	defer settings.mu.RUnlock()
+
+	return settings.overrides[guildID].Merge(settings.config.Current().Guild(guildID))
+}
+
+// onChange registers fn to be called after the settings of a guild changed.
+func (settings *settings) onChange(fn func(s *discordgo.Session, guildID string)) {
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+
+	settings.listeners = append(settings.listeners, fn)
+}
+
+// update changes the overrides of a guild. The change is only stored if the
+// resulting settings are valid.
+func (settings *settings) update(s *discordgo.Session, guildID string, change func(override *config.GuildConfig) error) error {
+	settings.mu.Lock()
+
+	override := settings.overrides[guildID]
+	if err := change(&override); err != nil {
+		settings.mu.Unlock()
+		return err
+	}
+
+	if err := override.Merge(settings.config.Current().Guild(guildID)).Validate(); err != nil {
+		settings.mu.Unlock()
+		return err
+	}
+
+	err := settings.store.Update(func(tx storage.Tx) error {
+		return storage.PutJSON(tx, settingsBucket, guildID, override)
+	})
+	if err != nil {
+		settings.mu.Unlock()
+		return err
+	}
+
+	settings.overrides[guildID] = override
+	listeners := settings.listeners
+	settings.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(s, guildID)
+	}
+	return nil
+}
+
+// splitList splits a list given as a command option. "none" is an empty list.
+func splitList(value string) []string {
+	if strings.EqualFold(strings.TrimSpace(value), "none") {
+		return []string{}
+	}
+
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// setSetting parses value and sets key in override.
+func setSetting(override *config.GuildConfig, key string, value string) error {
+	switch key {
+	case "bridgechannel":
+		override.BridgeChannel = channelIDRegex.FindString(value)
+		if override.BridgeChannel == "" {
+			return fmt.Errorf("%q is not a channel", value)
+		}
+	case "aichannels":
+		override.AIChannels = []string{}
+		for _, channel := range splitList(value) {
+			id := channelIDRegex.FindString(channel)
+			if id == "" {
+				return fmt.Errorf("%q is not a channel", channel)
+			}
+			override.AIChannels = append(override.AIChannels, id)
+		}
+	case "modlogchannel":
+		override.ModLogChannel = channelIDRegex.FindString(value)
+		if override.ModLogChannel == "" {
+			return fmt.Errorf("%q is not a channel", value)
+		}
+	case "timezone":
+		if _, err := time.LoadLocation(value); err != nil {
+			return fmt.Errorf("unknown timezone %q", value)
+		}
+		override.Timezone = value
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return nil
+}
+
+// resetSetting removes the override of key.
+func resetSetting(override *config.GuildConfig, key string) {
+	switch key {
+	case "bridgechannel":
+		override.BridgeChannel = ""
+	case "aichannels":
+		override.AIChannels = nil
+	case "modlogchannel":
+		override.ModLogChannel = ""
+	case "timezone":
+		override.Timezone = ""
+	}
+}
+
+func formatChannels(ids []string) string {
+	if len(ids) == 0 {
+		return "all"
+	}
+
+	channels := make([]string, 0, len(ids))
+	for _, id := range ids {
+		channels = append(channels, "<#"+id+">")
+	}
+	return strings.Join(channels, ", ")
+}
+
+// formatSetting returns the value of key in a readable form.
+func formatSetting(guild config.GuildConfig, key string) string {
+	switch key {
+	case "bridgechannel":
+		if guild.BridgeChannel == "" {
+			return "none"
+		}
+		return "<#" + guild.BridgeChannel + ">"
+	case "aichannels":
+		return formatChannels(guild.AIChannels)
+	case "modlogchannel":
+		if guild.ModLogChannel == "" {
+			return "none"
+		}
+		return "<#" + guild.ModLogChannel + ">"
+	case "timezone":
+		return guild.Timezone
+	}
+	return ""
+}
+
+// isSettingOverridden reports whether key was changed with /config.
+func isSettingOverridden(override config.GuildConfig, key string) bool {
+	switch key {
+	case "bridgechannel":
+		return override.BridgeChannel != ""
+	case "aichannels":
+		return override.AIChannels != nil
+	case "modlogchannel":
+		return override.ModLogChannel != ""
+	case "timezone":
+		return override.Timezone != ""
+	}
+	return false
+}
+
+func (settings *settings) viewCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	guild := settings.Guild(i.GuildID)
+
+	settings.mu.RLock()
+	override := settings.overrides[i.GuildID]
+	settings.mu.RUnlock()
+
+	fields := []*discordgo.MessageEmbedField{}
+	for _, key := range settingKeys {
+		source := "config file"
+		if isSettingOverridden(override, key) {
+			source = "changed with /config"
+		}
+
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  key,
+			Value: fmt.Sprintf("%s\n*(%s)*", formatSetting(guild, key), source),
+		})
+	}
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:  "Server settings",
+					Fields: fields,
+					Color:  convertHexColorToInt("F4B8E4"),
+				},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send interaction response: ", rErr)
+	}
+}
+
+func (settings *settings) setCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+	key := byName["key"].StringValue()
+	value := byName["value"].StringValue()
+
+	err := settings.update(s, i.GuildID, func(override *config.GuildConfig) error {
+		return setSetting(override, key, value)
+	})
+	if err != nil {
+		respond(s, i, fmt.Sprintf("Could not change %s: %s", key, err), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	respond(s, i, fmt.Sprintf("Set %s to %s.", key, formatSetting(settings.Guild(i.GuildID), key)), discordgo.MessageFlagsEphemeral)
+}
+
+func (settings *settings) resetCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+
+	key := ""
+	if option, exists := byName["key"]; exists {
+		key = option.StringValue()
+	}
+
+	err := settings.update(s, i.GuildID, func(override *config.GuildConfig) error {
+		if key == "" {
+			*override = config.GuildConfig{}
+		} else {
+			resetSetting(override, key)
+		}
+		return nil
+	})
+	if err != nil {
+		respond(s, i, fmt.Sprintf("Could not reset the settings: %s", err), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	if key == "" {
+		respond(s, i, "Reset all settings to the config file.", discordgo.MessageFlagsEphemeral)
+	} else {
+		respond(s, i, fmt.Sprintf("Reset %s to %s.", key, formatSetting(settings.Guild(i.GuildID), key)), discordgo.MessageFlagsEphemeral)
+	}
+}
+
+func (settings *settings) exportCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	guild := settings.Guild(i.GuildID)
+
+	data, err := yaml.Marshal(guildSettingsFile{
+		Timezone:      guild.Timezone,
+		BridgeChannel: guild.BridgeChannel,
+		AIChannels:    guild.AIChannels,
+		ModLogChannel: guild.ModLogChannel,
+	})
+	if err != nil {
+		log.Println("Failed to marshal settings: ", err)
+		respond(s, i, "Could not export the settings.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "These are the current settings.",
+			Files: []*discordgo.File{
+				{
+					Name:        "settings-" + i.GuildID + ".yaml",
+					ContentType: "application/yaml",
+					Reader:      bytes.NewReader(data),
+				},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send interaction response: ", rErr)
+	}
+}
+
+func (settings *settings) importCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	_, options := router.SubcommandPath(data.Options)
+	attachmentID, _ := router.Options(options)["file"].Value.(string)
+
+	attachment, exists := data.Resolved.Attachments[attachmentID]
+	if !exists {
+		respond(s, i, "Please attach a settings file.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	file, err := downloadAttachment(attachment.URL)
+	if err != nil {
+		log.Println("Failed to download settings file: ", err)
+		respond(s, i, "Could not download the file.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	var imported guildSettingsFile
+	if err := yaml.Unmarshal(file, &imported); err != nil {
+		respond(s, i, fmt.Sprintf("The file is not valid: %s", err), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	err = settings.update(s, i.GuildID, func(override *config.GuildConfig) error {
+		*override = config.GuildConfig{
+			Timezone:      imported.Timezone,
+			BridgeChannel: imported.BridgeChannel,
+			AIChannels:    imported.AIChannels,
+			ModLogChannel: imported.ModLogChannel,
+		}
+		return nil
+	})
+	if err != nil {
+		respond(s, i, fmt.Sprintf("Could not import the settings: %s", err), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	respond(s, i, "Imported the settings.", discordgo.MessageFlagsEphemeral)
+}
+
+// downloadAttachment fetches a small attachment from the discord CDN.
+func downloadAttachment(url string) ([]byte, error) {
+	client := http.Client{Timeout: 10 * time.Second}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Println("Failed to close attachment: ", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
@@ -0,0 +1,173 @@
+package commands
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSettingsConcurrently(t *testing.T) {
+	bot := newTestBot(t)
+	settings := newSettings(bot.store, bot.config)
+	settings.register(bot.router)
+
+	changes := atomic.Int64{}
+	settings.onChange(func(s *discordgo.Session, guildID string) {
+		changes.Add(1)
+	})
+
+	admin := bot.member(testAdminID)
+	channels := []string{"300000000000000001", "300000000000000002", "300000000000000003"}
+	timezones := []string{"Europe/Berlin", "America/New_York", "Asia/Tokyo"}
+
+	concurrently(8, func(n int) {
+		for index := range 10 {
+			requests := []*discordgo.InteractionCreate{
+				command(admin, "config", subcommand("set", stringOption("key", "timezone"), stringOption("value", timezones[(n+index)%3]))),
+				command(admin, "config", subcommand("set", stringOption("key", "aichannels"), stringOption("value", fmt.Sprintf("<#%s> <#%s>", channels[n%3], channels[index%3])))),
+				command(admin, "config", subcommand("set", stringOption("key", "modlogchannel"), stringOption("value", channels[index%3]))),
+				command(admin, "config", subcommand("view")),
+			}
+			if index%4 == 0 {
+				requests = append(requests, command(admin, "config", subcommand("reset", stringOption("key", "modlogchannel"))))
+			}
+
+			for _, i := range requests {
+				bot.handle(i)
+				bot.api.response(t, i)
+			}
+
+			// readers always see a valid combination
+			guild := settings.Guild(testGuildID)
+			if err := guild.Validate(); err != nil {
+				t.Error("invalid settings: ", err)
+			}
+			guild.Location()
+		}
+	})
+
+	if changes.Load() != 8*(10*3+3) {
+		t.Errorf("listeners were called %d times, want %d", changes.Load(), 8*(10*3+3))
+	}
+
+	// the store has what the readers see
+	stored := newSettings(bot.store, bot.config)
+	if got, want := stored.Guild(testGuildID), settings.Guild(testGuildID); got.Timezone != want.Timezone || !slices.Equal(got.AIChannels, want.AIChannels) || got.ModLogChannel != want.ModLogChannel {
+		t.Errorf("stored settings %+v differ from %+v", got, want)
+	}
+}
+
+// configImport is a /config import with a settings file served by server.
+func configImport(member *discordgo.Member, url string) *discordgo.InteractionCreate {
+	i := command(member, "config", subcommand("import", &dataOption{Type: discordgo.ApplicationCommandOptionAttachment, Name: "file", Value: "1"}))
+
+	data := i.ApplicationCommandData()
+	data.Resolved = &discordgo.ApplicationCommandInteractionDataResolved{
+		Attachments: map[string]*discordgo.MessageAttachment{"1": {ID: "1", URL: url}},
+	}
+	i.Data = data
+	return i
+}
+
+func TestConfigCommand(t *testing.T) {
+	bot := newTestBot(t)
+	bot.setConfig("defaults:\n  timezone: Europe/Berlin\n  bridgeChannel: \"300000000000000001\"\n")
+	newAccess(bot.store, bot.config, bot.router).register(bot.session, bot.router)
+	settings := newSettings(bot.store, bot.config)
+	settings.register(bot.router)
+
+	changes := 0
+	settings.onChange(func(s *discordgo.Session, guildID string) {
+		changes++
+	})
+
+	files := map[string]string{
+		"/valid.yaml":   "timezone: Asia/Tokyo\naiChannels: [\"300000000000000002\"]\nmodLogChannel: \"300000000000000003\"\n",
+		"/invalid.yaml": "timezone: Mars/Olympus\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(files[r.URL.Path]))
+	}))
+	defer server.Close()
+
+	admin := bot.member(testAdminID)
+	member := bot.member(testUserID(0))
+
+	steps := []struct {
+		i    *discordgo.InteractionCreate
+		want string
+	}{
+		// only members who may manage the server change settings
+		{command(member, "config", subcommand("set", stringOption("key", "timezone"), stringOption("value", "UTC"))), "You need the Manage Server permission to use this command."},
+		{command(admin, "config", subcommand("set", stringOption("key", "timezone"), stringOption("value", "America/New_York"))), "Set timezone to America/New_York."},
+		{command(admin, "config", subcommand("set", stringOption("key", "timezone"), stringOption("value", "Mars/Olympus"))), `Could not change timezone: unknown timezone "Mars/Olympus"`},
+		{command(admin, "config", subcommand("set", stringOption("key", "bridgechannel"), stringOption("value", "general"))), `Could not change bridgechannel: "general" is not a channel`},
+		{command(admin, "config", subcommand("set", stringOption("key", "aichannels"), stringOption("value", "<#300000000000000002>, <#300000000000000003>"))), "Set aichannels to <#300000000000000002>, <#300000000000000003>."},
+		{command(admin, "config", subcommand("set", stringOption("key", "aichannels"), stringOption("value", "none"))), "Set aichannels to all."},
+		{command(admin, "config", subcommand("set", stringOption("key", "modlogchannel"), stringOption("value", "<#300000000000000004>"))), "Set modlogchannel to <#300000000000000004>."},
+		// a reset goes back to the config file
+		{command(admin, "config", subcommand("reset", stringOption("key", "timezone"))), "Reset timezone to Europe/Berlin."},
+	}
+	for _, step := range steps {
+		if content := bot.api.content(t, bot.handle(step.i)); content != step.want {
+			t.Errorf("%v = %q, want %q", step.i.ApplicationCommandData().Options[0].Options, content, step.want)
+		}
+	}
+
+	guild := settings.Guild(testGuildID)
+	if guild.Timezone != "Europe/Berlin" || guild.BridgeChannel != "300000000000000001" || len(guild.AIChannels) != 0 || guild.AIChannels == nil || guild.ModLogChannel != "300000000000000004" {
+		t.Errorf("settings after /config = %+v", guild)
+	}
+	if changes != 5 {
+		t.Errorf("listeners were called %d times, want 5", changes)
+	}
+
+	// /config view tells the changed settings from the config file
+	view := bot.api.response(t, bot.handle(command(admin, "config", subcommand("view"))))
+	fields := map[string]string{}
+	for _, embed := range view.Data.Embeds {
+		for _, field := range embed.Fields {
+			fields[field.Name] = field.Value
+		}
+	}
+	wantFields := map[string]string{
+		"bridgechannel": "<#300000000000000001>\n*(config file)*",
+		"modlogchannel": "<#300000000000000004>\n*(changed with /config)*",
+		"aichannels":    "all\n*(changed with /config)*",
+		"timezone":      "Europe/Berlin\n*(config file)*",
+	}
+	for key, want := range wantFields {
+		if fields[key] != want {
+			t.Errorf("/config view shows %s as %q, want %q", key, fields[key], want)
+		}
+	}
+
+	// an import replaces every setting, an invalid one changes nothing
+	if content := bot.api.content(t, bot.handle(configImport(admin, server.URL+"/valid.yaml"))); content != "Imported the settings." {
+		t.Errorf("/config import = %q", content)
+	}
+	if content := bot.api.content(t, bot.handle(configImport(admin, server.URL+"/invalid.yaml"))); !strings.HasPrefix(content, "Could not import the settings") {
+		t.Errorf("/config import of an invalid file = %q", content)
+	}
+	guild = settings.Guild(testGuildID)
+	if guild.Timezone != "Asia/Tokyo" || !slices.Equal(guild.AIChannels, []string{"300000000000000002"}) || guild.ModLogChannel != "300000000000000003" || guild.BridgeChannel != "300000000000000001" {
+		t.Errorf("settings after /config import = %+v", guild)
+	}
+
+	// a restart reads the same settings
+	if stored := newSettings(bot.store, bot.config).Guild(testGuildID); stored.Timezone != guild.Timezone || !slices.Equal(stored.AIChannels, guild.AIChannels) || stored.ModLogChannel != guild.ModLogChannel {
+		t.Errorf("stored settings %+v differ from %+v", stored, guild)
+	}
+
+	// resetting everything leaves only the config file
+	bot.handle(command(admin, "config", subcommand("reset")))
+	if guild := settings.Guild(testGuildID); guild.Timezone != "Europe/Berlin" || guild.AIChannels != nil || guild.ModLogChannel != "" {
+		t.Errorf("settings after /config reset = %+v", guild)
+	}
+}
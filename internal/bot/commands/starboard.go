@@ -0,0 +1,446 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	starboardBucket = "starboards"
+	// starboardPostBucket remembers the posts of starred messages, by
+	// guildID/messageID.
+	starboardPostBucket = "starboardPosts"
+
+	defaultStarThreshold = 3
+)
+
+// starboard reposts messages that got enough reactions with an emoji.
+type starboard struct {
+	Channel   string `json:"channel"`
+	Emoji     string `json:"emoji"` // in the format of the API
+	Threshold int    `json:"threshold"`
+}
+
+// starboardPost is the repost of a starred message.
+type starboardPost struct {
+	ChannelID string `json:"channelId"` // of the starred message
+	PostID    string `json:"postId"`
+	// PostChannelID is the starboard the post is in, which stays the same
+	// when the starboard moves. Older posts don't have it.
+	PostChannelID string `json:"postChannelId,omitempty"`
+	Count         int    `json:"count"`
+}
+
+// postChannel returns the channel of a post on board.
+func (post starboardPost) postChannel(board starboard) string {
+	if post.PostChannelID != "" {
+		return post.PostChannelID
+	}
+	return board.Channel
+}
+
+func (reactions *reactions) registerStarboard(bot *discordgo.Session, r *router.Router) {
+	// add handlers
+	bot.AddHandler(reactions.starAddListener)
+	bot.AddHandler(reactions.starRemoveListener)
+	bot.AddHandler(reactions.starRemoveAllListener)
+	bot.AddHandler(reactions.starDeletionListener)
+
+	manageGuild := int64(discordgo.PermissionManageServer)
+	minThreshold := float64(1)
+
+	// add commands
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:                     "starboard",
+			Description:              "Manages the starboard of this server.",
+			DefaultMemberPermissions: &manageGuild,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set",
+					Description: "Sets where and when messages are reposted.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							Name:         "channel",
+							Description:  "The channel starred messages are reposted in",
+							Required:     true,
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "emoji",
+							Description: "The emoji that stars messages, ⭐ by default",
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "threshold",
+							Description: fmt.Sprintf("How many reactions a message needs, %d by default", defaultStarThreshold),
+							MinValue:    &minThreshold,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "disable",
+					Description: "Stops reposting messages.",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "show",
+					Description: "Shows the starboard of this server.",
+				},
+			},
+		},
+		Subcommands: map[string]router.Handler{
+			"set":     reactions.setStarboardCommand,
+			"disable": reactions.disableStarboardCommand,
+			"show":    reactions.showStarboardCommand,
+		},
+	})
+}
+
+func (reactions *reactions) readStarboards() {
+	err := reactions.store.View(func(tx storage.Tx) error {
+		return tx.ForEach(starboardBucket, "", func(key string, value []byte) error {
+			board := &starboard{}
+			if err := json.Unmarshal(value, board); err != nil {
+				return err
+			}
+
+			reactions.starboards[key] = board
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println("Failed to read starboards: ", err)
+	}
+}
+
+// starboard returns the starboard of a guild.
+func (reactions *reactions) starboard(guildID string) (starboard, bool) {
+	reactions.mu.RLock()
+	defer reactions.mu.RUnlock()
+
+	board, exists := reactions.starboards[guildID]
+	if !exists {
+		return starboard{}, false
+	}
+	return *board, true
+}
+
+// setStarboard stores the starboard of a guild, nil disables it.
+func (reactions *reactions) setStarboard(guildID string, board *starboard) error {
+	reactions.mu.Lock()
+	defer reactions.mu.Unlock()
+
+	err := reactions.store.Update(func(tx storage.Tx) error {
+		if board == nil {
+			return tx.Delete(starboardBucket, guildID)
+		}
+		return storage.PutJSON(tx, starboardBucket, guildID, board)
+	})
+	if err != nil {
+		return err
+	}
+
+	if board == nil {
+		delete(reactions.starboards, guildID)
+	} else {
+		reactions.starboards[guildID] = board
+	}
+	return nil
+}
+
+func (reactions *reactions) starAddListener(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	reactions.starred(s, r.MessageReaction)
+}
+
+func (reactions *reactions) starRemoveListener(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+	reactions.starred(s, r.MessageReaction)
+}
+
+func (reactions *reactions) starRemoveAllListener(s *discordgo.Session, r *discordgo.MessageReactionRemoveAll) {
+	if board, exists := reactions.starboard(r.GuildID); exists {
+		reactions.updateStarboard(s, r.GuildID, board, r.ChannelID, r.MessageID)
+	}
+}
+
+// starDeletionListener takes deleted messages off the starboard.
+func (reactions *reactions) starDeletionListener(s *discordgo.Session, m *discordgo.MessageDelete) {
+	board, exists := reactions.starboard(m.GuildID)
+	if !exists {
+		return
+	}
+
+	var post starboardPost
+	err := reactions.store.View(func(tx storage.Tx) error {
+		return storage.GetJSON(tx, starboardPostBucket, storage.Key(m.GuildID, m.ID), &post)
+	})
+	if err == nil {
+		reactions.updateStarboard(s, m.GuildID, board, m.ChannelID, m.ID)
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		log.Println("Failed to read starboard post: ", err)
+	}
+}
+
+// starred updates the starboard when a reaction with its emoji changes.
+func (reactions *reactions) starred(s *discordgo.Session, r *discordgo.MessageReaction) {
+	if r.GuildID == "" {
+		return
+	}
+
+	board, exists := reactions.starboard(r.GuildID)
+	if !exists || !emojiIs(r.Emoji, board.Emoji) {
+		return
+	}
+	reactions.updateStarboard(s, r.GuildID, board, r.ChannelID, r.MessageID)
+}
+
+// updateStarboard reposts a message that reached the threshold, updates the
+// count of its post and deletes the post once it falls below the threshold.
+func (reactions *reactions) updateStarboard(s *discordgo.Session, guildID string, board starboard, channelID string, messageID string) {
+	// messages in the starboard are never starred
+	if channelID == board.Channel {
+		return
+	}
+
+	reactions.starring.Lock()
+	defer reactions.starring.Unlock()
+
+	// deleted messages have no stars
+	count := 0
+	message, err := s.ChannelMessage(channelID, messageID)
+	if err != nil && !isNotFound(err) {
+		log.Println("Failed to get starred message: ", err)
+		return
+	}
+	if err == nil {
+		for _, reaction := range message.Reactions {
+			if reaction.Emoji != nil && emojiIs(*reaction.Emoji, board.Emoji) {
+				count = reaction.Count
+			}
+		}
+	}
+
+	key := storage.Key(guildID, messageID)
+	var post starboardPost
+	posted := true
+	err = reactions.store.View(func(tx storage.Tx) error {
+		return storage.GetJSON(tx, starboardPostBucket, key, &post)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		posted = false
+	} else if err != nil {
+		log.Println("Failed to read starboard post: ", err)
+		return
+	}
+
+	if count < board.Threshold {
+		if !posted {
+			return
+		}
+
+		if err := s.ChannelMessageDelete(post.postChannel(board), post.PostID); err != nil && !isNotFound(err) {
+			log.Println("Failed to delete starboard post: ", err)
+			return
+		}
+		err := reactions.store.Update(func(tx storage.Tx) error {
+			return tx.Delete(starboardPostBucket, key)
+		})
+		if err != nil {
+			log.Println("Failed to delete starboard post: ", err)
+		}
+		return
+	}
+
+	content := fmt.Sprintf("%s **%d** <#%s>", formatAPIEmoji(board.Emoji), count, channelID)
+
+	if posted {
+		if post.Count == count {
+			return
+		}
+
+		_, err := s.ChannelMessageEdit(post.postChannel(board), post.PostID, content)
+		if err == nil {
+			post.Count = count
+			reactions.savePost(key, post)
+			return
+		}
+		if !isNotFound(err) {
+			log.Println("Failed to update starboard post: ", err)
+			return
+		}
+		// the post was deleted by hand, so it is posted again
+	}
+
+	reposted, err := s.ChannelMessageSendComplex(board.Channel, &discordgo.MessageSend{
+		Content:         content,
+		Embeds:          starboardEmbeds(s, guildID, message),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Println("Failed to post on the starboard: ", err)
+		return
+	}
+
+	reactions.savePost(key, starboardPost{ChannelID: channelID, PostID: reposted.ID, PostChannelID: board.Channel, Count: count})
+}
+
+func (reactions *reactions) savePost(key string, post starboardPost) {
+	err := reactions.store.Update(func(tx storage.Tx) error {
+		return storage.PutJSON(tx, starboardPostBucket, key, post)
+	})
+	if err != nil {
+		log.Println("Failed to save starboard post: ", err)
+	}
+}
+
+// starboardEmbeds shows a message with its author, a link to it and its
+// attachments. The first image is shown in the embed, further images get
+// their own embeds, which Discord shows as a gallery.
+func starboardEmbeds(s *discordgo.Session, guildID string, message *discordgo.Message) []*discordgo.MessageEmbed {
+	link := fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, message.ChannelID, message.ID)
+
+	embed := &discordgo.MessageEmbed{
+		URL:         link,
+		Description: message.Content,
+		Color:       convertHexColorToInt("F4B8E4"),
+		Timestamp:   message.Timestamp.Format(time.RFC3339),
+		Author: &discordgo.MessageEmbedAuthor{
+			Name:    authorName(s, guildID, message.Author),
+			IconURL: message.Author.AvatarURL(""),
+		},
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Source", Value: fmt.Sprintf("[Jump to the message](%s)", link)},
+		},
+	}
+	embeds := []*discordgo.MessageEmbed{embed}
+
+	var files []string
+	for _, attachment := range message.Attachments {
+		if !strings.HasPrefix(attachment.ContentType, "image/") {
+			files = append(files, fmt.Sprintf("[%s](%s)", attachment.Filename, attachment.URL))
+			continue
+		}
+
+		image := &discordgo.MessageEmbedImage{URL: attachment.URL}
+		if embed.Image == nil {
+			embed.Image = image
+		} else if len(embeds) < 4 {
+			// embeds with the same URL are merged into one post
+			embeds = append(embeds, &discordgo.MessageEmbed{URL: link, Image: image})
+		} else {
+			files = append(files, fmt.Sprintf("[%s](%s)", attachment.Filename, attachment.URL))
+		}
+	}
+
+	// links and gifs show up as embeds of the message
+	if embed.Image == nil {
+		for _, messageEmbed := range message.Embeds {
+			if messageEmbed.Image != nil {
+				embed.Image = &discordgo.MessageEmbedImage{URL: messageEmbed.Image.URL}
+				break
+			}
+			if messageEmbed.Thumbnail != nil {
+				embed.Image = &discordgo.MessageEmbedImage{URL: messageEmbed.Thumbnail.URL}
+				break
+			}
+		}
+	}
+
+	if len(files) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Attachments",
+			Value: truncate(strings.Join(files, "\n"), 1024),
+		})
+	}
+	return embeds
+}
+
+// authorName returns the name of a user as it is shown in a guild.
+func authorName(s *discordgo.Session, guildID string, user *discordgo.User) string {
+	if member, err := s.State.Member(guildID, user.ID); err == nil && member.Nick != "" {
+		return member.Nick
+	}
+	if user.GlobalName != "" {
+		return user.GlobalName
+	}
+	return user.Username
+}
+
+// isNotFound reports whether a request failed because the resource doesn't
+// exist (anymore).
+func isNotFound(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound
+}
+
+func (reactions *reactions) setStarboardCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	byName := router.Options(options)
+
+	board := &starboard{
+		Channel:   byName["channel"].Value.(string),
+		Emoji:     "⭐",
+		Threshold: defaultStarThreshold,
+	}
+	if option, exists := byName["emoji"]; exists {
+		emojis, err := parseEmojis(option.StringValue())
+		if err != nil || len(emojis) != 1 {
+			respond(s, i, fmt.Sprintf("%q is not a single emoji.", option.StringValue()), discordgo.MessageFlagsEphemeral)
+			return
+		}
+		board.Emoji = emojis[0]
+	}
+	if option, exists := byName["threshold"]; exists {
+		board.Threshold = int(option.IntValue())
+	}
+
+	if err := reactions.setStarboard(i.GuildID, board); err != nil {
+		log.Println("Failed to save starboard: ", err)
+		respond(s, i, "Could not save the starboard.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	respond(s, i, "Messages are reposted "+formatStarboard(*board)+".", discordgo.MessageFlagsEphemeral)
+}
+
+func (reactions *reactions) disableStarboardCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if _, exists := reactions.starboard(i.GuildID); !exists {
+		respond(s, i, "This server has no starboard.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	if err := reactions.setStarboard(i.GuildID, nil); err != nil {
+		log.Println("Failed to delete starboard: ", err)
+		respond(s, i, "Could not disable the starboard.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	respond(s, i, "Disabled the starboard. Posts already on it stay there.", discordgo.MessageFlagsEphemeral)
+}
+
+func (reactions *reactions) showStarboardCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	board, exists := reactions.starboard(i.GuildID)
+	if !exists {
+		respond(s, i, "This server has no starboard. Set one with /starboard set.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	respond(s, i, "Messages are reposted "+formatStarboard(board)+".", discordgo.MessageFlagsEphemeral)
+}
+
+func formatStarboard(board starboard) string {
+	return fmt.Sprintf("in <#%s> once they have %d %s", board.Channel, board.Threshold, formatAPIEmoji(board.Emoji))
+}
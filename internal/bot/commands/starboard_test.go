@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"GoBot/internal/storage"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestStarboard(t *testing.T) {
+	bot := newTestBot(t)
+	reactions := newReactions(bot.store, newSettings(bot.store, bot.config))
+	reactions.register(bot.session, bot.router)
+	admin := bot.member(testAdminID)
+
+	setBoard := func(channelID string) {
+		i := bot.handle(command(admin, "starboard", subcommand("set", channelOption("channel", channelID), intOption("threshold", 3))))
+		if content := bot.api.content(t, i); !strings.HasPrefix(content, "Messages are reposted") {
+			t.Fatalf("/starboard set = %q", content)
+		}
+	}
+	setBoard(testStarboard)
+
+	source := snowflake(time.Now())
+	// star sets the stars of the source message and tells the starboard
+	star := func(messageID string, emoji string, count int) {
+		bot.api.setMessage(&discordgo.Message{
+			ID:        messageID,
+			ChannelID: testChannel,
+			Author:    &discordgo.User{ID: testUserID(0), Username: "user0"},
+			Content:   "star me",
+			Reactions: []*discordgo.MessageReactions{{Emoji: &discordgo.Emoji{Name: emoji}, Count: count}},
+		})
+		reactions.starAddListener(bot.session, &discordgo.MessageReactionAdd{MessageReaction: &discordgo.MessageReaction{
+			UserID:    testUserID(1),
+			MessageID: messageID,
+			ChannelID: testChannel,
+			GuildID:   testGuildID,
+			Emoji:     discordgo.Emoji{Name: emoji},
+		}})
+	}
+	post := func(messageID string) (starboardPost, bool) {
+		var post starboardPost
+		err := bot.store.View(func(tx storage.Tx) error {
+			return storage.GetJSON(tx, starboardPostBucket, storage.Key(testGuildID, messageID), &post)
+		})
+		return post, err == nil
+	}
+
+	// below the threshold and with other emojis nothing is posted
+	star(source, "⭐", 2)
+	star(source, "🎉", 5)
+	if posts := bot.api.sentTo(testStarboard); len(posts) != 0 {
+		t.Fatalf("the starboard got %d posts below the threshold", len(posts))
+	}
+
+	star(source, "⭐", 3)
+	posts := bot.api.sentTo(testStarboard)
+	if len(posts) != 1 || !strings.Contains(posts[0].Content, "**3**") || len(posts[0].Embeds) == 0 || posts[0].Embeds[0].Description != "star me" {
+		t.Fatalf("posts after reaching the threshold = %+v", posts)
+	}
+	first, _ := post(source)
+
+	// the count of the post follows the stars
+	edits := "PATCH channels/" + testStarboard + "/messages/" + first.PostID
+	star(source, "⭐", 5)
+	star(source, "⭐", 5)
+	if updated, _ := post(source); bot.api.count(edits) != 1 || updated.Count != 5 {
+		t.Errorf("post was edited %d times and counts %d, want one edit to 5", bot.api.count(edits), updated.Count)
+	}
+
+	// and goes away below the threshold
+	star(source, "⭐", 2)
+	if _, exists := post(source); exists || bot.api.count("DELETE channels/"+testStarboard+"/messages/"+first.PostID) != 1 {
+		t.Error("the post stayed after falling below the threshold")
+	}
+
+	// posts stay in their channel when the starboard moves
+	star(source, "⭐", 4)
+	second, _ := post(source)
+	const newBoard = "300000000000000011"
+	setBoard(newBoard)
+	star(source, "⭐", 6)
+	if bot.api.count("PATCH channels/"+testStarboard+"/messages/"+second.PostID) != 1 || len(bot.api.sentTo(newBoard)) != 0 {
+		t.Error("moving the starboard didn't update the post in the old channel")
+	}
+
+	// a deleted source message takes its post with it
+	bot.session.ChannelMessageDelete(testChannel, source)
+	reactions.starDeletionListener(bot.session, &discordgo.MessageDelete{Message: &discordgo.Message{ID: source, ChannelID: testChannel, GuildID: testGuildID}})
+	if _, exists := post(source); exists || bot.api.count("DELETE channels/"+testStarboard+"/messages/"+second.PostID) != 1 {
+		t.Error("the post of a deleted message stayed")
+	}
+
+	// a post deleted by hand is posted again
+	other := snowflake(time.Now())
+	star(other, "⭐", 3)
+	third, _ := post(other)
+	if third.PostChannelID != newBoard {
+		t.Errorf("post = %+v, want it in the new starboard", third)
+	}
+	bot.api.fail(http.MethodPatch, "channels/"+newBoard+"/messages/"+third.PostID, http.StatusNotFound)
+	star(other, "⭐", 4)
+	if reposted, _ := post(other); len(bot.api.sentTo(newBoard)) != 2 || reposted.PostID == third.PostID || reposted.Count != 4 {
+		t.Errorf("post deleted by hand = %+v, want it posted again", reposted)
+	}
+
+	// messages on the starboard aren't starred themselves
+	sent := len(bot.api.sentTo(newBoard))
+	reactions.starAddListener(bot.session, &discordgo.MessageReactionAdd{MessageReaction: &discordgo.MessageReaction{
+		MessageID: third.PostID,
+		ChannelID: newBoard,
+		GuildID:   testGuildID,
+		Emoji:     discordgo.Emoji{Name: "⭐"},
+	}})
+	if len(bot.api.sentTo(newBoard)) != sent {
+		t.Error("a starboard post was starred")
+	}
+}
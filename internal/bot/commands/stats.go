@@ -0,0 +1,343 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/storage"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 365
+	// statsTopUsers are stacked in guild charts, everyone else is summed up.
+	statsTopUsers = 5
+)
+
+var (
+	minStatsDays = float64(7)
+
+	statsBackground = drawing.Color{R: 30, G: 30, B: 30, A: 255}
+	statsColors     = []drawing.Color{
+		{R: 244, G: 184, B: 228, A: 255},
+		{R: 141, G: 150, B: 84, A: 255},
+		{R: 140, G: 170, B: 238, A: 255},
+		{R: 239, G: 159, B: 118, A: 255},
+		{R: 129, G: 200, B: 190, A: 255},
+		{R: 202, G: 158, B: 230, A: 255},
+	}
+)
+
+// dailyCounts are the counts of a tracker per day.
+type dailyCounts struct {
+	days   []time.Time
+	totals []float64
+	users  map[string][]float64
+}
+
+// dayIndex returns the number of calendar days between start and t in loc.
+func dayIndex(start time.Time, t time.Time, loc *time.Location) int {
+	start, t = start.In(loc), t.In(loc)
+	from := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	to := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// daily sums the events of a tracker per day for the last days days. An
+// empty userID counts everyone.
+func (counter *counter) daily(guildID string, name string, userID string, days int, loc *time.Location) (dailyCounts, error) {
+	now := time.Now().In(loc)
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1-days)
+
+	counts := dailyCounts{
+		days:   make([]time.Time, days),
+		totals: make([]float64, days),
+		users:  map[string][]float64{},
+	}
+	for index := range counts.days {
+		counts.days[index] = start.AddDate(0, 0, index)
+	}
+
+	err := counter.store.View(func(tx storage.Tx) error {
+		return tx.ForEach(eventBucket, storage.Prefix(guildID, name), func(key string, value []byte) error {
+			var event countEvent
+			if err := json.Unmarshal(value, &event); err != nil {
+				return err
+			}
+			if userID != "" && event.UserID != userID {
+				return nil
+			}
+
+			index := dayIndex(start, event.Time, loc)
+			if index < 0 || index >= days {
+				return nil
+			}
+
+			if counts.users[event.UserID] == nil {
+				counts.users[event.UserID] = make([]float64, days)
+			}
+			counts.users[event.UserID][index] += float64(event.Amount)
+			counts.totals[index] += float64(event.Amount)
+			return nil
+		})
+	})
+	return counts, err
+}
+
+// topUsers returns the users with the highest counts, highest first.
+func (counts dailyCounts) topUsers(limit int) []string {
+	sums := map[string]float64{}
+	users := make([]string, 0, len(counts.users))
+	for userID, values := range counts.users {
+		for _, value := range values {
+			sums[userID] += value
+		}
+		users = append(users, userID)
+	}
+
+	slices.SortFunc(users, func(a, b string) int {
+		if sums[a] != sums[b] {
+			return cmp.Compare(sums[b], sums[a])
+		}
+		return strings.Compare(a, b)
+	})
+	return users[:min(limit, len(users))]
+}
+
+func (counter *counter) statsCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, subcommandOptions := router.SubcommandPath(i.ApplicationCommandData().Options)
+	options := router.Options(subcommandOptions)
+
+	t, exists := counter.find(i.GuildID, options["tracker"].StringValue())
+	if !exists {
+		respond(s, i, "There is no such tracker. Admins can add one with /counter add.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	days := defaultStatsDays
+	if option, exists := options["days"]; exists {
+		days = int(option.IntValue())
+	}
+
+	var user *discordgo.User
+	if option, exists := options["user"]; exists {
+		user = option.UserValue(s)
+	}
+
+	// rendering takes a moment
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if rErr != nil {
+		log.Println("Failed to defer interaction response: ", rErr)
+		return
+	}
+
+	userID := ""
+	title := fmt.Sprintf("%s in the last %d days", t.Name, days)
+	if user != nil {
+		userID = user.ID
+		title = fmt.Sprintf("%s of %s in the last %d days", t.Name, counter.displayName(s, i.GuildID, user.ID), days)
+	}
+
+	counts, err := counter.daily(i.GuildID, t.Name, userID, days, counter.settings.Guild(i.GuildID).Location())
+	if err != nil {
+		log.Println("Failed to read count events: ", err)
+		editResponse(s, i, "Could not read the counts.")
+		return
+	}
+	if len(counts.users) == 0 {
+		editResponse(s, i, fmt.Sprintf("Nothing was counted by %s in the last %d days.", t.Name, days))
+		return
+	}
+
+	var stacked []string
+	if user == nil {
+		stacked = counts.topUsers(statsTopUsers)
+	}
+
+	names := map[string]string{}
+	for _, id := range stacked {
+		names[id] = counter.displayName(s, i.GuildID, id)
+	}
+
+	image, err := renderCountChart(title, counts, stacked, names)
+	if err != nil {
+		log.Println("Error rendering chart: ", err)
+		editResponse(s, i, "Could not render the chart.")
+		return
+	}
+
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Files: []*discordgo.File{
+			{
+				Name:        t.Name + "-stats.png",
+				ContentType: "image/png",
+				Reader:      bytes.NewReader(image),
+			},
+		},
+	})
+	if err != nil {
+		log.Println("Failed to edit interaction response: ", err)
+	}
+}
+
+// displayName returns the name of a member, or the user ID if the member
+// can't be found.
+func (counter *counter) displayName(s *discordgo.Session, guildID string, userID string) string {
+	member, err := s.State.Member(guildID, userID)
+	if err != nil {
+		member, err = s.GuildMember(guildID, userID)
+	}
+	if err != nil {
+		return userID
+	}
+	return member.DisplayName()
+}
+
+func editResponse(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	_, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &content,
+	})
+	if err != nil {
+		log.Println("Failed to edit interaction response: ", err)
+	}
+}
+
+// renderCountChart draws the daily totals as areas, the stacked users on top
+// of each other, and the cumulative total as a line on the right axis.
+func renderCountChart(title string, counts dailyCounts, stacked []string, names map[string]string) ([]byte, error) {
+	areaStyle := func(color drawing.Color) chart.Style {
+		return chart.Style{
+			Show:        true,
+			StrokeColor: color,
+			FillColor:   color.WithAlpha(200),
+		}
+	}
+
+	// the total goes first, every stacked user is drawn over the ones below
+	series := []chart.Series{
+		chart.TimeSeries{
+			Name:    "daily total",
+			Style:   areaStyle(statsColors[0]),
+			XValues: counts.days,
+			YValues: counts.totals,
+		},
+	}
+	if len(stacked) > 0 {
+		series[0] = chart.TimeSeries{
+			Name:    "others",
+			Style:   areaStyle(drawing.ColorFromHex("737994")),
+			XValues: counts.days,
+			YValues: counts.totals,
+		}
+
+		for rank := len(stacked) - 1; rank >= 0; rank-- {
+			// the area of a user reaches up to the sum of every user ranked
+			// at or above them
+			values := make([]float64, len(counts.days))
+			for _, userID := range stacked[:rank+1] {
+				for index, value := range counts.users[userID] {
+					values[index] += value
+				}
+			}
+
+			series = append(series, chart.TimeSeries{
+				Name:    names[stacked[rank]],
+				Style:   areaStyle(statsColors[rank%len(statsColors)]),
+				XValues: counts.days,
+				YValues: values,
+			})
+		}
+	}
+
+	cumulative := make([]float64, len(counts.totals))
+	sum := 0.0
+	for index, value := range counts.totals {
+		sum += value
+		cumulative[index] = sum
+	}
+	series = append(series, chart.TimeSeries{
+		Name: "cumulative",
+		Style: chart.Style{
+			Show:        true,
+			StrokeColor: drawing.ColorWhite,
+			StrokeWidth: 2,
+		},
+		YAxis:   chart.YAxisSecondary,
+		XValues: counts.days,
+		YValues: cumulative,
+	})
+
+	axisStyle := chart.Style{
+		Show:        true,
+		StrokeColor: drawing.ColorWhite,
+		FontColor:   drawing.ColorWhite,
+	}
+	// counts are whole numbers
+	countFormatter := func(v interface{}) string {
+		return fmt.Sprintf("%.0f", v.(float64))
+	}
+
+	graph := chart.Chart{
+		Width:  1280,
+		Height: 540,
+		DPI:    120,
+		Title:  title,
+		TitleStyle: chart.Style{
+			Show:      true,
+			FontColor: drawing.ColorWhite,
+		},
+		Background: chart.Style{
+			Show:      true,
+			FillColor: statsBackground,
+			Padding:   chart.Box{Top: 50, Left: 20, Right: 20, Bottom: 20},
+		},
+		Canvas: chart.Style{
+			Show:      true,
+			FillColor: statsBackground,
+		},
+		XAxis: chart.XAxis{
+			Style:          axisStyle,
+			ValueFormatter: chart.TimeDateValueFormatter,
+		},
+		YAxis: chart.YAxis{
+			Style:          axisStyle,
+			NameStyle:      chart.Style{Show: true, FontColor: drawing.ColorWhite},
+			Name:           "per day",
+			Range:          &chart.ContinuousRange{Min: 0, Max: max(slices.Max(counts.totals), 1)},
+			ValueFormatter: countFormatter,
+		},
+		YAxisSecondary: chart.YAxis{
+			Style:          axisStyle,
+			NameStyle:      chart.Style{Show: true, FontColor: drawing.ColorWhite},
+			Name:           "total",
+			Range:          &chart.ContinuousRange{Min: 0, Max: max(sum, 1)},
+			ValueFormatter: countFormatter,
+		},
+		Series: series,
+	}
+	graph.Elements = []chart.Renderable{
+		chart.Legend(&graph, chart.Style{
+			FillColor:   statsBackground,
+			FontColor:   drawing.ColorWhite,
+			StrokeColor: drawing.ColorWhite,
+		}),
+	}
+
+	var image bytes.Buffer
+	if err := graph.Render(chart.PNG, &image); err != nil {
+		return nil, err
+	}
+	return image.Bytes(), nil
+}
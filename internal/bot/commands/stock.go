@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/config"
 	"context"
 	"fmt"
 	"log"
@@ -8,6 +10,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -19,6 +22,10 @@ import (
 )
 
 type stock struct {
+	// mu guards values, valuesOrder and the chart file which are shared by
+	// all stock commands.
+	mu            sync.Mutex
+	config        *config.Manager
 	client        *http.Client
 	srv           *sheets.Service
 	spreadsheetId string
@@ -29,21 +36,47 @@ type stock struct {
 	tokenPath     string
 }
 
-func newStock() stock {
-	return stock{
-		spreadsheetId: "1T5fBStqddB1jGeaV97aNaxa2clDul-5mh3L1JeyoAmQ",
-		sheetName:     "Finance",
-		chartPath:     "assets/images/chart.png",
-		tokenPath:     "internal/config/gen-lang-client-0978399676-5efcfe192b5b.json",
+func newStock(config *config.Manager) *stock {
+	return &stock{
+		config:    config,
+		tokenPath: config.Current().Stock.CredentialsPath,
 	}
 }
 
-func (stock *stock) register(bot *discordgo.Session) {
+func (stock *stock) register(r *router.Router) {
+	if stock.tokenPath == "" {
+		log.Println("No stock credentials configured, the stock commands are disabled.")
+		return
+	}
+
 	// create google sheets client
 	stock.createClient()
 
-	// add handlers
-	bot.AddHandler(stock.StockCommand)
+	// add commands
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "rheinmetall",
+			Description: "Show rheinmetall stock information.",
+		},
+		Global:  true,
+		Handler: stock.StockCommand,
+	})
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "stock",
+			Description: "Show values of the specified stock",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "stock",
+					Description: "The stock you want to query",
+					Required:    true,
+				},
+			},
+		},
+		Global:  true,
+		Handler: stock.StockCommand,
+	})
 }
 
 func toFloat64(num string) (float64, error) {
@@ -372,10 +405,6 @@ func (stock *stock) generateFields() []*discordgo.MessageEmbedField {
 func (stock *stock) StockCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	data := i.ApplicationCommandData()
 
-	if data.Name != "rheinmetall" && data.Name != "stock" {
-		return
-	}
-
 	var (
 		stockName    string
 		title        string
@@ -416,6 +445,15 @@ func (stock *stock) StockCommand(s *discordgo.Session, i *discordgo.InteractionC
 		log.Println("Failed to send stock interaction response: ", rErr)
 	}
 
+	stock.mu.Lock()
+	defer stock.mu.Unlock()
+
+	// pick up changes of the config file
+	stockConfig := stock.config.Current().Stock
+	stock.spreadsheetId = stockConfig.SpreadsheetId
+	stock.sheetName = stockConfig.SheetName
+	stock.chartPath = stockConfig.ChartPath
+
 	err := stock.getStockInfo(stockName)
 
 	if err != nil {
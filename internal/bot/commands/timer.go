@@ -1,299 +1,1068 @@
 package commands
 
 import (
-	"context"
+	"GoBot/internal/bot/router"
+	"GoBot/internal/scheduler"
+	"GoBot/internal/storage"
+	"GoBot/internal/timeparse"
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
-	"google.golang.org/genai"
 )
 
+const (
+	timerBucket = "timers"
+	// timerRetryDelay is the time until a timer whose message couldn't be
+	// sent is tried again.
+	timerRetryDelay = 30 * time.Second
+	timerAttempts   = 5
+	// snoozeWindow is how long a delivered timer can be snoozed.
+	snoozeWindow = 24 * time.Hour
+	// draftLifetime is how long a new timer waits for its confirmation.
+	draftLifetime = 15 * time.Minute
+)
+
+// snoozeDurations are the buttons below a delivered timer.
+var snoozeDurations = []time.Duration{10 * time.Minute, time.Hour, 24 * time.Hour}
+
 type timers struct {
-	timersPath string
-	timersData map[string][]timer
-	Tom        *genAi
+	mu               sync.Mutex // guards timersData, attempts and drafts
+	store            storage.Store
+	timezones        *timezones
+	legacyTimersPath string
+	timersData       map[string][]timer
+	attempts         map[string]int // failed attempts by timer id
+	drafts           map[string]timerDraft
+	Tom              *genAi
+	clock            scheduler.Clock
+	scheduler        *scheduler.Scheduler
+	session          *discordgo.Session
+	startOnce        sync.Once
+	stop             chan struct{}
 }
 
+// Delivery modes of timers.
+const (
+	deliveryAI      = "ai"      // ai answer in the channel, mentions the user
+	deliveryPlain   = "plain"   // plain reminder in the channel
+	deliveryMention = "mention" // plain reminder in the channel, mentions the user
+	deliveryDM      = "dm"      // plain reminder as direct message
+)
+
 type timer struct {
 	Id        string
 	Date      string
 	Message   string
 	ChannelId string
 	User      string
+	UserId    string
 	Pronouns  string
 	GuildId   string
+	// Fired timers were delivered and are only kept to be snoozed.
+	Fired bool
+	// Delivery is one of the delivery modes, empty means ai.
+	Delivery string
+
+	// Repeat is the cron spec of recurring timers, RepeatText the rule as
+	// the user wrote it.
+	Repeat     string
+	RepeatText string
+	// Until ends a recurring timer (RFC3339, exclusive), MaxCount limits its
+	// occurrences. Count is the number of occurrences so far.
+	Until    string
+	MaxCount int
+	Count    int
 }
 
-func newTimers(tom *genAi) timers {
-	return timers{
-		timersPath: "assets/data/timers.json",
-		Tom:        tom,
-	}
+// timerDraft is a new or edited timer waiting for its confirmation.
+type timerDraft struct {
+	timer   timer
+	created time.Time
+	// edit changes the stored timer once an edit is confirmed, it returns a
+	// response if the change isn't possible anymore. It is nil for new
+	// timers.
+	edit func(t *timer) string
 }
 
-func (t *timer) create(bot *discordgo.Session, timers *timers) {
-	// wait until time is reached
-	loc, tErr := time.LoadLocation("Europe/Berlin")
-	if tErr != nil {
-		log.Println("Failed to load timezone: ", tErr)
+func newTimers(store storage.Store, timezones *timezones, tom *genAi, clock scheduler.Clock) *timers {
+	timers := &timers{
+		store:            store,
+		timezones:        timezones,
+		legacyTimersPath: "assets/data/timers.json",
+		attempts:         map[string]int{},
+		drafts:           map[string]timerDraft{},
+		Tom:              tom,
+		clock:            clock,
+		stop:             make(chan struct{}),
 	}
+	timers.scheduler = scheduler.New(clock, timers.fire)
+
+	return timers
+}
 
-	until, err := time.ParseInLocation(time.RFC3339, t.Date, loc)
+func (t timer) delivery() string {
+	if t.Delivery == "" {
+		return deliveryAI
+	}
+	return t.Delivery
+}
 
+// due returns the time the timer fires.
+func (t timer) due() time.Time {
+	date, err := time.Parse(time.RFC3339, t.Date)
 	if err != nil {
 		log.Println("Couldn't parse time for timer: ", err)
 	}
-	log.Println("time: ", time.Until(until))
-	time.Sleep(time.Until(until))
+	return date
+}
 
-	// add timer message to contents
-	timers.Tom.contents = append(timers.Tom.contents, &genai.Content{
-		Parts: []*genai.Part{
-			{
-				Text: fmt.Sprintf("%s %s: %s", t.User, t.Pronouns, t.Message),
-			},
-		},
-		Role: "user",
-	})
+// fire sends the message of a due timer.
+func (timers *timers) fire(job scheduler.Job) {
+	t, exists := timers.find(job.ID)
+	if !exists || t.Fired {
+		return
+	}
+
+	if err := timers.deliver(t); err != nil {
+		log.Println("Failed to deliver timer: ", err)
+
+		// discord might be unavailable for a moment
+		timers.mu.Lock()
+		retry := false
+		if timers.unchanged(t) {
+			timers.attempts[t.Id]++
+			retry = timers.attempts[t.Id] < timerAttempts
+		}
+		timers.mu.Unlock()
+
+		if retry {
+			timers.scheduler.Schedule(t.Id, timers.clock.Now().Add(timerRetryDelay))
+			return
+		}
+	}
 
-	// generate ai message
-	content, cErr := timers.Tom.client.Models.GenerateContent(context.Background(), timers.Tom.ModelName, timers.Tom.contents, timers.Tom.Config)
+	timers.mu.Lock()
+	defer timers.mu.Unlock()
 
-	if cErr != nil {
-		log.Println("Failed to generate timer ai message: ", cErr)
+	// the timer was cancelled, edited or snoozed while it was delivered
+	if !timers.unchanged(t) {
+		return
 	}
+	delete(timers.attempts, t.Id)
 
-	response := content.Candidates[0].Content.Parts[0].Text
+	// apply the changes to the stored timer, its message might have been
+	// edited meanwhile
+	t, _ = timers.lookup(t.Id)
 
-	// add ai response to contents
-	// add timer message to contents
-	timers.Tom.contents = append(timers.Tom.contents, &genai.Content{
-		Parts: []*genai.Part{
-			{
-				Text: response,
-			},
-		},
-		Role: "model",
-	})
+	// schedule the next occurrence
+	if t.Repeat != "" {
+		t.Count++
+		if next, exists := timers.nextOccurrence(t); exists {
+			t.Date = next.Format(time.RFC3339)
+			timers.put(t)
+			timers.scheduler.Schedule(t.Id, next)
+			return
+		}
 
-	// send message
-	_, mErr := bot.ChannelMessageSend(t.ChannelId, response)
-	if mErr != nil {
-		log.Println("Failed to send message: ", mErr)
+		timers.remove(t)
+		return
 	}
 
-	// remove timer
-	timers.timersData[t.GuildId] = slices.DeleteFunc(timers.timersData[t.GuildId], func(timer timer) bool {
-		return timer.Id == t.Id
-	})
+	// keep the timer for snoozing
+	t.Fired = true
+	timers.put(t)
+	timers.prune(t.GuildId)
+}
 
-	timers.write()
+// unchanged reports whether t is still stored and due at the same date, so
+// firing it may update it. A changed date has already been rescheduled. mu
+// must be held.
+func (timers *timers) unchanged(t timer) bool {
+	current, exists := timers.lookup(t.Id)
+	return exists && !current.Fired && current.Date == t.Date
 }
 
-func (timers *timers) register(bot *discordgo.Session) {
-	bot.AddHandler(timers.timerCommand)
-	bot.AddHandler(timers.load)
+// nextOccurrence returns the next time a recurring timer fires after now,
+// unless it reached its end. Occurrences missed while the bot was offline are
+// skipped.
+func (timers *timers) nextOccurrence(t timer) (time.Time, bool) {
+	if t.MaxCount > 0 && t.Count >= t.MaxCount {
+		return time.Time{}, false
+	}
 
-	// load timers
-	timers.read()
+	// recurring timers keep the time of day of the user who set them
+	loc := timers.timezones.Location(t.UserId, t.GuildId)
+	now := timers.clock.Now().In(loc)
 
-}
+	next, err := scheduler.NextOccurrence(t.Repeat, t.due().In(loc))
+	if err == nil && !next.After(now) {
+		next, err = scheduler.NextOccurrence(t.Repeat, now)
+	}
+	if err != nil {
+		log.Println("Couldn't calculate next occurrence of timer: ", err)
+		return time.Time{}, false
+	}
 
-func (timers *timers) load(s *discordgo.Session, g *discordgo.GuildCreate) {
-	for _, timer := range timers.timersData[g.Guild.ID] {
-		go timer.create(s, timers)
+	if t.Until != "" {
+		until, err := time.Parse(time.RFC3339, t.Until)
+		if err == nil && !next.Before(until) {
+			return time.Time{}, false
+		}
 	}
+	return next, true
 }
 
-func (timers *timers) read() {
-	// check if file exists
-	if _, err := os.Stat(timers.timersPath); err != nil {
-		timers.timersData = map[string][]timer{}
-		return
+// applyRecurrence sets the recurrence options of /timer set and /timer edit.
+// first is the first time the timer fires. It returns a response if an
+// option is invalid.
+func (timers *timers) applyRecurrence(t *timer, options map[string]*discordgo.ApplicationCommandInteractionDataOption, first time.Time, loc *time.Location) string {
+	if option, exists := options["repeat"]; exists {
+		rule := option.StringValue()
+		if strings.EqualFold(rule, "none") {
+			// the end of the old recurrence goes with it
+			t.Repeat = ""
+			t.RepeatText = ""
+			t.Until = ""
+			t.MaxCount = 0
+			t.Count = 0
+		} else {
+			spec, err := scheduler.ParseRecurrence(rule, first.In(loc))
+			if err != nil {
+				return fmt.Sprintf("Could not understand the repeat rule: %s", err)
+			}
+			t.Repeat = spec
+			t.RepeatText = rule
+		}
 	}
 
-	// read file
-	if file, fErr := os.ReadFile(timers.timersPath); fErr == nil {
-		err := json.Unmarshal(file, &timers.timersData)
+	if option, exists := options["until"]; exists {
+		until, err := time.ParseInLocation(time.DateOnly, option.StringValue(), loc)
 		if err != nil {
-			log.Fatalln("Couldn't unmarshal timer json: ", err)
-			return
+			return "Please input the end date in the correct format: Year-Month-Day"
 		}
-	} else {
-		log.Println("Couldn't read timer file: ", fErr)
+		// the timer still fires on the end date
+		t.Until = until.AddDate(0, 0, 1).Format(time.RFC3339)
 	}
+
+	if option, exists := options["count"]; exists {
+		t.MaxCount = int(option.IntValue())
+	}
+
+	if t.Repeat == "" && (t.Until != "" || t.MaxCount > 0) {
+		return "An end date or count only works together with repeat."
+	}
+	return ""
 }
 
-func (timers *timers) write() {
-	if data, jErr := json.MarshalIndent(timers.timersData, "", "  "); jErr == nil {
-		err := os.WriteFile(timers.timersPath, data, 0666)
+// deliver sends the reminder of a timer the way its delivery mode says.
+func (timers *timers) deliver(t timer) error {
+	content := timers.reminderText(t)
+
+	if t.delivery() == deliveryAI {
+		// fall back to the plain reminder if the ai is unavailable
+		response, err := timers.Tom.generate(t.GuildId, timers.aiPrompt(t))
 		if err != nil {
-			log.Fatalln("Couldn't write timer file: ", err)
+			log.Println("Failed to generate timer ai message, sending plain reminder: ", err)
+		} else {
+			content = response
 		}
-	} else {
-		log.Println("Couldn't marshal timer json: ", jErr)
 	}
+
+	message := &discordgo.MessageSend{
+		Content: content,
+		// only the user who set the timer is pinged
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+	if t.Repeat == "" {
+		// recurring timers can't be snoozed
+		message.Components = snoozeButtons(t.Id)
+	}
+
+	if t.UserId != "" && t.delivery() != deliveryPlain && t.delivery() != deliveryDM {
+		message.Content = "<@" + t.UserId + "> " + message.Content
+		message.AllowedMentions.Users = []string{t.UserId}
+	}
+
+	if t.delivery() == deliveryDM && t.UserId != "" {
+		channel, err := timers.session.UserChannelCreate(t.UserId)
+		if err == nil {
+			_, err = timers.session.ChannelMessageSendComplex(channel.ID, message)
+		}
+		if err == nil {
+			return nil
+		}
+
+		// closed DMs, remind in the channel instead
+		log.Println("Failed to send timer DM, sending it to the channel: ", err)
+		message.Content = "<@" + t.UserId + "> " + message.Content
+		message.AllowedMentions.Users = []string{t.UserId}
+	}
+
+	_, err := timers.session.ChannelMessageSendComplex(t.ChannelId, message)
+	return err
 }
 
-func (timers *timers) checkTime(givenTime time.Time, now time.Time) string {
-	response := ""
+// reminderText is the plain text reminder of a timer.
+func (timers *timers) reminderText(t timer) string {
+	message := t.Message
+	if message == "" {
+		message = "Your timer is up!"
+	}
 
-	if now.Compare(givenTime) == 1 {
-		response = "That time is in the past."
-	} else if now.Compare(givenTime) == 0 {
-		response = "That time is now."
+	text := "⏰ " + message
+	if t.delivery() == deliveryPlain {
+		text = fmt.Sprintf("⏰ Reminder for %s: %s", t.User, message)
 	}
-	return response
+
+	// timers that expired while the bot was offline are sent late
+	if timers.clock.Now().Sub(t.due()) > time.Minute {
+		text += fmt.Sprintf(" (late, this was due %s)", discordTimestamp(t.due(), "R"))
+	}
+	return text
 }
 
-func (timers *timers) timerCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	data := i.ApplicationCommandData()
+// aiPrompt is the message the ai answers for a timer.
+func (timers *timers) aiPrompt(t timer) string {
+	prompt := fmt.Sprintf("%s %s: %s", t.User, t.Pronouns, t.Message)
 
-	if data.Name != "timer" {
-		return
+	if timers.clock.Now().Sub(t.due()) > time.Minute {
+		loc := timers.timezones.Location(t.UserId, t.GuildId)
+		prompt += fmt.Sprintf(" (this reminder is late, it was due at %s)", t.due().In(loc).Format(time.DateTime))
 	}
+	return prompt
+}
 
-	if data.Options == nil {
-		rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "Please provide an option.",
-				Flags:   discordgo.MessageFlagsEphemeral,
-			},
+func snoozeButtons(timerID string) []discordgo.MessageComponent {
+	buttons := []discordgo.MessageComponent{}
+	for _, duration := range snoozeDurations {
+		buttons = append(buttons, discordgo.Button{
+			Label:    "Snooze " + formatSnooze(duration),
+			Style:    discordgo.SecondaryButton,
+			CustomID: router.CustomID("timersnooze", timerID, duration.String()),
 		})
-		if rErr != nil {
-			log.Println("Failed to send interaction response: ", rErr)
-		}
-		return
 	}
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
 
-	// create timer
-	var response = "The bot will answer on your set time."
-	loc, tErr := time.LoadLocation("Europe/Berlin")
-	if tErr != nil {
-		log.Println("Failed to load timezone: ", tErr)
+func formatSnooze(duration time.Duration) string {
+	switch {
+	case duration >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(duration.Hours()/24))
+	case duration >= time.Hour:
+		return fmt.Sprintf("%dh", int(duration.Hours()))
 	}
-	var date time.Time
-	now := time.Now().In(loc)
-	inputTime := now
-	message := ""
+	return fmt.Sprintf("%dm", int(duration.Minutes()))
+}
 
-	for _, option := range data.Options {
-		switch option.Name {
-		case "message":
-			message = option.StringValue()
-		case "seconds":
-			if value, err := time.ParseDuration(fmt.Sprintf("%ds", option.IntValue())); err == nil {
-				inputTime = inputTime.Add(value)
-				check := timers.checkTime(inputTime, now)
-				if check == "" {
-					date = inputTime
-				} else {
-					response = check
-				}
+// find returns the timer with the given id.
+func (timers *timers) find(id string) (timer, bool) {
+	timers.mu.Lock()
+	defer timers.mu.Unlock()
 
-			} else {
-				response = "Please only input the number of seconds."
-			}
-		case "minutes":
-			if value, err := time.ParseDuration(fmt.Sprintf("%dm", option.IntValue())); err == nil {
-				inputTime = inputTime.Add(value)
-				check := timers.checkTime(inputTime, now)
-				if check == "" {
-					date = inputTime
-				} else {
-					response = check
-				}
-			} else {
-				response = "Please only input the number of minutes."
-			}
-		case "hours":
-			if value, err := time.ParseDuration(fmt.Sprintf("%dh", option.IntValue())); err == nil {
-				inputTime = inputTime.Add(value)
-				check := timers.checkTime(inputTime, now)
-				if check == "" {
-					date = inputTime
-				} else {
-					response = check
-				}
-			} else {
-				response = "Please only input the number of hours."
+	return timers.lookup(id)
+}
+
+// lookup is find for callers that hold mu.
+func (timers *timers) lookup(id string) (timer, bool) {
+	for _, guildTimers := range timers.timersData {
+		for _, t := range guildTimers {
+			if t.Id == id {
+				return t, true
 			}
-		case "time":
-			if value, err := time.ParseInLocation(time.TimeOnly, option.StringValue(), loc); err == nil {
-				value = value.AddDate(now.Year(), int(now.Month())-1, now.Day()-1)
-				check := timers.checkTime(value, now)
-				if check == "" {
-					date = value
-				} else {
-					response = check
-				}
-			} else {
-				response = "Please input the time in the correct format: HH:mm:ss"
+		}
+	}
+	return timer{}, false
+}
+
+// put adds or replaces a timer and saves it. mu must be held.
+func (timers *timers) put(t timer) {
+	index := slices.IndexFunc(timers.timersData[t.GuildId], func(existing timer) bool {
+		return existing.Id == t.Id
+	})
+	if index == -1 {
+		timers.timersData[t.GuildId] = append(timers.timersData[t.GuildId], t)
+	} else {
+		timers.timersData[t.GuildId][index] = t
+	}
+
+	timers.save(t)
+}
+
+// remove deletes a timer. mu must be held.
+func (timers *timers) remove(t timer) {
+	timers.timersData[t.GuildId] = slices.DeleteFunc(timers.timersData[t.GuildId], func(existing timer) bool {
+		return existing.Id == t.Id
+	})
+	delete(timers.attempts, t.Id)
+
+	timers.delete(t)
+}
+
+// prune removes fired timers that can't be snoozed anymore. mu must be held.
+func (timers *timers) prune(guildID string) {
+	for _, t := range slices.Clone(timers.timersData[guildID]) {
+		if t.Fired && timers.clock.Now().Sub(t.due()) > snoozeWindow {
+			timers.remove(t)
+		}
+	}
+}
+
+// pending returns the pending timers of a guild sorted by date. userID ""
+// returns the timers of every user.
+func (timers *timers) pending(guildID string, userID string) []timer {
+	timers.mu.Lock()
+	defer timers.mu.Unlock()
+
+	pending := []timer{}
+	for _, t := range timers.timersData[guildID] {
+		if !t.Fired && (userID == "" || t.UserId == userID) {
+			pending = append(pending, t)
+		}
+	}
+
+	sort.Slice(pending, func(a, b int) bool {
+		return pending[a].due().Before(pending[b].due())
+	})
+	return pending
+}
+
+func (timers *timers) register(bot *discordgo.Session, r *router.Router) {
+	timers.session = bot
+	bot.AddHandler(timers.start)
+
+	whenOption := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "when",
+		Description: "when to answer: in 2h 30m, tomorrow at 8, next friday 18:00, morgen um 9, 2025-05-01 14:00",
+	}
+	timerOption := &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         "timer",
+		Description:  "The timer",
+		Required:     true,
+		Autocomplete: true,
+	}
+	messageOption := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "message",
+		Description: "inform the bot:",
+	}
+	deliveryOption := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "delivery",
+		Description: "how to remind you (default: ai)",
+		Choices: []*discordgo.ApplicationCommandOptionChoice{
+			{Name: "ai answer with mention", Value: deliveryAI},
+			{Name: "plain text", Value: deliveryPlain},
+			{Name: "plain text with mention", Value: deliveryMention},
+			{Name: "direct message", Value: deliveryDM},
+		},
+	}
+	minCount := 1.0
+	recurrenceOptions := []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "repeat",
+			Description: "repeat the timer: daily, weekly, every monday 09:00, weekdays at 7:30, every 2 hours or a cron expression",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "until",
+			Description: "stop repeating after this date. Format: Year-Month-Day",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "count",
+			Description: "stop repeating after this many times",
+			MinValue:    &minCount,
+		},
+	}
+
+	// add commands
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "timer",
+			Description: "The bot will answer the message after the requested time.",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set",
+					Description: "The bot will answer the message after the requested time.",
+					Options:     slices.Concat([]*discordgo.ApplicationCommandOption{whenOption, messageOption, deliveryOption}, recurrenceOptions),
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "Shows your pending timers.",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "cancel",
+					Description: "Cancels a timer.",
+					Options:     []*discordgo.ApplicationCommandOption{timerOption},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "edit",
+					Description: "Changes the message or time of a timer.",
+					Options:     slices.Concat([]*discordgo.ApplicationCommandOption{timerOption, whenOption, messageOption, deliveryOption}, recurrenceOptions),
+				},
+			},
+		},
+		Subcommands: map[string]router.Handler{
+			"set":    timers.timerCommand,
+			"list":   timers.listCommand,
+			"cancel": timers.cancelCommand,
+			"edit":   timers.editCommand,
+		},
+		Autocomplete: timers.autocompleteTimer,
+	})
+	r.AddComponent("timersnooze", "timer", timers.snoozeButton)
+	r.AddComponent("timerconfirm", "timer", timers.confirmButton)
+	r.AddComponent("timerdiscard", "timer", timers.discardButton)
+
+	// load timers
+	timers.read()
+
+	for _, guildTimers := range timers.timersData {
+		for _, t := range guildTimers {
+			if !t.Fired {
+				timers.scheduler.Schedule(t.Id, t.due())
 			}
-		case "date":
-			if value, err := time.ParseInLocation(time.DateOnly, option.StringValue(), loc); err == nil {
-				check := timers.checkTime(value, now)
-				if check == "" {
-					date = value
-				} else {
-					response = check
-				}
-			} else {
-				response = "Please input the time in the correct format: Year-Month-Day"
+		}
+	}
+}
+
+// start runs the scheduler once the bot is connected. Later Ready events of
+// reconnects don't start it again.
+func (timers *timers) start(s *discordgo.Session, r *discordgo.Ready) {
+	timers.startOnce.Do(func() {
+		go timers.scheduler.Run(timers.stop)
+	})
+}
+
+// close stops the scheduler.
+func (timers *timers) close() {
+	close(timers.stop)
+}
+
+func (timers *timers) read() {
+	timers.timersData = map[string][]timer{}
+	timers.importLegacy()
+
+	err := timers.store.View(func(tx storage.Tx) error {
+		return tx.ForEach(timerBucket, "", func(key string, value []byte) error {
+			var t timer
+			if err := json.Unmarshal(value, &t); err != nil {
+				return err
 			}
-		case "dateandtime":
-			if value, err := time.ParseInLocation(time.DateTime, option.StringValue(), loc); err == nil {
-				check := timers.checkTime(value, now)
-				if check == "" {
-					date = value
-				} else {
-					response = check
+			timers.timersData[t.GuildId] = append(timers.timersData[t.GuildId], t)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println("Couldn't read timers: ", err)
+	}
+
+	timers.mu.Lock()
+	for guildID := range timers.timersData {
+		timers.prune(guildID)
+	}
+	timers.mu.Unlock()
+}
+
+// importLegacy moves the timers of timers.json into the store.
+func (timers *timers) importLegacy() {
+	legacyData := map[string][]timer{}
+	if !readLegacyJSON(timers.legacyTimersPath, &legacyData) {
+		return
+	}
+
+	err := timers.store.Update(func(tx storage.Tx) error {
+		for guildID, guildTimers := range legacyData {
+			for _, t := range guildTimers {
+				if err := storage.PutJSON(tx, timerBucket, storage.Key(guildID, t.Id), t); err != nil {
+					return err
 				}
-			} else {
-				response = "Please input the time in the correct format: Year-Month-Day HH:mm:ss"
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		log.Println("Couldn't import timers: ", err)
+		return
+	}
+
+	markLegacyImported(timers.legacyTimersPath)
+}
+
+func (timers *timers) save(t timer) {
+	err := timers.store.Update(func(tx storage.Tx) error {
+		return storage.PutJSON(tx, timerBucket, storage.Key(t.GuildId, t.Id), t)
+	})
+	if err != nil {
+		log.Println("Couldn't save timer: ", err)
+	}
+}
+
+func (timers *timers) delete(t timer) {
+	err := timers.store.Update(func(tx storage.Tx) error {
+		return tx.Delete(timerBucket, storage.Key(t.GuildId, t.Id))
+	})
+	if err != nil {
+		log.Println("Couldn't delete timer: ", err)
+	}
+}
+
+// parseWhen reads the when option of /timer set and /timer edit. date is zero
+// if no time was given, response explains why a given time is invalid.
+func (timers *timers) parseWhen(options []*discordgo.ApplicationCommandInteractionDataOption, loc *time.Location) (time.Time, string) {
+	option, exists := router.Options(options)["when"]
+	if !exists {
+		return time.Time{}, ""
+	}
+
+	date, err := timeparse.Parse(option.StringValue(), timers.clock.Now().In(loc))
+	if err != nil {
+		return time.Time{}, fmt.Sprintf("Could not understand the time: %s", err)
+	}
+	return date, ""
+}
+
+func (timers *timers) timerCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+
+	if len(options) == 0 {
+		respond(s, i, "Please provide an option.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	// create timer
+	var response = "The bot will answer on your set time."
+	loc := timers.timezones.Location(interactionUser(i).ID, i.GuildID)
+	message := ""
+	if option, exists := router.Options(options)["message"]; exists {
+		message = option.StringValue()
+	}
+
+	date, dateResponse := timers.parseWhen(options, loc)
+	_, repeats := router.Options(options)["repeat"]
+	if dateResponse != "" {
+		response = dateResponse
+	} else if date.IsZero() && !repeats {
+		response = "Please provide a time."
 	}
 
 	guild, _ := s.State.Guild(i.GuildID)
 
-	if !date.IsZero() {
+	if dateResponse == "" && (!date.IsZero() || repeats) {
 		t := timer{
 			Id:        i.ID,
-			Date:      date.Format(time.RFC3339),
 			Message:   message,
+			Delivery:  deliveryAI,
 			User:      i.Member.DisplayName(),
+			UserId:    i.Member.User.ID,
 			Pronouns:  timers.Tom.getPronouns(guild, i.Member),
 			ChannelId: i.ChannelID,
 			GuildId:   i.GuildID,
 		}
 
-		go t.create(s, timers)
+		if option, exists := router.Options(options)["delivery"]; exists {
+			t.Delivery = option.StringValue()
+		}
 
-		if _, exists := timers.timersData[i.GuildID]; !exists {
-			timers.timersData[i.GuildID] = []timer{}
+		first := date
+		if first.IsZero() {
+			first = timers.clock.Now()
+		}
+		if recurrenceResponse := timers.applyRecurrence(&t, router.Options(options), first, loc); recurrenceResponse != "" {
+			respond(s, i, recurrenceResponse, discordgo.MessageFlagsEphemeral)
+			return
 		}
 
-		timers.timersData[i.GuildID] = append(timers.timersData[i.GuildID], t)
+		// without a time the first occurrence follows the rule
+		if date.IsZero() {
+			var err error
+			date, err = scheduler.NextOccurrence(t.Repeat, first.In(loc))
+			if err != nil {
+				respond(s, i, fmt.Sprintf("Could not understand the repeat rule: %s", err), discordgo.MessageFlagsEphemeral)
+				return
+			}
+		}
+		t.Date = date.Format(time.RFC3339)
 
-		timers.write()
+		timers.confirm(s, i, t, nil)
+		return
 	}
 
 	// send response
+	respond(s, i, response, discordgo.MessageFlagsEphemeral)
+}
+
+// confirm shows the resolved time of a new or edited timer and saves it only
+// after the user confirmed it. t is the timer as it will be, edit is the
+// change of an edited timer.
+func (timers *timers) confirm(s *discordgo.Session, i *discordgo.InteractionCreate, t timer, edit func(t *timer) string) {
+	timers.mu.Lock()
+	for id, draft := range timers.drafts {
+		if timers.clock.Now().Sub(draft.created) > draftLifetime {
+			delete(timers.drafts, id)
+		}
+	}
+	timers.drafts[i.ID] = timerDraft{timer: t, created: timers.clock.Now(), edit: edit}
+	timers.mu.Unlock()
+
+	verb := "Set a timer"
+	if edit != nil {
+		verb = "Change the timer"
+	}
+	content := fmt.Sprintf("%s for **%s** (%s)?", verb, discordTimestamp(t.due(), "F"), discordTimestamp(t.due(), "R"))
+	if t.Repeat != "" {
+		content = fmt.Sprintf("%s repeating %s, starting **%s** (%s)?", verb, t.RepeatText, discordTimestamp(t.due(), "F"), discordTimestamp(t.due(), "R"))
+	}
+
 	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: response,
-			Flags:   discordgo.MessageFlagsEphemeral,
+			Content: content,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{
+							Label:    "Confirm",
+							Style:    discordgo.SuccessButton,
+							CustomID: router.CustomID("timerconfirm", i.ID),
+						},
+						discordgo.Button{
+							Label:    "Cancel",
+							Style:    discordgo.SecondaryButton,
+							CustomID: router.CustomID("timerdiscard", i.ID),
+						},
+					},
+				},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
 		},
 	})
 	if rErr != nil {
 		log.Println("Failed to send interaction response: ", rErr)
 	}
 }
+
+// takeDraft removes the draft a confirmation button belongs to.
+func (timers *timers) takeDraft(i *discordgo.InteractionCreate) (timerDraft, bool) {
+	_, args := router.ParseCustomID(i.MessageComponentData().CustomID)
+	if len(args) != 1 {
+		return timerDraft{}, false
+	}
+
+	timers.mu.Lock()
+	defer timers.mu.Unlock()
+
+	draft, exists := timers.drafts[args[0]]
+	if !exists || timers.clock.Now().Sub(draft.created) > draftLifetime {
+		return timerDraft{}, false
+	}
+	delete(timers.drafts, args[0])
+	return draft, true
+}
+
+// updateConfirmation replaces the confirmation message.
+func updateConfirmation(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send interaction response: ", rErr)
+	}
+}
+
+func (timers *timers) confirmButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	draft, exists := timers.takeDraft(i)
+	if !exists {
+		updateConfirmation(s, i, "This timer expired, please set it again.")
+		return
+	}
+	if draft.edit != nil {
+		timers.confirmEdit(s, i, draft)
+		return
+	}
+	t := draft.timer
+
+	// the time might have passed while the user was deciding
+	if !t.due().After(timers.clock.Now()) {
+		updateConfirmation(s, i, "That time is in the past now, please set the timer again.")
+		return
+	}
+
+	timers.mu.Lock()
+	timers.put(t)
+	timers.mu.Unlock()
+
+	timers.scheduler.Schedule(t.Id, t.due())
+
+	updateConfirmation(s, i, fmt.Sprintf("The bot will answer %s.", discordTimestamp(t.due(), "R")))
+}
+
+// confirmEdit applies a confirmed edit to the timer as it is stored now, so
+// occurrences counted since the edit was started are kept.
+func (timers *timers) confirmEdit(s *discordgo.Session, i *discordgo.InteractionCreate, draft timerDraft) {
+	timers.mu.Lock()
+	t, exists := timers.lookup(draft.timer.Id)
+	if !exists || t.Fired {
+		timers.mu.Unlock()
+		updateConfirmation(s, i, "This timer doesn't exist anymore.")
+		return
+	}
+	if response := draft.edit(&t); response != "" {
+		timers.mu.Unlock()
+		updateConfirmation(s, i, response)
+		return
+	}
+	timers.put(t)
+	timers.mu.Unlock()
+
+	timers.scheduler.Schedule(t.Id, t.due())
+
+	updateConfirmation(s, i, "Changed the timer to "+t.describe(discordTimestamp(t.due(), "f")))
+}
+
+func (timers *timers) discardButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	timers.takeDraft(i)
+	updateConfirmation(s, i, "The timer was not set.")
+}
+
+// isTimerAdmin reports whether the member may see and change the timers of
+// everyone in the guild.
+func isTimerAdmin(member *discordgo.Member) bool {
+	return member != nil && member.Permissions&(discordgo.PermissionManageServer|discordgo.PermissionAdministrator) != 0
+}
+
+// visibleTimers returns the pending timers the member of an interaction may
+// see and change.
+func (timers *timers) visibleTimers(i *discordgo.InteractionCreate) []timer {
+	if isTimerAdmin(i.Member) {
+		return timers.pending(i.GuildID, "")
+	}
+	return timers.pending(i.GuildID, interactionUser(i).ID)
+}
+
+// selectedTimer returns the timer chosen in the timer option, if the member
+// may change it.
+func (timers *timers) selectedTimer(i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) (timer, bool) {
+	option, exists := router.Options(options)["timer"]
+	if !exists {
+		return timer{}, false
+	}
+
+	id := option.StringValue()
+	visible := timers.visibleTimers(i)
+	index := slices.IndexFunc(visible, func(t timer) bool {
+		return t.Id == id
+	})
+	if index == -1 {
+		return timer{}, false
+	}
+	return visible[index], true
+}
+
+// describe returns a short line about a timer. date is the formatted due
+// time, timestamp markup in messages and plain text in autocomplete choices.
+func (t timer) describe(date string) string {
+	message := t.Message
+	if message == "" {
+		message = "(no message)"
+	}
+	description := fmt.Sprintf("%s – %s", date, message)
+	if t.Repeat != "" {
+		description = fmt.Sprintf("next %s (repeats %s)", description, t.RepeatText)
+	}
+	return description
+}
+
+func (timers *timers) listCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	pending := timers.visibleTimers(i)
+
+	if len(pending) == 0 {
+		respond(s, i, "There are no pending timers.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	lines := []string{}
+	for _, t := range pending {
+		line := t.describe(discordTimestamp(t.due(), "f"))
+		if isTimerAdmin(i.Member) {
+			line += fmt.Sprintf(" (%s)", t.User)
+		}
+		lines = append(lines, line)
+	}
+
+	title := "Your timers"
+	if isTimerAdmin(i.Member) {
+		title = "Timers of this server"
+	}
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       title,
+					Description: truncate(strings.Join(lines, "\n"), 4096),
+					Color:       convertHexColorToInt("F4B8E4"),
+				},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send interaction response: ", rErr)
+	}
+}
+
+func (timers *timers) cancelCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+
+	t, exists := timers.selectedTimer(i, options)
+	if !exists {
+		respond(s, i, "There is no such timer.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	timers.scheduler.Cancel(t.Id)
+
+	timers.mu.Lock()
+	timers.remove(t)
+	timers.mu.Unlock()
+
+	respond(s, i, "Cancelled the timer "+t.describe(discordTimestamp(t.due(), "f")), discordgo.MessageFlagsEphemeral)
+}
+
+func (timers *timers) editCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+
+	t, exists := timers.selectedTimer(i, options)
+	if !exists {
+		respond(s, i, "There is no such timer.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	loc := timers.timezones.Location(interactionUser(i).ID, i.GuildID)
+
+	date, response := timers.parseWhen(options, loc)
+	if response != "" {
+		respond(s, i, response, discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	// the edit runs again on the stored timer once it is confirmed
+	byName := router.Options(options)
+	edit := func(t *timer) string {
+		if option, exists := byName["message"]; exists {
+			t.Message = option.StringValue()
+		}
+		if option, exists := byName["delivery"]; exists {
+			t.Delivery = option.StringValue()
+		}
+		if !date.IsZero() {
+			if !date.After(timers.clock.Now()) {
+				return "That time is in the past, please pick a later one."
+			}
+			t.Date = date.Format(time.RFC3339)
+		}
+		return timers.applyRecurrence(t, byName, t.due(), loc)
+	}
+
+	if response := edit(&t); response != "" {
+		respond(s, i, response, discordgo.MessageFlagsEphemeral)
+		return
+	}
+	timers.confirm(s, i, t, edit)
+}
+
+// autocompleteTimer suggests the pending timers of the user (or of everyone
+// for admins).
+func (timers *timers) autocompleteTimer(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	focused := router.Focused(i.ApplicationCommandData().Options)
+	input := ""
+	if focused != nil {
+		input = strings.ToLower(focused.StringValue())
+	}
+
+	// autocomplete choices can't contain timestamp markup
+	loc := timers.timezones.Location(interactionUser(i).ID, i.GuildID)
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, t := range timers.visibleTimers(i) {
+		name := t.describe(t.due().In(loc).Format("Mon 2006-01-02 15:04"))
+		if isTimerAdmin(i.Member) {
+			name += fmt.Sprintf(" (%s)", t.User)
+		}
+		if !strings.Contains(strings.ToLower(name), input) || len(choices) == 25 {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: truncate(name, 100), Value: t.Id})
+	}
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send autocomplete response: ", rErr)
+	}
+}
+
+// snoozeButton schedules a delivered timer again.
+func (timers *timers) snoozeButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, args := router.ParseCustomID(i.MessageComponentData().CustomID)
+	if len(args) != 2 {
+		return
+	}
+
+	t, exists := timers.find(args[0])
+	duration, err := time.ParseDuration(args[1])
+	if !exists || err != nil {
+		respond(s, i, "This timer can't be snoozed anymore.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	if interactionUser(i).ID != t.UserId && !isTimerAdmin(i.Member) {
+		respond(s, i, "Only the person who set the timer can snooze it.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	date := timers.clock.Now().Add(duration)
+	t.Date = date.Format(time.RFC3339)
+	t.Fired = false
+
+	timers.mu.Lock()
+	timers.put(t)
+	timers.mu.Unlock()
+
+	timers.scheduler.Schedule(t.Id, date)
+
+	respond(s, i, fmt.Sprintf("Snoozed until %s.", discordTimestamp(date, "t")), discordgo.MessageFlagsEphemeral)
+}
+
+// truncate shortens text to at most limit characters.
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,262 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/scheduler"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// testClock is a clock that only moves when the test says so. Its timers
+// never fire, the tests fire timers themselves.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (clock *testClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	return clock.now
+}
+
+func (clock *testClock) NewTimer(d time.Duration) scheduler.Timer {
+	return testTimer{}
+}
+
+func (clock *testClock) advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	clock.now = clock.now.Add(d)
+}
+
+type testTimer struct{}
+
+func (testTimer) C() <-chan time.Time {
+	return nil
+}
+
+func (testTimer) Stop() bool {
+	return true
+}
+
+func newTestTimers(t *testing.T) (*testBot, *timers, *testClock) {
+	bot := newTestBot(t)
+	settings := newSettings(bot.store, bot.config)
+	timezones := newTimezones(bot.store, settings)
+	roleMenus := newRoleMenus(bot.store, settings)
+	tom := newTom(bot.store, bot.config, settings, timezones, roleMenus)
+
+	clock := &testClock{now: time.Now()}
+	timers := newTimers(bot.store, timezones, tom, clock)
+	timers.register(bot.session, bot.router)
+	return bot, timers, clock
+}
+
+// setTimer sets and confirms a timer and returns its ID.
+func setTimer(t *testing.T, bot *testBot, member *discordgo.Member, options ...*dataOption) string {
+	set := bot.handle(command(member, "timer", subcommand("set", options...)))
+	if response := bot.api.response(t, set); !strings.Contains(string(response.Data.Components), "timerconfirm") {
+		t.Errorf("/timer set = %q, want a confirmation", response.Data.Content)
+		return ""
+	}
+
+	confirm := bot.handle(button(member, router.CustomID("timerconfirm", set.ID)))
+	if content := bot.api.content(t, confirm); !strings.HasPrefix(content, "The bot will answer") {
+		t.Errorf("confirming the timer = %q", content)
+	}
+	return set.ID
+}
+
+// editTimer edits a timer, confirms the change and returns the response to
+// the confirmation.
+func editTimer(t *testing.T, bot *testBot, member *discordgo.Member, options ...*dataOption) string {
+	edit := bot.handle(command(member, "timer", subcommand("edit", options...)))
+	if response := bot.api.response(t, edit); !strings.Contains(string(response.Data.Components), "timerconfirm") {
+		return response.Data.Content
+	}
+
+	confirm := bot.handle(button(member, router.CustomID("timerconfirm", edit.ID)))
+	return bot.api.content(t, confirm)
+}
+
+func TestTimersConcurrently(t *testing.T) {
+	bot, timers, clock := newTestTimers(t)
+	admin := bot.member(testAdminID)
+
+	const perUser = 6
+	ids := make([][]string, testUsers)
+	concurrently(testUsers, func(n int) {
+		member := bot.member(testUserID(n))
+		for index := range perUser {
+			ids[n] = append(ids[n], setTimer(t, bot, member,
+				stringOption("when", fmt.Sprintf("in %d minutes", 10+index)),
+				stringOption("message", fmt.Sprint("timer ", index)),
+				stringOption("delivery", deliveryPlain)))
+		}
+	})
+
+	// a third of the timers is cancelled, a third fires and a third is
+	// edited, while everyone looks at their timers
+	clock.advance(time.Hour)
+	concurrently(testUsers, func(n int) {
+		member := bot.member(testUserID(n))
+		for index, id := range ids[n] {
+			requests := []*discordgo.InteractionCreate{
+				command(member, "timer", subcommand("list")),
+				command(admin, "timer", subcommand("list")),
+				autocomplete(member, "timer", subcommand("cancel", focused(stringOption("timer", "timer")))),
+			}
+
+			switch index % 3 {
+			case 0:
+				requests = append(requests, command(member, "timer", subcommand("cancel", stringOption("timer", id))))
+			case 1:
+				timers.fire(scheduler.Job{ID: id})
+			case 2:
+				editTimer(t, bot, member, stringOption("timer", id), stringOption("message", "edited"))
+			}
+
+			for _, i := range requests {
+				bot.handle(i)
+				bot.api.response(t, i)
+			}
+		}
+	})
+
+	for n := range testUsers {
+		for index, id := range ids[n] {
+			found, exists := timers.find(id)
+			switch index % 3 {
+			case 0:
+				if exists {
+					t.Errorf("cancelled timer %s still exists", id)
+				}
+			case 1:
+				if !exists || !found.Fired {
+					t.Errorf("timer %s was not marked as fired", id)
+				}
+			case 2:
+				if !exists || found.Fired || found.Message != "edited" {
+					t.Errorf("edited timer %s = %+v", id, found)
+				}
+			}
+		}
+	}
+
+	if sent := len(bot.api.sentTo(testChannel)); sent != testUsers*perUser/3 {
+		t.Errorf("%d reminders were sent, want %d", sent, testUsers*perUser/3)
+	}
+}
+
+// TestTimerChangedWhileFiring changes timers while their reminder is sent.
+func TestTimerChangedWhileFiring(t *testing.T) {
+	bot, timers, clock := newTestTimers(t)
+	member := bot.member(testUserID(0))
+
+	cancelled := setTimer(t, bot, member, stringOption("when", "in 10 minutes"), stringOption("message", "cancelled"), stringOption("delivery", deliveryPlain))
+	edited := setTimer(t, bot, member, stringOption("when", "in 10 minutes"), stringOption("message", "edited"), stringOption("delivery", deliveryPlain))
+	clock.advance(time.Hour)
+
+	var during func()
+	bot.api.before = func(method string, path string) {
+		if during != nil && method == http.MethodPost && strings.HasPrefix(path, "channels/") {
+			during()
+			during = nil
+		}
+	}
+
+	during = func() {
+		bot.handle(command(member, "timer", subcommand("cancel", stringOption("timer", cancelled))))
+	}
+	timers.fire(scheduler.Job{ID: cancelled})
+	if found, exists := timers.find(cancelled); exists {
+		t.Errorf("timer cancelled while firing was brought back: %+v", found)
+	}
+
+	during = func() {
+		editTimer(t, bot, member, stringOption("timer", edited), stringOption("message", "changed"))
+	}
+	timers.fire(scheduler.Job{ID: edited})
+	if found, _ := timers.find(edited); !found.Fired || found.Message != "changed" {
+		t.Errorf("timer edited while firing = %+v, want it fired with the new message", found)
+	}
+}
+
+func TestTimerRepeatNone(t *testing.T) {
+	bot, timers, _ := newTestTimers(t)
+	member := bot.member(testUserID(0))
+
+	id := setTimer(t, bot, member, stringOption("when", "in 10 minutes"), stringOption("message", "daily"),
+		stringOption("repeat", "every day at 9"), intOption("count", 3))
+	timers.fire(scheduler.Job{ID: id})
+	if found, _ := timers.find(id); found.Count != 1 || found.MaxCount != 3 {
+		t.Fatalf("recurring timer after firing once = %+v", found)
+	}
+
+	editTimer(t, bot, member, stringOption("timer", id), stringOption("repeat", "none"))
+	found, _ := timers.find(id)
+	if found.Repeat != "" || found.Until != "" || found.MaxCount != 0 || found.Count != 0 {
+		t.Errorf("timer after repeat:none = %+v, want no recurrence left", found)
+	}
+}
+
+func TestTimerEdit(t *testing.T) {
+	bot, timers, clock := newTestTimers(t)
+	member := bot.member(testUserID(0))
+
+	id := setTimer(t, bot, member, stringOption("when", "in 10 minutes"), stringOption("message", "daily"),
+		stringOption("repeat", "every day at 9"), intOption("count", 5))
+
+	// nothing changes before the edit is confirmed
+	edit := bot.handle(command(member, "timer", subcommand("edit", stringOption("timer", id), stringOption("message", "changed"))))
+	if content := bot.api.content(t, edit); !strings.HasPrefix(content, "Change the timer repeating every day at 9") {
+		t.Errorf("/timer edit = %q, want a confirmation", content)
+	}
+	if found, _ := timers.find(id); found.Message != "daily" {
+		t.Errorf("timer before the confirmation = %+v", found)
+	}
+
+	// an occurrence fired in the meantime is kept
+	timers.fire(scheduler.Job{ID: id})
+	confirm := bot.handle(button(member, router.CustomID("timerconfirm", edit.ID)))
+	if content := bot.api.content(t, confirm); !strings.HasPrefix(content, "Changed the timer") {
+		t.Errorf("confirming the edit = %q", content)
+	}
+	if found, _ := timers.find(id); found.Message != "changed" || found.Count != 1 {
+		t.Errorf("timer after the edit = %+v, want the new message and the fired occurrence", found)
+	}
+
+	// a time in the past is rejected, also when it passes before the
+	// confirmation
+	if content := editTimer(t, bot, member, stringOption("timer", id), stringOption("when", "2020-01-01 10:00")); !strings.Contains(content, "in the past") {
+		t.Errorf("editing to a past time = %q", content)
+	}
+	edit = bot.handle(command(member, "timer", subcommand("edit", stringOption("timer", id), stringOption("when", "in 5 minutes"))))
+	bot.api.response(t, edit)
+	clock.advance(10 * time.Minute)
+	confirm = bot.handle(button(member, router.CustomID("timerconfirm", edit.ID)))
+	if content := bot.api.content(t, confirm); !strings.Contains(content, "in the past") {
+		t.Errorf("confirming a time that passed = %q", content)
+	}
+
+	// a timer cancelled before the confirmation stays cancelled
+	edit = bot.handle(command(member, "timer", subcommand("edit", stringOption("timer", id), stringOption("message", "again"))))
+	bot.api.response(t, edit)
+	bot.handle(command(member, "timer", subcommand("cancel", stringOption("timer", id))))
+	confirm = bot.handle(button(member, router.CustomID("timerconfirm", edit.ID)))
+	if content := bot.api.content(t, confirm); !strings.Contains(content, "doesn't exist") {
+		t.Errorf("confirming an edit of a cancelled timer = %q", content)
+	}
+	if found, exists := timers.find(id); exists {
+		t.Errorf("cancelled timer was brought back: %+v", found)
+	}
+}
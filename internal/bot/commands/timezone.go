@@ -0,0 +1,241 @@
+package commands
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/storage"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const timezoneBucket = "userTimezones"
+
+// commonTimezones are suggested by the autocomplete of /timezone set. Every
+// other IANA name can be typed in full.
+var commonTimezones = []string{
+	"Europe/Berlin", "Europe/Vienna", "Europe/Zurich", "Europe/London", "Europe/Dublin", "Europe/Lisbon",
+	"Europe/Paris", "Europe/Amsterdam", "Europe/Brussels", "Europe/Madrid", "Europe/Rome", "Europe/Stockholm",
+	"Europe/Oslo", "Europe/Copenhagen", "Europe/Warsaw", "Europe/Prague", "Europe/Budapest", "Europe/Athens",
+	"Europe/Helsinki", "Europe/Istanbul", "Europe/Kyiv", "Europe/Moscow",
+	"America/New_York", "America/Chicago", "America/Denver", "America/Los_Angeles", "America/Anchorage",
+	"America/Toronto", "America/Vancouver", "America/Mexico_City", "America/Sao_Paulo", "America/Buenos_Aires",
+	"Asia/Tokyo", "Asia/Seoul", "Asia/Shanghai", "Asia/Hong_Kong", "Asia/Singapore", "Asia/Kolkata",
+	"Asia/Dubai", "Asia/Bangkok", "Asia/Jakarta", "Australia/Sydney", "Australia/Melbourne", "Australia/Perth",
+	"Pacific/Auckland", "Pacific/Honolulu", "Africa/Cairo", "Africa/Johannesburg", "Africa/Lagos", "UTC",
+}
+
+// timezones holds the timezones users set for themselves. Users without one
+// use the timezone of the guild.
+type timezones struct {
+	mu        sync.RWMutex // guards names and locations
+	store     storage.Store
+	settings  *settings
+	names     map[string]string // by user
+	locations map[string]*time.Location
+}
+
+func newTimezones(store storage.Store, settings *settings) *timezones {
+	timezones := &timezones{
+		store:     store,
+		settings:  settings,
+		names:     map[string]string{},
+		locations: map[string]*time.Location{},
+	}
+
+	timezones.read()
+	return timezones
+}
+
+func (timezones *timezones) register(r *router.Router) {
+	// add commands
+	r.Add(&router.Command{
+		Definition: &discordgo.ApplicationCommand{
+			Name:        "timezone",
+			Description: "Your timezone, used for timers and to show times.",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set",
+					Description: "Sets your timezone.",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "zone",
+							Description:  "The IANA name of the timezone, like Europe/Berlin",
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "show",
+					Description: "Shows your timezone.",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "reset",
+					Description: "Uses the timezone of the server again.",
+				},
+			},
+		},
+		Global: true,
+		Subcommands: map[string]router.Handler{
+			"set":   timezones.setCommand,
+			"show":  timezones.showCommand,
+			"reset": timezones.resetCommand,
+		},
+		Autocomplete: timezones.autocompleteZone,
+	})
+}
+
+func (timezones *timezones) read() {
+	err := timezones.store.View(func(tx storage.Tx) error {
+		return tx.ForEach(timezoneBucket, "", func(userID string, value []byte) error {
+			timezones.names[userID] = string(value)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println("Failed to read timezones: ", err)
+	}
+}
+
+// Location returns the timezone of a user, or the one of the guild if the
+// user didn't set one.
+func (timezones *timezones) Location(userID string, guildID string) *time.Location {
+	timezones.mu.RLock()
+	name, exists := timezones.names[userID]
+	loc := timezones.locations[name]
+	timezones.mu.RUnlock()
+
+	if !exists {
+		return timezones.settings.Guild(guildID).Location()
+	}
+	if loc != nil {
+		return loc
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Println("Failed to load timezone: ", err)
+		return timezones.settings.Guild(guildID).Location()
+	}
+
+	timezones.mu.Lock()
+	timezones.locations[name] = loc
+	timezones.mu.Unlock()
+
+	return loc
+}
+
+func (timezones *timezones) set(userID string, name string) error {
+	err := timezones.store.Update(func(tx storage.Tx) error {
+		if name == "" {
+			return tx.Delete(timezoneBucket, userID)
+		}
+		return tx.Put(timezoneBucket, userID, []byte(name))
+	})
+	if err != nil {
+		return err
+	}
+
+	timezones.mu.Lock()
+	defer timezones.mu.Unlock()
+
+	if name == "" {
+		delete(timezones.names, userID)
+	} else {
+		timezones.names[userID] = name
+	}
+	return nil
+}
+
+// discordTimestamp formats t as timestamp markup, which every user sees in
+// their own timezone. Styles are "F" (full date), "f", "D", "t", "T" and "R"
+// (relative).
+func discordTimestamp(t time.Time, style string) string {
+	return fmt.Sprintf("<t:%d:%s>", t.Unix(), style)
+}
+
+func (timezones *timezones) setCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, options := router.SubcommandPath(i.ApplicationCommandData().Options)
+	name := strings.TrimSpace(router.Options(options)["zone"].StringValue())
+
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "" || strings.EqualFold(name, "local") {
+		respond(s, i, fmt.Sprintf("%q is not a timezone. Use a name like Europe/Berlin.", name), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	if err := timezones.set(interactionUser(i).ID, loc.String()); err != nil {
+		log.Println("Failed to save timezone: ", err)
+		respond(s, i, "Could not save your timezone.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	now := time.Now().In(loc)
+	respond(s, i, fmt.Sprintf("Your timezone is now %s, where it is %s.", loc, now.Format("15:04")), discordgo.MessageFlagsEphemeral)
+}
+
+func (timezones *timezones) showCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	timezones.mu.RLock()
+	name, exists := timezones.names[interactionUser(i).ID]
+	timezones.mu.RUnlock()
+
+	if !exists {
+		loc := timezones.settings.Guild(i.GuildID).Location()
+		respond(s, i, fmt.Sprintf("You didn't set a timezone, so %s is used.", loc), discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	respond(s, i, fmt.Sprintf("Your timezone is %s.", name), discordgo.MessageFlagsEphemeral)
+}
+
+func (timezones *timezones) resetCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := timezones.set(interactionUser(i).ID, ""); err != nil {
+		log.Println("Failed to save timezone: ", err)
+		respond(s, i, "Could not reset your timezone.", discordgo.MessageFlagsEphemeral)
+		return
+	}
+
+	respond(s, i, "Your timezone was reset, the timezone of the server is used.", discordgo.MessageFlagsEphemeral)
+}
+
+// autocompleteZone suggests common timezones and the typed name if it is a
+// valid timezone.
+func (timezones *timezones) autocompleteZone(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	focused := router.Focused(i.ApplicationCommandData().Options)
+	input := ""
+	if focused != nil {
+		input = strings.TrimSpace(focused.StringValue())
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	if loc, err := time.LoadLocation(input); err == nil && input != "" && !strings.EqualFold(input, "local") {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: loc.String(), Value: loc.String()})
+	}
+
+	for _, name := range commonTimezones {
+		if len(choices) == 25 {
+			break
+		}
+		if strings.Contains(strings.ToLower(name), strings.ToLower(input)) && name != input {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: name})
+		}
+	}
+
+	rErr := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if rErr != nil {
+		log.Println("Failed to send autocomplete response: ", rErr)
+	}
+}
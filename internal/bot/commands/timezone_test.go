@@ -0,0 +1,141 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestTimezonesConcurrently(t *testing.T) {
+	bot := newTestBot(t)
+	settings := newSettings(bot.store, bot.config)
+	timezones := newTimezones(bot.store, settings)
+	timezones.register(bot.router)
+	settings.register(bot.router)
+
+	admin := bot.member(testAdminID)
+	zones := []string{"Europe/Berlin", "America/New_York", "Asia/Tokyo", "UTC"}
+
+	concurrently(testUsers, func(n int) {
+		member := bot.member(testUserID(n))
+		for index := range 20 {
+			requests := []*discordgo.InteractionCreate{
+				command(member, "timezone", subcommand("set", stringOption("zone", zones[(n+index)%len(zones)]))),
+				command(member, "timezone", subcommand("show")),
+				autocomplete(member, "timezone", subcommand("set", focused(stringOption("zone", "europe")))),
+				// the guild timezone is the fallback of users without one
+				command(admin, "config", subcommand("set", stringOption("key", "timezone"), stringOption("value", zones[index%len(zones)]))),
+			}
+			if index%5 == 4 {
+				requests = append(requests, command(member, "timezone", subcommand("reset")))
+			}
+
+			for _, i := range requests {
+				bot.handle(i)
+				bot.api.response(t, i)
+			}
+			timezones.Location(member.User.ID, testGuildID)
+		}
+	})
+
+	// the last change of every user was a reset
+	for n := range testUsers {
+		loc := timezones.Location(testUserID(n), testGuildID)
+		if want := settings.Guild(testGuildID).Location(); loc.String() != want.String() {
+			t.Errorf("timezone of user %d = %s, want the one of the guild %s", n, loc, want)
+		}
+	}
+
+	bot.handle(command(bot.member(testUserID(0)), "timezone", subcommand("set", stringOption("zone", "Asia/Tokyo"))))
+	if loc := newTimezones(bot.store, settings).Location(testUserID(0), testGuildID); loc.String() != "Asia/Tokyo" {
+		t.Errorf("stored timezone = %s, want Asia/Tokyo", loc)
+	}
+}
+
+func TestTimezoneCommand(t *testing.T) {
+	bot := newTestBot(t)
+	settings := newSettings(bot.store, bot.config)
+	timezones := newTimezones(bot.store, settings)
+	timezones.register(bot.router)
+	member := bot.member(testUserID(0))
+
+	run := func(options ...*dataOption) string {
+		i := bot.handle(command(member, "timezone", options...))
+		return bot.api.content(t, i)
+	}
+
+	for _, zone := range []string{"", "Local", "Mars/Olympus"} {
+		if content := run(subcommand("set", stringOption("zone", zone))); !strings.Contains(content, "is not a timezone") {
+			t.Errorf("/timezone set %q = %q, want it rejected", zone, content)
+		}
+	}
+
+	// users without a timezone get the one of the guild
+	if content := run(subcommand("show")); !strings.Contains(content, "Europe/Berlin is used") {
+		t.Errorf("/timezone show without a timezone = %q", content)
+	}
+
+	if content := run(subcommand("set", stringOption("zone", " America/New_York "))); !strings.HasPrefix(content, "Your timezone is now America/New_York") {
+		t.Errorf("/timezone set = %q", content)
+	}
+	if content := run(subcommand("show")); content != "Your timezone is America/New_York." {
+		t.Errorf("/timezone show = %q", content)
+	}
+	if loc := timezones.Location(member.User.ID, testGuildID); loc.String() != "America/New_York" {
+		t.Errorf("Location() = %s, want America/New_York", loc)
+	}
+	// other users keep the guild timezone
+	if loc := timezones.Location(testUserID(1), testGuildID); loc.String() != "Europe/Berlin" {
+		t.Errorf("Location() of another user = %s, want Europe/Berlin", loc)
+	}
+
+	run(subcommand("reset"))
+	if loc := timezones.Location(member.User.ID, testGuildID); loc.String() != "Europe/Berlin" {
+		t.Errorf("Location() after a reset = %s, want Europe/Berlin", loc)
+	}
+
+	// a valid name is suggested first, then the common ones containing it
+	suggest := func(input string) []string {
+		i := bot.handle(autocomplete(member, "timezone", subcommand("set", focused(stringOption("zone", input)))))
+		var names []string
+		for _, choice := range bot.api.response(t, i).Data.Choices {
+			names = append(names, choice.Name)
+		}
+		return names
+	}
+	if names := suggest("Asia/Kathmandu"); len(names) != 1 || names[0] != "Asia/Kathmandu" {
+		t.Errorf("suggestions for Asia/Kathmandu = %v", names)
+	}
+	if names := suggest("york"); len(names) != 1 || names[0] != "America/New_York" {
+		t.Errorf("suggestions for york = %v", names)
+	}
+	if names := suggest(""); len(names) != 25 {
+		t.Errorf("%d suggestions without input, want 25", len(names))
+	}
+}
+
+func TestTimerTimezone(t *testing.T) {
+	bot, timers, _ := newTestTimers(t)
+	member := bot.member(testUserID(0))
+
+	// the time of day is read in the timezone of the user
+	if err := timers.timezones.set(member.User.ID, "Asia/Tokyo"); err != nil {
+		t.Fatal(err)
+	}
+	id := setTimer(t, bot, member, stringOption("when", "tomorrow at 8"), stringOption("message", "tokyo"))
+	found, _ := timers.find(id)
+	if due := found.due().In(timers.timezones.Location(member.User.ID, testGuildID)); due.Hour() != 8 {
+		t.Errorf("timer for 8 in Tokyo is due at %s", due)
+	}
+
+	// and the guild timezone for everyone else
+	other := bot.member(testUserID(1))
+	id = setTimer(t, bot, other, stringOption("when", "tomorrow at 8"), stringOption("message", "berlin"))
+	found, _ = timers.find(id)
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	if due := found.due().In(berlin); due.Hour() != 8 {
+		t.Errorf("timer for 8 in Berlin is due at %s", due)
+	}
+}
@@ -0,0 +1,290 @@
+// Package router dispatches interactions to the subsystem that registered
+// the command or component they belong to.
+package router
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Handler handles a single interaction.
+type Handler func(s *discordgo.Session, i *discordgo.InteractionCreate)
+
+// Command is an application command together with its handlers.
+type Command struct {
+	Definition *discordgo.ApplicationCommand
+	// Global commands are registered for the whole application instead of
+	// every guild.
+	Global bool
+
+	// Handler is called for commands without subcommands.
+	Handler Handler
+	// Subcommands maps the path of a subcommand ("list" or "group list") to
+	// its handler.
+	Subcommands map[string]Handler
+	// Autocomplete is called for autocomplete interactions of the command.
+	Autocomplete Handler
+
+	// OwnerOnly commands can only be used by the owners of the bot.
+	OwnerOnly bool
+}
+
+// Authorizer decides whether the user of an interaction may use command. The
+// returned error is shown to the user.
+type Authorizer func(s *discordgo.Session, i *discordgo.InteractionCreate, command *Command) error
+
+// Router holds all registered commands and components.
+type Router struct {
+	mu         sync.RWMutex
+	commands   map[string]*Command
+	order      []string
+	components map[string]component
+	modals     map[string]component
+	authorizer Authorizer
+}
+
+// component is the handler of a component or modal and the name of the
+// command it belongs to.
+type component struct {
+	handler Handler
+	command string
+}
+
+func New() *Router {
+	return &Router{
+		commands:   map[string]*Command{},
+		components: map[string]component{},
+		modals:     map[string]component{},
+	}
+}
+
+// Add registers a command. Registering the same name twice is a programming
+// error and panics.
+func (r *Router) Add(command *Command) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := command.Definition.Name
+	if _, exists := r.commands[name]; exists {
+		panic(fmt.Sprintf("router: command %s registered twice", name))
+	}
+
+	r.commands[name] = command
+	r.order = append(r.order, name)
+}
+
+// AddComponent registers the handler of message components (buttons, select
+// menus) whose custom ID was created by CustomID with the given id. They are
+// authorized like the command they belong to. Components of no command
+// (command "") can be used by everyone.
+func (r *Router) AddComponent(id string, command string, handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.components[id]; exists {
+		panic(fmt.Sprintf("router: component %s registered twice", id))
+	}
+	r.components[id] = component{handler: handler, command: command}
+}
+
+// AddModal registers the handler of modals whose custom ID was created by
+// CustomID with the given id. They are authorized like components.
+func (r *Router) AddModal(id string, command string, handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.modals[id]; exists {
+		panic(fmt.Sprintf("router: modal %s registered twice", id))
+	}
+	r.modals[id] = component{handler: handler, command: command}
+}
+
+// SetAuthorizer sets the check that runs before every command, autocomplete
+// handler and component or modal that belongs to a command.
+func (r *Router) SetAuthorizer(authorizer Authorizer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.authorizer = authorizer
+}
+
+// Commands returns all registered commands in registration order.
+func (r *Router) Commands() []*Command {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	commands := make([]*Command, 0, len(r.order))
+	for _, name := range r.order {
+		commands = append(commands, r.commands[name])
+	}
+	return commands
+}
+
+// Definitions returns the definitions of all registered commands.
+func (r *Router) Definitions() []*discordgo.ApplicationCommand {
+	var definitions []*discordgo.ApplicationCommand
+	for _, command := range r.Commands() {
+		definitions = append(definitions, command.Definition)
+	}
+	return definitions
+}
+
+// Handle is the only InteractionCreate handler of the bot.
+func (r *Router) Handle(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("Recovered from panic in interaction handler: %v\n%s", err, debug.Stack())
+		}
+	}()
+
+	handler, command, authorizer := r.find(i)
+	if handler == nil {
+		return
+	}
+
+	if command != nil && authorizer != nil {
+		if err := authorizer(s, i, command); err != nil {
+			deny(s, i, err)
+			return
+		}
+	}
+
+	handler(s, i)
+}
+
+// find returns the handler of an interaction and the command it belongs to
+// (nil for components and modals of no command).
+func (r *Router) find(i *discordgo.InteractionCreate) (Handler, *Command, Authorizer) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		data := i.ApplicationCommandData()
+		command, exists := r.commands[data.Name]
+		if !exists {
+			log.Println("Received unknown command: ", data.Name)
+			return nil, nil, nil
+		}
+
+		if len(command.Subcommands) == 0 {
+			return command.Handler, command, r.authorizer
+		}
+
+		path, _ := SubcommandPath(data.Options)
+		handler, exists := command.Subcommands[path]
+		if !exists {
+			log.Printf("Received unknown subcommand: %s %s", data.Name, path)
+			return nil, nil, nil
+		}
+		return handler, command, r.authorizer
+
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		command, exists := r.commands[i.ApplicationCommandData().Name]
+		if !exists {
+			return nil, nil, nil
+		}
+		return command.Autocomplete, command, r.authorizer
+
+	case discordgo.InteractionMessageComponent:
+		id, _ := ParseCustomID(i.MessageComponentData().CustomID)
+		return r.component(r.components[id])
+
+	case discordgo.InteractionModalSubmit:
+		id, _ := ParseCustomID(i.ModalSubmitData().CustomID)
+		return r.component(r.modals[id])
+	}
+
+	return nil, nil, nil
+}
+
+// component returns the handler of a component and its command. r.mu must be
+// held.
+func (r *Router) component(c component) (Handler, *Command, Authorizer) {
+	command, exists := r.commands[c.command]
+	if !exists {
+		return c.handler, nil, nil
+	}
+	return c.handler, command, r.authorizer
+}
+
+// deny tells the user why the command can't be used. Autocomplete
+// interactions get no suggestions instead.
+func deny(s *discordgo.Session, i *discordgo.InteractionCreate, reason error) {
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: reason.Error(),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	}
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		response = &discordgo.InteractionResponse{
+			Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+			Data: &discordgo.InteractionResponseData{
+				Choices: []*discordgo.ApplicationCommandOptionChoice{},
+			},
+		}
+	}
+
+	if err := s.InteractionRespond(i.Interaction, response); err != nil {
+		log.Println("Failed to send interaction response: ", err)
+	}
+}
+
+// SubcommandPath returns the path of the invoked subcommand ("list" or
+// "group list") and the options passed to it.
+func SubcommandPath(options []*discordgo.ApplicationCommandInteractionDataOption) (string, []*discordgo.ApplicationCommandInteractionDataOption) {
+	var path []string
+
+	for len(options) > 0 {
+		option := options[0]
+		if option.Type != discordgo.ApplicationCommandOptionSubCommandGroup && option.Type != discordgo.ApplicationCommandOptionSubCommand {
+			break
+		}
+
+		path = append(path, option.Name)
+		options = option.Options
+	}
+
+	return strings.Join(path, " "), options
+}
+
+// Options maps options by their name.
+func Options(options []*discordgo.ApplicationCommandInteractionDataOption) map[string]*discordgo.ApplicationCommandInteractionDataOption {
+	byName := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(options))
+	for _, option := range options {
+		byName[option.Name] = option
+	}
+	return byName
+}
+
+// Focused returns the option that is currently autocompleted.
+func Focused(options []*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, option := range options {
+		if option.Focused {
+			return option
+		}
+		if focused := Focused(option.Options); focused != nil {
+			return focused
+		}
+	}
+	return nil
+}
+
+// CustomID builds the custom ID of a component or modal from the id it was
+// registered with and additional arguments.
+func CustomID(id string, args ...string) string {
+	return strings.Join(append([]string{id}, args...), ":")
+}
+
+// ParseCustomID splits a custom ID created by CustomID.
+func ParseCustomID(customID string) (string, []string) {
+	parts := strings.Split(customID, ":")
+	return parts[0], parts[1:]
+}
@@ -0,0 +1,218 @@
+package router
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type option = discordgo.ApplicationCommandInteractionDataOption
+
+// fakeAPI records the interaction responses of a session.
+type fakeAPI struct {
+	mu        sync.Mutex
+	responses []string
+}
+
+func (api *fakeAPI) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+
+	api.mu.Lock()
+	api.responses = append(api.responses, string(body))
+	api.mu.Unlock()
+
+	return &http.Response{StatusCode: http.StatusNoContent, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func newSession(t *testing.T) (*discordgo.Session, *fakeAPI) {
+	session, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal("failed to create session: ", err)
+	}
+	api := &fakeAPI{}
+	session.Client = &http.Client{Transport: api}
+	return session, api
+}
+
+func interaction(kind discordgo.InteractionType, data discordgo.InteractionData) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:    "1",
+		Token: "token",
+		Type:  kind,
+		Data:  data,
+	}}
+}
+
+func commandInteraction(name string, options ...*option) *discordgo.InteractionCreate {
+	return interaction(discordgo.InteractionApplicationCommand, discordgo.ApplicationCommandInteractionData{Name: name, Options: options})
+}
+
+func componentInteraction(customID string) *discordgo.InteractionCreate {
+	return interaction(discordgo.InteractionMessageComponent, discordgo.MessageComponentInteractionData{CustomID: customID})
+}
+
+func TestSubcommandPath(t *testing.T) {
+	value := &option{Type: discordgo.ApplicationCommandOptionString, Name: "name", Value: "x"}
+
+	tests := []struct {
+		options []*option
+		path    string
+		rest    []*option
+	}{
+		{nil, "", nil},
+		{[]*option{value}, "", []*option{value}},
+		{[]*option{{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "list"}}, "list", nil},
+		{[]*option{{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "add", Options: []*option{value}}}, "add", []*option{value}},
+		{[]*option{{Type: discordgo.ApplicationCommandOptionSubCommandGroup, Name: "palette", Options: []*option{
+			{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "add", Options: []*option{value}},
+		}}}, "palette add", []*option{value}},
+	}
+	for _, test := range tests {
+		path, rest := SubcommandPath(test.options)
+		if path != test.path || !slices.Equal(rest, test.rest) {
+			t.Errorf("SubcommandPath() = %q, %v, want %q, %v", path, rest, test.path, test.rest)
+		}
+	}
+}
+
+func TestFocused(t *testing.T) {
+	focused := &option{Type: discordgo.ApplicationCommandOptionString, Name: "rule", Focused: true}
+	options := []*option{{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "remove", Options: []*option{
+		{Type: discordgo.ApplicationCommandOptionString, Name: "other"},
+		focused,
+	}}}
+
+	if got := Focused(options); got != focused {
+		t.Errorf("Focused() = %v, want %v", got, focused)
+	}
+	if got := Focused(focused.Options); got != nil {
+		t.Errorf("Focused() without a focused option = %v, want nil", got)
+	}
+}
+
+func TestCustomID(t *testing.T) {
+	tests := []struct {
+		id   string
+		args []string
+	}{
+		{"timer_snooze", []string{}},
+		{"timer_snooze", []string{"12", "10m"}},
+		{"rolemenu", []string{"", "role"}},
+	}
+	for _, test := range tests {
+		customID := CustomID(test.id, test.args...)
+		id, args := ParseCustomID(customID)
+		if id != test.id || !slices.Equal(args, test.args) {
+			t.Errorf("ParseCustomID(%q) = %q, %v, want %q, %v", customID, id, args, test.id, test.args)
+		}
+	}
+}
+
+func TestHandle(t *testing.T) {
+	session, api := newSession(t)
+	r := New()
+
+	var called []string
+	handler := func(name string) Handler {
+		return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+			called = append(called, name)
+		}
+	}
+
+	r.Add(&Command{
+		Definition: &discordgo.ApplicationCommand{Name: "ping"},
+		Handler:    handler("ping"),
+	})
+	r.Add(&Command{
+		Definition: &discordgo.ApplicationCommand{Name: "timer"},
+		Subcommands: map[string]Handler{
+			"list":        handler("timer list"),
+			"palette add": handler("timer palette add"),
+		},
+		Autocomplete: handler("timer autocomplete"),
+	})
+	r.Add(&Command{
+		Definition: &discordgo.ApplicationCommand{Name: "secret"},
+		Handler:    handler("secret"),
+	})
+	r.AddComponent("timer_snooze", "timer", handler("snooze"))
+	r.AddComponent("secret_button", "secret", handler("secret button"))
+	r.AddComponent("menu", "", handler("menu"))
+	r.AddModal("secret_modal", "secret", handler("secret modal"))
+
+	// the secret command and everything that belongs to it is denied
+	r.SetAuthorizer(func(s *discordgo.Session, i *discordgo.InteractionCreate, command *Command) error {
+		if command.Definition.Name == "secret" {
+			return errors.New("denied")
+		}
+		return nil
+	})
+
+	tests := []struct {
+		interaction *discordgo.InteractionCreate
+		called      string // "" if no handler runs
+		denied      bool
+	}{
+		{commandInteraction("ping"), "ping", false},
+		{commandInteraction("unknown"), "", false},
+		{commandInteraction("timer", &option{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "list"}), "timer list", false},
+		{commandInteraction("timer", &option{Type: discordgo.ApplicationCommandOptionSubCommandGroup, Name: "palette", Options: []*option{
+			{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "add"},
+		}}), "timer palette add", false},
+		{commandInteraction("timer", &option{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "unknown"}), "", false},
+		{interaction(discordgo.InteractionApplicationCommandAutocomplete, discordgo.ApplicationCommandInteractionData{Name: "timer"}), "timer autocomplete", false},
+		{commandInteraction("secret"), "", true},
+		{componentInteraction(CustomID("timer_snooze", "12")), "snooze", false},
+		{componentInteraction(CustomID("secret_button")), "", true},
+		{componentInteraction(CustomID("menu", "1", "2")), "menu", false},
+		{componentInteraction("unknown"), "", false},
+		{interaction(discordgo.InteractionModalSubmit, discordgo.ModalSubmitInteractionData{CustomID: CustomID("secret_modal", "1")}), "", true},
+	}
+	for _, test := range tests {
+		called, api.responses = nil, nil
+		r.Handle(session, test.interaction)
+
+		want := []string{}
+		if test.called != "" {
+			want = append(want, test.called)
+		}
+		if !slices.Equal(called, want) {
+			t.Errorf("%+v called %v, want %v", test.interaction.Data, called, want)
+		}
+		if denied := len(api.responses) == 1 && strings.Contains(api.responses[0], "denied"); denied != test.denied {
+			t.Errorf("%+v got responses %v, denied %v", test.interaction.Data, api.responses, test.denied)
+		}
+	}
+}
+
+func TestHandleRecovers(t *testing.T) {
+	session, _ := newSession(t)
+	r := New()
+	r.Add(&Command{
+		Definition: &discordgo.ApplicationCommand{Name: "panic"},
+		Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+			panic("handler failed")
+		},
+	})
+
+	// a panicking handler doesn't take the bot down
+	r.Handle(session, commandInteraction("panic"))
+}
+
+func TestAddTwice(t *testing.T) {
+	r := New()
+	r.Add(&Command{Definition: &discordgo.ApplicationCommand{Name: "ping"}})
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a command twice didn't panic")
+		}
+	}()
+	r.Add(&Command{Definition: &discordgo.ApplicationCommand{Name: "ping"}})
+}
@@ -0,0 +1,189 @@
+package bot
+
+import (
+	"GoBot/internal/bot/router"
+	"GoBot/internal/config"
+	"encoding/json"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandSync keeps the registered application commands in line with the
+// commands declared in the router.
+type commandSync struct {
+	router *router.Router
+	config *config.Manager
+}
+
+// commandPlan is the difference between the registered and declared commands.
+type commandPlan struct {
+	create []string
+	update []string
+	remove []string
+}
+
+func (plan commandPlan) isEmpty() bool {
+	return len(plan.create) == 0 && len(plan.update) == 0 && len(plan.remove) == 0
+}
+
+func (plan commandPlan) String() string {
+	var parts []string
+	if len(plan.create) > 0 {
+		parts = append(parts, "create: "+strings.Join(plan.create, ", "))
+	}
+	if len(plan.update) > 0 {
+		parts = append(parts, "update: "+strings.Join(plan.update, ", "))
+	}
+	if len(plan.remove) > 0 {
+		parts = append(parts, "remove: "+strings.Join(plan.remove, ", "))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// onReady syncs the global commands.
+func (cs *commandSync) onReady(s *discordgo.Session, r *discordgo.Ready) {
+	cs.sync(s, "", cs.declared(true))
+}
+
+// onGuildCreate syncs the commands of a single guild.
+func (cs *commandSync) onGuildCreate(s *discordgo.Session, g *discordgo.GuildCreate) {
+	cs.sync(s, g.ID, cs.declared(false))
+}
+
+func (cs *commandSync) declared(global bool) []*discordgo.ApplicationCommand {
+	definitions := []*discordgo.ApplicationCommand{}
+	for _, command := range cs.router.Commands() {
+		if command.Global == global {
+			definitions = append(definitions, command.Definition)
+		}
+	}
+	return definitions
+}
+
+// sync overwrites the commands of a scope (guildID "" is global) if they
+// differ from the declared ones.
+func (cs *commandSync) sync(s *discordgo.Session, guildID string, declared []*discordgo.ApplicationCommand) {
+	scope := "global"
+	if guildID != "" {
+		scope = "guild " + guildID
+	}
+
+	existing, err := s.ApplicationCommands(s.State.User.ID, guildID)
+	if err != nil {
+		log.Printf("Could not fetch commands (%s): %s", scope, err)
+		return
+	}
+
+	plan := diffCommands(existing, declared)
+	if plan.isEmpty() {
+		log.Printf("Commands are up to date (%s).", scope)
+		return
+	}
+
+	if cs.config.Current().CommandSyncDryRun {
+		log.Printf("Planned command changes (%s, dry run): %s", scope, plan)
+		return
+	}
+
+	log.Printf("Syncing commands (%s): %s", scope, plan)
+
+	_, err = s.ApplicationCommandBulkOverwrite(s.State.User.ID, guildID, declared)
+	if err != nil {
+		log.Printf("Could not sync commands (%s): %s", scope, err)
+	}
+}
+
+func diffCommands(existing []*discordgo.ApplicationCommand, declared []*discordgo.ApplicationCommand) commandPlan {
+	var plan commandPlan
+
+	existingByName := map[string]*discordgo.ApplicationCommand{}
+	for _, command := range existing {
+		existingByName[command.Name] = command
+	}
+
+	for _, command := range declared {
+		old, exists := existingByName[command.Name]
+		if !exists {
+			plan.create = append(plan.create, command.Name)
+		} else if commandSignature(old) != commandSignature(command) {
+			plan.update = append(plan.update, command.Name)
+		}
+	}
+
+	for _, command := range existing {
+		if !slices.ContainsFunc(declared, func(c *discordgo.ApplicationCommand) bool {
+			return c.Name == command.Name
+		}) {
+			plan.remove = append(plan.remove, command.Name)
+		}
+	}
+
+	return plan
+}
+
+// commandSignature returns a representation of the fields the bot declares,
+// so that commands returned by discord can be compared to declared ones.
+func commandSignature(command *discordgo.ApplicationCommand) string {
+	commandType := command.Type
+	if commandType == 0 {
+		commandType = discordgo.ChatApplicationCommand
+	}
+
+	signature := struct {
+		Type                     discordgo.ApplicationCommandType
+		Name                     string
+		NameLocalizations        map[discordgo.Locale]string `json:",omitempty"`
+		Description              string
+		DescriptionLocalizations map[discordgo.Locale]string `json:",omitempty"`
+		DefaultMemberPermissions *int64
+		NSFW                     bool
+		Options                  []*discordgo.ApplicationCommandOption
+	}{
+		Type:                     commandType,
+		Name:                     command.Name,
+		NameLocalizations:        localizations(command.NameLocalizations),
+		Description:              command.Description,
+		DescriptionLocalizations: localizations(command.DescriptionLocalizations),
+		DefaultMemberPermissions: command.DefaultMemberPermissions,
+		NSFW:                     command.NSFW != nil && *command.NSFW,
+		Options:                  normalizeOptions(command.Options),
+	}
+
+	data, err := json.Marshal(signature)
+	if err != nil {
+		log.Println("Failed to marshal command signature: ", err)
+	}
+	return string(data)
+}
+
+// localizations treats missing localizations like empty ones.
+func localizations(localized *map[discordgo.Locale]string) map[discordgo.Locale]string {
+	if localized == nil {
+		return nil
+	}
+	return *localized
+}
+
+// normalizeOptions treats empty lists like missing ones.
+func normalizeOptions(options []*discordgo.ApplicationCommandOption) []*discordgo.ApplicationCommandOption {
+	if len(options) == 0 {
+		return nil
+	}
+
+	normalized := make([]*discordgo.ApplicationCommandOption, 0, len(options))
+	for _, option := range options {
+		o := *option
+		o.Options = normalizeOptions(o.Options)
+		if len(o.Choices) == 0 {
+			o.Choices = nil
+		}
+		if len(o.ChannelTypes) == 0 {
+			o.ChannelTypes = nil
+		}
+		normalized = append(normalized, &o)
+	}
+	return normalized
+}
@@ -0,0 +1,173 @@
+package bot
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// registered returns commands the way discord returns them after they were
+// registered.
+func registered(t *testing.T, commands ...*discordgo.ApplicationCommand) []*discordgo.ApplicationCommand {
+	t.Helper()
+
+	data, err := json.Marshal(commands)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []*discordgo.ApplicationCommand
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range result {
+		command.ID, command.ApplicationID, command.Version = "1", "2", "3"
+		command.Type = discordgo.ChatApplicationCommand
+	}
+	return result
+}
+
+func TestDiffCommands(t *testing.T) {
+	manageGuild := int64(discordgo.PermissionManageServer)
+	manageRoles := int64(discordgo.PermissionManageRoles)
+
+	timer := func(change func(command *discordgo.ApplicationCommand)) *discordgo.ApplicationCommand {
+		command := &discordgo.ApplicationCommand{
+			Name:                     "timer",
+			Description:              "Sets a timer",
+			DefaultMemberPermissions: &manageGuild,
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionString, Name: "when", Description: "When", Required: true},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "message", Description: "What", Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "hi", Value: "hi"},
+					{Name: "bye", Value: "bye"},
+				}},
+			},
+		}
+		if change != nil {
+			change(command)
+		}
+		return command
+	}
+	ping := &discordgo.ApplicationCommand{Name: "ping", Description: "Pong", Options: []*discordgo.ApplicationCommandOption{}}
+
+	tests := []struct {
+		name     string
+		existing []*discordgo.ApplicationCommand
+		declared []*discordgo.ApplicationCommand
+		want     commandPlan
+	}{
+		{
+			name:     "unchanged",
+			existing: registered(t, timer(nil), ping),
+			declared: []*discordgo.ApplicationCommand{timer(nil), ping},
+		},
+		{
+			name:     "empty option lists",
+			existing: registered(t, &discordgo.ApplicationCommand{Name: "ping", Description: "Pong"}),
+			declared: []*discordgo.ApplicationCommand{ping},
+		},
+		{
+			name:     "new and stale commands",
+			existing: registered(t, timer(nil)),
+			declared: []*discordgo.ApplicationCommand{ping},
+			want:     commandPlan{create: []string{"ping"}, remove: []string{"timer"}},
+		},
+		{
+			name:     "description",
+			existing: registered(t, timer(nil)),
+			declared: []*discordgo.ApplicationCommand{timer(func(c *discordgo.ApplicationCommand) { c.Description = "Sets a reminder" })},
+			want:     commandPlan{update: []string{"timer"}},
+		},
+		{
+			name:     "option order",
+			existing: registered(t, timer(nil)),
+			declared: []*discordgo.ApplicationCommand{timer(func(c *discordgo.ApplicationCommand) {
+				c.Options[0], c.Options[1] = c.Options[1], c.Options[0]
+			})},
+			want: commandPlan{update: []string{"timer"}},
+		},
+		{
+			name:     "choice order",
+			existing: registered(t, timer(nil)),
+			declared: []*discordgo.ApplicationCommand{timer(func(c *discordgo.ApplicationCommand) {
+				choices := c.Options[1].Choices
+				choices[0], choices[1] = choices[1], choices[0]
+			})},
+			want: commandPlan{update: []string{"timer"}},
+		},
+		{
+			name:     "required option",
+			existing: registered(t, timer(nil)),
+			declared: []*discordgo.ApplicationCommand{timer(func(c *discordgo.ApplicationCommand) { c.Options[1].Required = true })},
+			want:     commandPlan{update: []string{"timer"}},
+		},
+		{
+			name:     "permissions",
+			existing: registered(t, timer(nil)),
+			declared: []*discordgo.ApplicationCommand{timer(func(c *discordgo.ApplicationCommand) { c.DefaultMemberPermissions = &manageRoles })},
+			want:     commandPlan{update: []string{"timer"}},
+		},
+		{
+			name:     "permissions removed",
+			existing: registered(t, timer(nil)),
+			declared: []*discordgo.ApplicationCommand{timer(func(c *discordgo.ApplicationCommand) { c.DefaultMemberPermissions = nil })},
+			want:     commandPlan{update: []string{"timer"}},
+		},
+		{
+			name: "localized command",
+			existing: registered(t, timer(func(c *discordgo.ApplicationCommand) {
+				c.DescriptionLocalizations = &map[discordgo.Locale]string{discordgo.German: "Stellt einen Timer"}
+			})),
+			declared: []*discordgo.ApplicationCommand{timer(func(c *discordgo.ApplicationCommand) {
+				c.DescriptionLocalizations = &map[discordgo.Locale]string{discordgo.German: "Stellt einen Wecker"}
+			})},
+			want: commandPlan{update: []string{"timer"}},
+		},
+		{
+			name:     "localization added",
+			existing: registered(t, timer(nil)),
+			declared: []*discordgo.ApplicationCommand{timer(func(c *discordgo.ApplicationCommand) {
+				c.NameLocalizations = &map[discordgo.Locale]string{discordgo.German: "wecker"}
+			})},
+			want: commandPlan{update: []string{"timer"}},
+		},
+		{
+			name: "localization unchanged",
+			existing: registered(t, timer(func(c *discordgo.ApplicationCommand) {
+				c.NameLocalizations = &map[discordgo.Locale]string{discordgo.German: "wecker"}
+				c.Options[0].DescriptionLocalizations = map[discordgo.Locale]string{discordgo.German: "Wann"}
+			})),
+			declared: []*discordgo.ApplicationCommand{timer(func(c *discordgo.ApplicationCommand) {
+				c.NameLocalizations = &map[discordgo.Locale]string{discordgo.German: "wecker"}
+				c.Options[0].DescriptionLocalizations = map[discordgo.Locale]string{discordgo.German: "Wann"}
+			})},
+		},
+		{
+			name:     "empty localizations",
+			existing: registered(t, timer(nil)),
+			declared: []*discordgo.ApplicationCommand{timer(func(c *discordgo.ApplicationCommand) {
+				c.NameLocalizations = &map[discordgo.Locale]string{}
+			})},
+		},
+		{
+			name:     "localized option",
+			existing: registered(t, timer(nil)),
+			declared: []*discordgo.ApplicationCommand{timer(func(c *discordgo.ApplicationCommand) {
+				c.Options[0].DescriptionLocalizations = map[discordgo.Locale]string{discordgo.German: "Wann"}
+			})},
+			want: commandPlan{update: []string{"timer"}},
+		},
+	}
+
+	for _, test := range tests {
+		plan := diffCommands(test.existing, test.declared)
+		if !slices.Equal(plan.create, test.want.create) || !slices.Equal(plan.update, test.want.update) || !slices.Equal(plan.remove, test.want.remove) {
+			t.Errorf("%s: diffCommands() = %q, want %q", test.name, plan, test.want)
+		}
+		if plan.isEmpty() != test.want.isEmpty() {
+			t.Errorf("%s: isEmpty() = %v", test.name, plan.isEmpty())
+		}
+	}
+}
@@ -1,35 +1,286 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
-var Token string
-var SocketPassword string
-var GeminiApiKey string
-
 type Config struct {
-	Token          string
-	SocketPassword string
-	GeminiApiKey   string
-	ServerIp	   string
+	Token          string `yaml:"token"`
+	SocketPassword string `yaml:"socketPassword"`
+	GeminiApiKey   string `yaml:"geminiApiKey"`
+	ServerIp       string `yaml:"serverIp"`
+	DatabasePath   string `yaml:"databasePath"`
+	// CommandSyncDryRun only logs planned application command changes.
+	CommandSyncDryRun bool `yaml:"commandSyncDryRun"`
+	// Owners may use owner only commands. The owner of the application is
+	// used if it is empty.
+	Owners []string `yaml:"owners"`
+
+	AI        AIConfig        `yaml:"ai"`
+	Minecraft MinecraftConfig `yaml:"minecraft"`
+	Stock     StockConfig     `yaml:"stock"`
+
+	// Defaults are used for every guild setting that is not set in Guilds.
+	Defaults GuildConfig            `yaml:"defaults"`
+	Guilds   map[string]GuildConfig `yaml:"guilds"`
 }
 
-func New() Config {
-	err := godotenv.Load(".env")
-	if err != nil {
-		log.Fatalln("Could not load .env file: ", err)
+type AIConfig struct {
+	Model string `yaml:"model"`
+	// SystemPrompt replaces the built-in system prompt if it is set.
+	SystemPrompt string `yaml:"systemPrompt"`
+	// HistoryGuild gets the conversation of older versions, which kept one
+	// history for every guild. It isn't imported if this is empty.
+	HistoryGuild string `yaml:"historyGuild"`
+}
+
+type MinecraftConfig struct {
+	// Guild is the guild the minecraft chat is bridged to. The channel is the
+	// bridgeChannel of that guild.
+	Guild         string `yaml:"guild"`
+	WebsocketPort int    `yaml:"websocketPort"`
+}
+
+type StockConfig struct {
+	SpreadsheetId   string `yaml:"spreadsheetId"`
+	SheetName       string `yaml:"sheetName"`
+	CredentialsPath string `yaml:"credentialsPath"`
+	ChartPath       string `yaml:"chartPath"`
+}
+
+// GuildConfig holds the settings of a single guild.
+type GuildConfig struct {
+	Timezone        string   `yaml:"timezone"`
+	BridgeChannel   string   `yaml:"bridgeChannel"`
+	AIEnabled       *bool    `yaml:"aiEnabled"`       // unset uses the default, false turns it off
+	AIChannels      []string `yaml:"aiChannels"`      // empty means every channel
+	CountedEmojis   []string `yaml:"countedEmojis"`   // only read to migrate the kok counts, use /counter
+	BannedReactions []string `yaml:"bannedReactions"` // only read to migrate to reaction rules, use /reactionrule
+	PronounRoles    []string `yaml:"pronounRoles"`    // used until the guild has a pronoun menu, see /rolemenu
+	ModLogChannel   string   `yaml:"modLogChannel"`   // where reaction rules log to
+}
+
+var (
+	snowflakeRegex = regexp.MustCompile(`^\d{17,20}$`)
+	emojiRegex     = regexp.MustCompile(`^<a?:\w{2,32}:\d{17,20}>$`)
+)
+
+// New loads the configuration file at path. Values from the environment,
+// then those of a .env file in the working directory, override the file.
+// Without a file only the defaults and the environment are used.
+func New(path string) (Config, error) {
+	// .env is read on every reload, so it is never copied into the
+	// environment, which would hide later changes to it
+	dotenv, err := godotenv.Read(".env")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Println("Could not load .env file: ", err)
 	}
 
 	config := Config{
-		Token:          os.Getenv("TOKEN"),
-		SocketPassword: os.Getenv("SOCKET_PASSWORD"),
-		GeminiApiKey:   os.Getenv("GEMINI_API_KEY"),
-		ServerIp:		os.Getenv("SERVER_IP"),
+		DatabasePath: "assets/data/bot.db",
+		AI: AIConfig{
+			Model: "gemini-2.5-flash-preview-04-17",
+		},
+		Minecraft: MinecraftConfig{
+			WebsocketPort: 9459,
+		},
+		Stock: StockConfig{
+			SheetName: "Finance",
+			ChartPath: "assets/images/chart.png",
+		},
+		Defaults: GuildConfig{
+			Timezone: "Europe/Berlin",
+		},
+	}
+
+	// deployments that only use .env have no config file
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("There is no config file at %s, using the defaults and the environment.", path)
+	} else if err != nil {
+		return Config{}, fmt.Errorf("could not read config file: %w", err)
+	} else if err := yaml.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("could not parse config file: %w", err)
+	}
+
+	config.applyEnv(dotenv)
+
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// applyEnv overrides the file with the environment and then with dotenv, the
+// values of the .env file.
+func (config *Config) applyEnv(dotenv map[string]string) {
+	lookup := func(name string) (string, bool) {
+		if value, exists := os.LookupEnv(name); exists {
+			return value, true
+		}
+		value, exists := dotenv[name]
+		return value, exists
+	}
+
+	overrides := map[string]*string{
+		"TOKEN":           &config.Token,
+		"SOCKET_PASSWORD": &config.SocketPassword,
+		"GEMINI_API_KEY":  &config.GeminiApiKey,
+		"SERVER_IP":       &config.ServerIp,
+		"DATABASE_PATH":   &config.DatabasePath,
+		"GEMINI_MODEL":    &config.AI.Model,
+	}
+
+	for name, field := range overrides {
+		if value, exists := lookup(name); exists {
+			*field = value
+		}
+	}
+
+	if value, exists := lookup("COMMAND_SYNC_DRY_RUN"); exists {
+		config.CommandSyncDryRun = value == "true"
+	}
+}
+
+// Validate checks the whole configuration and returns all problems at once.
+func (config *Config) Validate() error {
+	var errs []error
+
+	if config.Token == "" {
+		errs = append(errs, errors.New("token is missing"))
+	}
+	if config.DatabasePath == "" {
+		errs = append(errs, errors.New("databasePath is missing"))
+	}
+	if config.GeminiApiKey != "" && config.AI.Model == "" {
+		errs = append(errs, errors.New("ai.model is missing"))
+	}
+	if config.AI.HistoryGuild != "" && !snowflakeRegex.MatchString(config.AI.HistoryGuild) {
+		errs = append(errs, errors.New("ai.historyGuild must be a guild ID"))
+	}
+
+	for _, owner := range config.Owners {
+		if !snowflakeRegex.MatchString(owner) {
+			errs = append(errs, fmt.Errorf("owners: %q is not a user ID", owner))
+		}
+	}
+
+	if config.Stock.CredentialsPath != "" && config.Stock.SpreadsheetId == "" {
+		errs = append(errs, errors.New("stock.spreadsheetId is missing"))
+	}
+
+	if config.ServerIp != "" {
+		if !snowflakeRegex.MatchString(config.Minecraft.Guild) {
+			errs = append(errs, errors.New("minecraft.guild must be a guild ID"))
+		} else if config.Guild(config.Minecraft.Guild).BridgeChannel == "" {
+			errs = append(errs, fmt.Errorf("guild %s needs a bridgeChannel for the minecraft bridge", config.Minecraft.Guild))
+		}
+	}
+
+	if err := config.Defaults.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("defaults: %w", err))
+	}
+
+	for guildID, guild := range config.Guilds {
+		if !snowflakeRegex.MatchString(guildID) {
+			errs = append(errs, fmt.Errorf("guilds: %q is not a guild ID", guildID))
+		}
+		if err := guild.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("guild %s: %w", guildID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the settings of a single guild.
+func (guild GuildConfig) Validate() error {
+	var errs []error
+
+	if guild.Timezone != "" {
+		if _, err := time.LoadLocation(guild.Timezone); err != nil {
+			errs = append(errs, fmt.Errorf("unknown timezone %q", guild.Timezone))
+		}
+	}
+
+	ids := map[string][]string{
+		"bridgeChannel": {guild.BridgeChannel},
+		"modLogChannel": {guild.ModLogChannel},
+		"aiChannels":    guild.AIChannels,
+		"pronounRoles":  guild.PronounRoles,
+	}
+	for name, values := range ids {
+		for _, id := range values {
+			if id != "" && !snowflakeRegex.MatchString(id) {
+				errs = append(errs, fmt.Errorf("%s: %q is not an ID", name, id))
+			}
+		}
+	}
+
+	for _, emoji := range guild.CountedEmojis {
+		if emoji == "" || (emoji[0] == '<' && !emojiRegex.MatchString(emoji)) {
+			errs = append(errs, fmt.Errorf("countedEmojis: %q is not an emoji", emoji))
+		}
 	}
 
-	return config
+	return errors.Join(errs...)
+}
+
+// Guild returns the settings of a guild merged with the defaults.
+func (config *Config) Guild(guildID string) GuildConfig {
+	return config.Guilds[guildID].Merge(config.Defaults)
+}
+
+// Merge fills every unset field with the value of defaults.
+func (guild GuildConfig) Merge(defaults GuildConfig) GuildConfig {
+	if guild.Timezone == "" {
+		guild.Timezone = defaults.Timezone
+	}
+	if guild.BridgeChannel == "" {
+		guild.BridgeChannel = defaults.BridgeChannel
+	}
+	if guild.AIEnabled == nil {
+		guild.AIEnabled = defaults.AIEnabled
+	}
+	if guild.AIChannels == nil {
+		guild.AIChannels = defaults.AIChannels
+	}
+	if guild.CountedEmojis == nil {
+		guild.CountedEmojis = defaults.CountedEmojis
+	}
+	if guild.BannedReactions == nil {
+		guild.BannedReactions = defaults.BannedReactions
+	}
+	if guild.PronounRoles == nil {
+		guild.PronounRoles = defaults.PronounRoles
+	}
+	if guild.ModLogChannel == "" {
+		guild.ModLogChannel = defaults.ModLogChannel
+	}
+	return guild
+}
+
+// AI reports whether the AI answers in the guild.
+func (guild GuildConfig) AI() bool {
+	return guild.AIEnabled != nil && *guild.AIEnabled
+}
+
+// Location returns the timezone of the guild. It falls back to UTC if the
+// timezone can't be loaded.
+func (guild GuildConfig) Location() *time.Location {
+	loc, err := time.LoadLocation(guild.Timezone)
+	if err != nil {
+		log.Println("Failed to load timezone: ", err)
+		return time.UTC
+	}
+	return loc
 }
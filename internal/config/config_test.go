@@ -0,0 +1,206 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var envNames = []string{"TOKEN", "SOCKET_PASSWORD", "GEMINI_API_KEY", "SERVER_IP", "DATABASE_PATH", "GEMINI_MODEL", "COMMAND_SYNC_DRY_RUN"}
+
+// setEnv clears the variables the config reads and sets the given ones. The
+// tests run in this directory, which has no .env file.
+func setEnv(t *testing.T, values map[string]string) {
+	t.Helper()
+
+	for _, name := range envNames {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	for name, value := range values {
+		t.Setenv(name, value)
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaults(t *testing.T) {
+	setEnv(t, map[string]string{"TOKEN": "env"})
+
+	// a missing file uses the defaults and the environment
+	config, err := New(filepath.Join(t.TempDir(), "config.yaml"))
+	if err != nil {
+		t.Fatal("New() without a config file: ", err)
+	}
+
+	if config.Token != "env" {
+		t.Errorf("Token = %q, want the environment", config.Token)
+	}
+	checks := map[string][2]any{
+		"databasePath":           {config.DatabasePath, "assets/data/bot.db"},
+		"ai.model":               {config.AI.Model, "gemini-2.5-flash-preview-04-17"},
+		"minecraft.port":         {config.Minecraft.WebsocketPort, 9459},
+		"stock.sheetName":        {config.Stock.SheetName, "Finance"},
+		"stock.chartPath":        {config.Stock.ChartPath, "assets/images/chart.png"},
+		"defaults.timezone":      {config.Defaults.Timezone, "Europe/Berlin"},
+		"commandSyncDryRun":      {config.CommandSyncDryRun, false},
+		"guild timezone":         {config.Guild("100000000000000001").Timezone, "Europe/Berlin"},
+		"guild ai":               {config.Guild("100000000000000001").AI(), false},
+		"defaults.aiEnabled":     {config.Defaults.AIEnabled == nil, true},
+		"defaults.bridgeChannel": {config.Defaults.BridgeChannel, ""},
+	}
+	for name, check := range checks {
+		if check[0] != check[1] {
+			t.Errorf("%s = %v, want %v", name, check[0], check[1])
+		}
+	}
+
+	// the token has no default
+	setEnv(t, nil)
+	if _, err := New(filepath.Join(t.TempDir(), "config.yaml")); err == nil || !strings.Contains(err.Error(), "token is missing") {
+		t.Errorf("New() without a token = %v, want an error", err)
+	}
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	path := writeConfig(t, `
+token: file
+geminiApiKey: file
+databasePath: file.db
+commandSyncDryRun: false
+ai:
+  model: file-model
+defaults:
+  timezone: UTC
+guilds:
+  "100000000000000001":
+    aiEnabled: true
+    timezone: Europe/London
+    aiChannels: ["100000000000000002"]
+`)
+	setEnv(t, map[string]string{
+		"TOKEN":                "env",
+		"GEMINI_MODEL":         "env-model",
+		"COMMAND_SYNC_DRY_RUN": "true",
+	})
+
+	config, err := New(path)
+	if err != nil {
+		t.Fatal("New(): ", err)
+	}
+
+	checks := map[string][2]any{
+		"token":             {config.Token, "env"},
+		"geminiApiKey":      {config.GeminiApiKey, "file"},
+		"databasePath":      {config.DatabasePath, "file.db"},
+		"ai.model":          {config.AI.Model, "env-model"},
+		"commandSyncDryRun": {config.CommandSyncDryRun, true},
+		// values the file doesn't set keep their defaults
+		"minecraft.port": {config.Minecraft.WebsocketPort, 9459},
+	}
+	for name, check := range checks {
+		if check[0] != check[1] {
+			t.Errorf("%s = %v, want %v", name, check[0], check[1])
+		}
+	}
+
+	guild := config.Guild("100000000000000001")
+	if guild.Timezone != "Europe/London" || !guild.AI() || !slices.Equal(guild.AIChannels, []string{"100000000000000002"}) {
+		t.Errorf("Guild() = %+v, want the guild's own settings", guild)
+	}
+	other := config.Guild("100000000000000009")
+	if other.Timezone != "UTC" || other.AI() || other.AIChannels != nil {
+		t.Errorf("Guild() of another guild = %+v, want the defaults", other)
+	}
+}
+
+func TestInvalidFile(t *testing.T) {
+	setEnv(t, map[string]string{"TOKEN": "env"})
+
+	if _, err := New(writeConfig(t, "token: [")); err == nil || !strings.Contains(err.Error(), "could not parse") {
+		t.Errorf("New() with broken YAML = %v, want a parse error", err)
+	}
+	if _, err := New(t.TempDir()); err == nil || !strings.Contains(err.Error(), "could not read") {
+		t.Errorf("New() with a directory = %v, want a read error", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		return Config{
+			Token:        "token",
+			DatabasePath: "bot.db",
+			AI:           AIConfig{Model: "model"},
+			Defaults:     GuildConfig{Timezone: "Europe/Berlin"},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(config *Config)
+		want   []string // parts of the error, none if valid
+	}{
+		{"valid", func(config *Config) {}, nil},
+		{"token", func(config *Config) { config.Token = "" }, []string{"token is missing"}},
+		{"database", func(config *Config) { config.DatabasePath = "" }, []string{"databasePath is missing"}},
+		{"model", func(config *Config) { config.GeminiApiKey, config.AI.Model = "key", "" }, []string{"ai.model is missing"}},
+		{"model without key", func(config *Config) { config.AI.Model = "" }, nil},
+		{"history guild", func(config *Config) { config.AI.HistoryGuild = "general" }, []string{"ai.historyGuild"}},
+		{"owners", func(config *Config) { config.Owners = []string{"100000000000000003", "maya"} }, []string{`"maya" is not a user ID`}},
+		{"spreadsheet", func(config *Config) { config.Stock.CredentialsPath = "credentials.json" }, []string{"stock.spreadsheetId is missing"}},
+		{"minecraft guild", func(config *Config) { config.ServerIp = "localhost" }, []string{"minecraft.guild must be a guild ID"}},
+		{"bridge channel", func(config *Config) {
+			config.ServerIp, config.Minecraft.Guild = "localhost", "100000000000000001"
+		}, []string{"needs a bridgeChannel"}},
+		{"bridge channel set", func(config *Config) {
+			config.ServerIp, config.Minecraft.Guild = "localhost", "100000000000000001"
+			config.Guilds = map[string]GuildConfig{"100000000000000001": {BridgeChannel: "100000000000000002"}}
+		}, nil},
+		{"timezone", func(config *Config) { config.Defaults.Timezone = "Mars/Olympus" }, []string{`defaults: unknown timezone "Mars/Olympus"`}},
+		{"guild ID", func(config *Config) { config.Guilds = map[string]GuildConfig{"main": {}} }, []string{`guilds: "main" is not a guild ID`}},
+		{"guild settings", func(config *Config) {
+			config.Guilds = map[string]GuildConfig{"100000000000000001": {
+				AIChannels:    []string{"general"},
+				PronounRoles:  []string{"she"},
+				ModLogChannel: "log",
+				CountedEmojis: []string{"", "<:kok>", "🥥", "<a:kok:1324540733222289490>"},
+			}}
+		}, []string{`aiChannels: "general"`, `pronounRoles: "she"`, `modLogChannel: "log"`, `countedEmojis: ""`, `countedEmojis: "<:kok>"`}},
+		{"all problems at once", func(config *Config) { config.Token, config.DatabasePath = "", "" }, []string{"token is missing", "databasePath is missing"}},
+	}
+
+	for _, test := range tests {
+		config := valid()
+		test.change(&config)
+		err := config.Validate()
+
+		if test.want == nil {
+			if err != nil {
+				t.Errorf("%s: Validate() = %v, want no error", test.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: Validate() = nil, want %q", test.name, test.want)
+			continue
+		}
+		for _, part := range test.want {
+			if !strings.Contains(err.Error(), part) {
+				t.Errorf("%s: Validate() = %v, want it to contain %q", test.name, err, part)
+			}
+		}
+		if strings.Contains(err.Error(), "🥥") || strings.Contains(err.Error(), "1324540733222289490") {
+			t.Errorf("%s: Validate() = %v, rejected a valid emoji", test.name, err)
+		}
+	}
+}
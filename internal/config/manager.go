@@ -0,0 +1,137 @@
+package config
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Manager holds the current configuration and replaces it when the config
+// file is reloaded.
+type Manager struct {
+	path      string
+	current   atomic.Pointer[Config]
+	mu        sync.Mutex // guards listeners and modTime
+	listeners []func(old *Config, new *Config)
+	modTime   time.Time
+}
+
+// NewManager loads the config file at path.
+func NewManager(path string) (*Manager, error) {
+	config, err := New(path)
+	if err != nil {
+		return nil, err
+	}
+
+	manager := &Manager{path: path}
+	manager.current.Store(&config)
+	manager.modTime = manager.fileModTime()
+
+	return manager, nil
+}
+
+// Current returns the configuration that is active right now. The returned
+// value must not be modified.
+func (manager *Manager) Current() *Config {
+	return manager.current.Load()
+}
+
+// OnReload registers fn to be called after a new configuration was loaded.
+func (manager *Manager) OnReload(fn func(old *Config, new *Config)) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.listeners = append(manager.listeners, fn)
+}
+
+// Reload loads the config file and the .env file again. An invalid file is
+// rejected and the current configuration stays active.
+func (manager *Manager) Reload() error {
+	// the poll doesn't load this version of the file again
+	modTime := manager.fileModTime()
+	manager.mu.Lock()
+	manager.modTime = modTime
+	manager.mu.Unlock()
+
+	config, err := New(manager.path)
+	if err != nil {
+		return err
+	}
+
+	old := manager.current.Swap(&config)
+
+	if old.Token != config.Token || old.DatabasePath != config.DatabasePath {
+		log.Println("The token and database path are only applied after a restart.")
+	}
+
+	manager.mu.Lock()
+	listeners := manager.listeners
+	manager.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(old, &config)
+	}
+
+	return nil
+}
+
+// Watch reloads the configuration on SIGHUP and whenever the config file
+// changes, until stop is closed.
+func (manager *Manager) Watch(stop <-chan struct{}) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hangup:
+			log.Println("Received SIGHUP, reloading config.")
+			manager.reload()
+		case <-ticker.C:
+			if manager.fileChanged() {
+				log.Println("Config file changed, reloading config.")
+				manager.reload()
+			}
+		}
+	}
+}
+
+func (manager *Manager) reload() {
+	if err := manager.Reload(); err != nil {
+		log.Println("Rejected config reload, keeping the old config: ", err)
+		return
+	}
+	log.Println("Reloaded config.")
+}
+
+func (manager *Manager) fileModTime() time.Time {
+	info, err := os.Stat(manager.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// fileChanged reports whether the config file was modified since the last
+// call.
+func (manager *Manager) fileChanged() bool {
+	modTime := manager.fileModTime()
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if modTime.IsZero() || modTime.Equal(manager.modTime) {
+		return false
+	}
+	manager.modTime = modTime
+	return true
+}
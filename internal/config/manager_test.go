@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// touch moves the modification time of path forward, file systems don't
+// always tell writes in quick succession apart.
+func touch(t *testing.T, path string, age int) {
+	t.Helper()
+
+	modTime := time.Now().Add(time.Duration(age) * time.Minute)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	setEnv(t, nil)
+	path := writeConfig(t, "token: old\nai:\n  model: old\n")
+
+	manager, err := NewManager(path)
+	if err != nil {
+		t.Fatal("NewManager(): ", err)
+	}
+
+	type reload struct{ old, new string }
+	var reloads []reload
+	manager.OnReload(func(old *Config, new *Config) {
+		reloads = append(reloads, reload{old.AI.Model, new.AI.Model})
+	})
+
+	// an invalid file keeps the old config and tells no listener
+	if err := os.WriteFile(path, []byte("token: old\ndefaults:\n  timezone: Mars/Olympus\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, path, 1)
+	if err := manager.Reload(); err == nil {
+		t.Error("Reload() of an invalid file succeeded")
+	}
+	if model := manager.Current().AI.Model; model != "old" || len(reloads) != 0 {
+		t.Errorf("after a rejected reload the model is %q and listeners saw %v", model, reloads)
+	}
+
+	if err := os.WriteFile(path, []byte("token: old\nai:\n  model: new\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, path, 2)
+	if err := manager.Reload(); err != nil {
+		t.Fatal("Reload(): ", err)
+	}
+	if model := manager.Current().AI.Model; model != "new" {
+		t.Errorf("after a reload the model is %q, want new", model)
+	}
+
+	// a reload by SIGHUP isn't repeated by the poll
+	if manager.fileChanged() {
+		t.Error("the poll reloads a file that was already reloaded")
+	}
+	if len(reloads) != 1 || reloads[0] != (reload{"old", "new"}) {
+		t.Errorf("listeners saw %v, want one reload from old to new", reloads)
+	}
+
+	// the poll notices later changes
+	touch(t, path, 3)
+	if !manager.fileChanged() {
+		t.Error("the poll missed a changed file")
+	}
+	if manager.fileChanged() {
+		t.Error("the poll reports the same change twice")
+	}
+}
+
+func TestReloadDotEnv(t *testing.T) {
+	setEnv(t, map[string]string{"GEMINI_MODEL": "env"})
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	writeDotEnv := func(content string) {
+		if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeDotEnv("TOKEN=first\nGEMINI_MODEL=dotenv\n")
+
+	// without a config file
+	manager, err := NewManager(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatal("NewManager(): ", err)
+	}
+	if token := manager.Current().Token; token != "first" {
+		t.Errorf("token = %q, want the one of .env", token)
+	}
+
+	// changes to .env are picked up, the environment still wins
+	writeDotEnv("TOKEN=second\nGEMINI_MODEL=dotenv\n")
+	if err := manager.Reload(); err != nil {
+		t.Fatal("Reload(): ", err)
+	}
+	if token := manager.Current().Token; token != "second" {
+		t.Errorf("token after a reload = %q, want the changed .env", token)
+	}
+	if model := manager.Current().AI.Model; model != "env" {
+		t.Errorf("model = %q, want the environment over .env", model)
+	}
+	if _, exists := os.LookupEnv("TOKEN"); exists {
+		t.Error(".env was copied into the environment")
+	}
+}
@@ -0,0 +1,184 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// minInterval is the shortest time between two occurrences of a recurrence.
+const minInterval = time.Minute
+
+var (
+	// clockRegex matches "9", "9pm" and "09:30", like timeparse does
+	clockRegex = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+
+	weekdayNumbers = map[string]time.Weekday{
+		"sunday": time.Sunday, "sun": time.Sunday,
+		"monday": time.Monday, "mon": time.Monday,
+		"tuesday": time.Tuesday, "tue": time.Tuesday,
+		"wednesday": time.Wednesday, "wed": time.Wednesday,
+		"thursday": time.Thursday, "thu": time.Thursday,
+		"friday": time.Friday, "fri": time.Friday,
+		"saturday": time.Saturday, "sat": time.Saturday,
+	}
+
+	intervalUnits = map[string]time.Duration{
+		"minute": time.Minute, "minutes": time.Minute, "min": time.Minute,
+		"hour": time.Hour, "hours": time.Hour, "h": time.Hour,
+	}
+)
+
+// ParseRecurrence turns a rule into a cron spec. Rules are either cron specs
+// ("0 9 * * 1", "@daily") or simple English like "daily", "every monday
+// 09:00", "weekdays at 7:30", "every day at 9pm" or "every 2 hours". Rules
+// without a time of day use the time of first.
+func ParseRecurrence(rule string, first time.Time) (string, error) {
+	rule = strings.ToLower(strings.TrimSpace(rule))
+	if rule == "" {
+		return "", errors.New("the rule is empty")
+	}
+
+	spec, err := parseHumanRule(rule, first)
+	if err != nil {
+		// maybe it is a cron spec
+		if _, cronErr := cron.ParseStandard(rule); cronErr != nil {
+			return "", err
+		}
+		spec = rule
+	}
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return "", err
+	}
+
+	// reject rules that would spam the channel
+	next := schedule.Next(first)
+	if schedule.Next(next).Sub(next) < minInterval {
+		return "", fmt.Errorf("the rule repeats more often than every %s", minInterval)
+	}
+
+	return spec, nil
+}
+
+func parseHumanRule(rule string, first time.Time) (string, error) {
+	tokens := strings.FieldsFunc(rule, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+
+	hour, minute := first.Hour(), first.Minute()
+	dayOfMonth := "*"
+	var days []int
+	var hourly, daily bool
+
+	for index := 0; index < len(tokens); index++ {
+		token := tokens[index]
+
+		if weekday, exists := weekdayNumbers[strings.TrimSuffix(token, "s")]; exists {
+			days = append(days, int(weekday))
+			continue
+		}
+
+		// "every 2 hours"
+		if amount, err := strconv.Atoi(token); err == nil && index+1 < len(tokens) {
+			if unit, exists := intervalUnits[tokens[index+1]]; exists {
+				if amount <= 0 {
+					return "", fmt.Errorf("unknown interval %q", token+" "+tokens[index+1])
+				}
+				return fmt.Sprintf("@every %s", time.Duration(amount)*unit), nil
+			}
+		}
+
+		if match := clockRegex.FindStringSubmatch(token); match != nil {
+			hour, _ = strconv.Atoi(match[1])
+			minute, _ = strconv.Atoi(match[2])
+
+			meridiem := match[3]
+			// "9 pm"
+			if meridiem == "" && index+1 < len(tokens) && (tokens[index+1] == "am" || tokens[index+1] == "pm") {
+				meridiem = tokens[index+1]
+				index++
+			}
+			if meridiem != "" && (hour == 0 || hour > 12) {
+				return "", fmt.Errorf("%q is not a time of day", token)
+			}
+			if meridiem == "pm" && hour < 12 {
+				hour += 12
+			} else if meridiem == "am" && hour == 12 {
+				hour = 0
+			}
+
+			if hour > 23 || minute > 59 {
+				return "", fmt.Errorf("%q is not a time of day", token)
+			}
+			continue
+		}
+
+		switch token {
+		case "every", "each", "at", "and", "on", "o'clock":
+		case "minute":
+			return "* * * * *", nil
+		case "hour", "hourly":
+			hourly = true
+		case "day", "daily":
+			daily = true
+		case "weekday", "weekdays":
+			days = append(days, 1, 2, 3, 4, 5)
+		case "weekend", "weekends":
+			days = append(days, 0, 6)
+		case "week", "weekly":
+			days = append(days, int(first.Weekday()))
+		case "month", "monthly":
+			// cron skips the months without that day
+			if first.Day() > 28 {
+				return "", fmt.Errorf("a monthly rule can't start on day %d as not every month has it, please start it on one of the first 28 days", first.Day())
+			}
+			dayOfMonth = strconv.Itoa(first.Day())
+		default:
+			return "", fmt.Errorf("unknown word %q in the rule", token)
+		}
+	}
+
+	if hourly {
+		return fmt.Sprintf("%d * * * *", minute), nil
+	}
+	if !daily && len(days) == 0 && dayOfMonth == "*" {
+		return "", errors.New("the rule doesn't say when to repeat")
+	}
+
+	dayOfWeek := "*"
+	if len(days) > 0 {
+		slices.Sort(days)
+		days = slices.Compact(days)
+
+		parts := make([]string, 0, len(days))
+		for _, day := range days {
+			parts = append(parts, strconv.Itoa(day))
+		}
+		dayOfWeek = strings.Join(parts, ",")
+	}
+
+	return fmt.Sprintf("%d %d %s * %s", minute, hour, dayOfMonth, dayOfWeek), nil
+}
+
+// NextOccurrence returns the first occurrence of spec after after. The time
+// of day is kept in the location of after across DST changes.
+func NextOccurrence(spec string, after time.Time) (time.Time, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next := schedule.Next(after)
+	if next.IsZero() {
+		return time.Time{}, errors.New("the rule has no further occurrences")
+	}
+	return next, nil
+}
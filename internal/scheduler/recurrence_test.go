@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	// a wednesday
+	first := time.Date(2025, 1, 1, 8, 15, 0, 0, time.UTC)
+
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"daily", "15 8 * * *"},
+		{"every day at 9", "0 9 * * *"},
+		{"every day at 9pm", "0 21 * * *"},
+		{"every day at 9 pm", "0 21 * * *"},
+		{"every day at 12am", "0 0 * * *"},
+		{"every day at 9 o'clock", "0 9 * * *"},
+		{"every monday 09:00", "0 9 * * 1"},
+		{"weekdays at 7:30", "30 7 * * 1,2,3,4,5"},
+		{"mondays and fridays at 18", "0 18 * * 1,5"},
+		{"weekly", "15 8 * * 3"},
+		{"monthly at 10", "0 10 1 * *"},
+		{"hourly", "15 * * * *"},
+		{"every 2 hours", "@every 2h0m0s"},
+		{"0 9 * * 1", "0 9 * * 1"},
+		{"@daily", "@daily"},
+	}
+	for _, test := range tests {
+		if got, err := ParseRecurrence(test.rule, first); err != nil || got != test.want {
+			t.Errorf("ParseRecurrence(%q) = %q, %v, want %q", test.rule, got, err, test.want)
+		}
+	}
+
+	for _, rule := range []string{"", "at 9", "every day at 25", "every day at 13pm", "every 0 hours", "sometimes"} {
+		if got, err := ParseRecurrence(rule, first); err == nil {
+			t.Errorf("ParseRecurrence(%q) = %q, want an error", rule, got)
+		}
+	}
+
+	// not every month has a 31st
+	endOfMonth := time.Date(2025, 1, 31, 8, 15, 0, 0, time.UTC)
+	if got, err := ParseRecurrence("monthly", endOfMonth); err == nil {
+		t.Errorf("ParseRecurrence(\"monthly\") on the 31st = %q, want an error", got)
+	}
+	if got, err := ParseRecurrence("monthly", endOfMonth.AddDate(0, 0, -3)); err != nil || got != "15 8 28 * *" {
+		t.Errorf("ParseRecurrence(\"monthly\") on the 28th = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,184 @@
+// Package scheduler fires jobs at their due time. All jobs are kept in a
+// min-heap and a single goroutine sleeps until the earliest one is due.
+package scheduler
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Job is a scheduled job. The meaning of the ID is up to the caller.
+type Job struct {
+	ID  string
+	Due time.Time
+}
+
+// Scheduler runs the fire function of jobs once they are due. Jobs that are
+// already due when they are scheduled (for example because the bot was
+// offline) fire right away.
+type Scheduler struct {
+	clock Clock
+	fire  func(job Job)
+
+	mu    sync.Mutex // guards queue and jobs
+	queue jobQueue
+	jobs  map[string]*item
+	wake  chan struct{}
+}
+
+// New creates a scheduler. fire is called in its own goroutine for every due
+// job.
+func New(clock Clock, fire func(job Job)) *Scheduler {
+	return &Scheduler{
+		clock: clock,
+		fire:  fire,
+		jobs:  map[string]*item{},
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Schedule adds a job. Scheduling an ID again replaces the pending job, so
+// loading the same jobs twice doesn't fire them twice.
+func (s *Scheduler) Schedule(id string, due time.Time) {
+	s.mu.Lock()
+	if existing, exists := s.jobs[id]; exists {
+		existing.job.Due = due
+		heap.Fix(&s.queue, existing.index)
+	} else {
+		item := &item{job: Job{ID: id, Due: due}}
+		heap.Push(&s.queue, item)
+		s.jobs[id] = item
+	}
+	s.mu.Unlock()
+
+	s.notify()
+}
+
+// Cancel removes a pending job and reports whether it existed.
+func (s *Scheduler) Cancel(id string) bool {
+	s.mu.Lock()
+	item, exists := s.jobs[id]
+	if exists {
+		heap.Remove(&s.queue, item.index)
+		delete(s.jobs, id)
+	}
+	s.mu.Unlock()
+
+	if exists {
+		s.notify()
+	}
+	return exists
+}
+
+// Pending returns the due time of a pending job.
+func (s *Scheduler) Pending(id string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, exists := s.jobs[id]
+	if !exists {
+		return time.Time{}, false
+	}
+	return item.job.Due, true
+}
+
+// Run fires jobs until stop is closed.
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	for {
+		due, wait := s.popDue()
+
+		for _, job := range due {
+			go s.fire(job)
+		}
+
+		var timer Timer
+		var timeout <-chan time.Time
+		if wait >= 0 {
+			timer = s.clock.NewTimer(wait)
+			timeout = timer.C()
+		}
+
+		select {
+		case <-stop:
+		case <-s.wake:
+		case <-timeout:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+	}
+}
+
+// popDue removes all due jobs from the queue and returns them together with
+// the time until the next job is due (-1 if there is none).
+func (s *Scheduler) popDue() ([]Job, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+
+	var due []Job
+	for len(s.queue) > 0 && !s.queue[0].job.Due.After(now) {
+		item := heap.Pop(&s.queue).(*item)
+		delete(s.jobs, item.job.ID)
+		due = append(due, item.job)
+	}
+
+	if len(s.queue) == 0 {
+		return due, -1
+	}
+	return due, s.queue[0].job.Due.Sub(now)
+}
+
+// notify wakes up the loop so that it recalculates the next due time.
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+type item struct {
+	job   Job
+	index int
+}
+
+// jobQueue is a min-heap of jobs ordered by their due time.
+type jobQueue []*item
+
+func (q jobQueue) Len() int {
+	return len(q)
+}
+
+func (q jobQueue) Less(i, j int) bool {
+	return q[i].job.Due.Before(q[j].job.Due)
+}
+
+func (q jobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *jobQueue) Push(x any) {
+	item := x.(*item)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *jobQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return item
+}
@@ -0,0 +1,206 @@
+package scheduler
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when the test advances it. The timers it creates are
+// sent to timers, so tests know what the scheduler waits for.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers chan *fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:    time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+		timers: make(chan *fakeTimer, 100),
+	}
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	return clock.now
+}
+
+func (clock *fakeClock) NewTimer(d time.Duration) Timer {
+	timer := &fakeTimer{d: d, c: make(chan time.Time, 1)}
+	clock.timers <- timer
+	return timer
+}
+
+func (clock *fakeClock) advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	clock.now = clock.now.Add(d)
+}
+
+type fakeTimer struct {
+	d time.Duration
+	c chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	return true
+}
+
+// ids returns the IDs of jobs.
+func ids(jobs []Job) []string {
+	var ids []string
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	return ids
+}
+
+func TestOrder(t *testing.T) {
+	clock := newFakeClock()
+	s := New(clock, func(job Job) {})
+	start := clock.Now()
+
+	s.Schedule("c", start.Add(3*time.Minute))
+	s.Schedule("a", start.Add(time.Minute))
+	s.Schedule("b", start.Add(2*time.Minute))
+	s.Schedule("d", start.Add(3*time.Minute))
+
+	due, wait := s.popDue()
+	if len(due) != 0 || wait != time.Minute {
+		t.Fatalf("popDue = %v, %v, want nothing due for a minute", ids(due), wait)
+	}
+
+	clock.advance(time.Minute)
+	if due, wait := s.popDue(); !slices.Equal(ids(due), []string{"a"}) || wait != time.Minute {
+		t.Errorf("popDue after a minute = %v, %v, want a and a minute", ids(due), wait)
+	}
+
+	clock.advance(5 * time.Minute)
+	due, wait = s.popDue()
+	got := ids(due)
+	if len(got) == 3 {
+		// c and d are due at the same time
+		slices.Sort(got[1:])
+	}
+	if !slices.Equal(got, []string{"b", "c", "d"}) || wait != -1 {
+		t.Errorf("popDue after six minutes = %v, %v, want b before c and d, nothing left", got, wait)
+	}
+	if _, pending := s.Pending("c"); pending {
+		t.Error("c is still pending after it was due")
+	}
+}
+
+func TestReschedule(t *testing.T) {
+	clock := newFakeClock()
+	s := New(clock, func(job Job) {})
+	start := clock.Now()
+
+	s.Schedule("a", start.Add(time.Minute))
+	s.Schedule("b", start.Add(2*time.Minute))
+
+	// scheduling an ID again moves the job instead of adding another one
+	s.Schedule("a", start.Add(3*time.Minute))
+	if due, _ := s.Pending("a"); !due.Equal(start.Add(3 * time.Minute)) {
+		t.Errorf("a is due at %v, want %v", due, start.Add(3*time.Minute))
+	}
+
+	clock.advance(2 * time.Minute)
+	if due, _ := s.popDue(); !slices.Equal(ids(due), []string{"b"}) {
+		t.Errorf("popDue = %v, want b", ids(due))
+	}
+
+	clock.advance(time.Minute)
+	if due, wait := s.popDue(); !slices.Equal(ids(due), []string{"a"}) || wait != -1 {
+		t.Errorf("popDue = %v, %v, want a once", ids(due), wait)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	clock := newFakeClock()
+	s := New(clock, func(job Job) {})
+	start := clock.Now()
+
+	s.Schedule("a", start.Add(time.Minute))
+	s.Schedule("b", start.Add(2*time.Minute))
+
+	if !s.Cancel("a") {
+		t.Error("Cancel of a pending job = false")
+	}
+	if s.Cancel("a") {
+		t.Error("Cancel of a cancelled job = true")
+	}
+
+	clock.advance(time.Hour)
+	if due, _ := s.popDue(); !slices.Equal(ids(due), []string{"b"}) {
+		t.Errorf("popDue = %v, want only b", ids(due))
+	}
+}
+
+func TestRun(t *testing.T) {
+	clock := newFakeClock()
+	fired := make(chan string, 10)
+	s := New(clock, func(job Job) { fired <- job.ID })
+
+	// jobs that are due already fire right away
+	s.Schedule("late", clock.Now().Add(-time.Hour))
+	s.Schedule("soon", clock.Now().Add(time.Minute))
+
+	// the loop only sleeps once if it isn't woken up by the schedules
+	<-s.wake
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.Run(stop)
+		close(done)
+	}()
+
+	if id := receive(t, fired); id != "late" {
+		t.Fatalf("fired %s, want late", id)
+	}
+
+	// wait until the scheduler sleeps for soon, then wake it up
+	var timer *fakeTimer
+	select {
+	case timer = <-clock.timers:
+	case <-time.After(time.Second):
+		t.Fatal("the scheduler never waited for soon")
+	}
+	if timer.d != time.Minute {
+		t.Fatalf("the scheduler waits %v, want a minute", timer.d)
+	}
+	clock.advance(time.Minute)
+	timer.c <- clock.Now()
+
+	if id := receive(t, fired); id != "soon" {
+		t.Fatalf("fired %s, want soon", id)
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return after stop was closed")
+	}
+}
+
+func receive(t *testing.T, fired chan string) string {
+	t.Helper()
+
+	select {
+	case id := <-fired:
+		return id
+	case <-time.After(time.Second):
+		t.Fatal("no job fired")
+		return ""
+	}
+}
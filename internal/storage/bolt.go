@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens (or creates) a bbolt database file at path.
+func OpenBolt(path string) (Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltStore{db: db}, nil
+}
+
+func (store *boltStore) View(fn func(tx Tx) error) error {
+	return store.db.View(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (store *boltStore) Update(fn func(tx Tx) error) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (store *boltStore) Close() error {
+	return store.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t *boltTx) Get(bucket string, key string) ([]byte, error) {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil, ErrNotFound
+	}
+
+	value := b.Get([]byte(key))
+	if value == nil {
+		return nil, ErrNotFound
+	}
+
+	// values are only valid during the transaction
+	return bytes.Clone(value), nil
+}
+
+func (t *boltTx) Put(bucket string, key string, value []byte) error {
+	if !t.tx.Writable() {
+		return ErrReadOnly
+	}
+
+	b, err := t.tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(key), value)
+}
+
+func (t *boltTx) Delete(bucket string, key string) error {
+	if !t.tx.Writable() {
+		return ErrReadOnly
+	}
+
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	return b.Delete([]byte(key))
+}
+
+func (t *boltTx) ForEach(bucket string, prefix string, fn func(key string, value []byte) error) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	c := b.Cursor()
+	p := []byte(prefix)
+
+	for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+		if err := fn(string(k), bytes.Clone(v)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
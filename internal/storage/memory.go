@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type memoryStore struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemory returns a Store that keeps everything in memory. It is meant for
+// tests and has the same transaction semantics as the bbolt store.
+func NewMemory() Store {
+	return &memoryStore{
+		buckets: map[string]map[string][]byte{},
+	}
+}
+
+func (store *memoryStore) View(fn func(tx Tx) error) error {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return fn(&memoryTx{buckets: store.buckets})
+}
+
+func (store *memoryStore) Update(fn func(tx Tx) error) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	tx := &memoryTx{
+		buckets:  store.buckets,
+		writable: true,
+		changed:  map[string]map[string][]byte{},
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	// commit
+	for name, bucket := range tx.changed {
+		store.buckets[name] = bucket
+	}
+
+	return nil
+}
+
+func (store *memoryStore) Close() error {
+	return nil
+}
+
+type memoryTx struct {
+	buckets  map[string]map[string][]byte
+	changed  map[string]map[string][]byte // copies of buckets written in this transaction
+	writable bool
+}
+
+func (t *memoryTx) bucket(name string) map[string][]byte {
+	if b, exists := t.changed[name]; exists {
+		return b
+	}
+	return t.buckets[name]
+}
+
+// writableBucket copies the bucket on first write so that a rollback
+// leaves the committed data untouched.
+func (t *memoryTx) writableBucket(name string) map[string][]byte {
+	if b, exists := t.changed[name]; exists {
+		return b
+	}
+
+	b := maps.Clone(t.buckets[name])
+	if b == nil {
+		b = map[string][]byte{}
+	}
+	t.changed[name] = b
+
+	return b
+}
+
+func (t *memoryTx) Get(bucket string, key string) ([]byte, error) {
+	value, exists := t.bucket(bucket)[key]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	return bytes.Clone(value), nil
+}
+
+func (t *memoryTx) Put(bucket string, key string, value []byte) error {
+	if !t.writable {
+		return ErrReadOnly
+	}
+
+	t.writableBucket(bucket)[key] = bytes.Clone(value)
+	return nil
+}
+
+func (t *memoryTx) Delete(bucket string, key string) error {
+	if !t.writable {
+		return ErrReadOnly
+	}
+
+	delete(t.writableBucket(bucket), key)
+	return nil
+}
+
+func (t *memoryTx) ForEach(bucket string, prefix string, fn func(key string, value []byte) error) error {
+	b := t.bucket(bucket)
+
+	keys := slices.Sorted(maps.Keys(b))
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if err := fn(key, bytes.Clone(b[key])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
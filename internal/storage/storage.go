@@ -0,0 +1,83 @@
+// Package storage is the persistence layer of the bot. Every subsystem stores
+// its state through a Store instead of writing its own files.
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned by Tx.Get if the key does not exist.
+	ErrNotFound = errors.New("storage: key not found")
+	// ErrReadOnly is returned when writing inside a View transaction.
+	ErrReadOnly = errors.New("storage: transaction is read only")
+)
+
+// Store is a transactional key/value store. Keys are grouped into buckets.
+type Store interface {
+	// View runs fn inside a read only transaction.
+	View(fn func(tx Tx) error) error
+	// Update runs fn inside a read-write transaction. The transaction is
+	// committed if fn returns nil and rolled back otherwise.
+	Update(fn func(tx Tx) error) error
+	Close() error
+}
+
+// Tx is a single transaction on a Store.
+type Tx interface {
+	Get(bucket string, key string) ([]byte, error)
+	Put(bucket string, key string, value []byte) error
+	Delete(bucket string, key string) error
+	// ForEach calls fn for every key in bucket that starts with prefix in
+	// ascending key order. Returning an error from fn stops the iteration.
+	ForEach(bucket string, prefix string, fn func(key string, value []byte) error) error
+}
+
+// Key joins parts into a single key. Use it for hierarchical keys like
+// guildID/userID so that ForEach can iterate over a prefix.
+func Key(parts ...string) string {
+	return strings.Join(parts, "/")
+}
+
+// Prefix returns the ForEach prefix matching all keys below parts.
+func Prefix(parts ...string) string {
+	return Key(parts...) + "/"
+}
+
+// GetJSON reads the value of key and unmarshals it into v.
+func GetJSON(tx Tx, bucket string, key string, v any) error {
+	data, err := tx.Get(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// PutJSON marshals v and stores it under key.
+func PutJSON(tx Tx, bucket string, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return tx.Put(bucket, key, data)
+}
+
+// IsEmpty reports whether bucket contains no keys.
+func IsEmpty(tx Tx, bucket string) (bool, error) {
+	empty := true
+	stop := errors.New("stop")
+
+	err := tx.ForEach(bucket, "", func(key string, value []byte) error {
+		empty = false
+		return stop
+	})
+	if err != nil && err != stop {
+		return false, err
+	}
+
+	return empty, nil
+}
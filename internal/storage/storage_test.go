@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// stores returns every implementation, so each test checks that they behave
+// the same.
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+
+	bolt, err := OpenBolt(filepath.Join(t.TempDir(), "data", "test.db"))
+	if err != nil {
+		t.Fatal("failed to open bolt store: ", err)
+	}
+
+	stores := map[string]Store{
+		"bolt":   bolt,
+		"memory": NewMemory(),
+	}
+	for _, store := range stores {
+		t.Cleanup(func() { store.Close() })
+	}
+	return stores
+}
+
+func TestGetPutDelete(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			err := store.View(func(tx Tx) error {
+				_, err := tx.Get("bucket", "key")
+				return err
+			})
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get of a missing bucket = %v, want ErrNotFound", err)
+			}
+
+			err = store.Update(func(tx Tx) error {
+				return tx.Put("bucket", "key", []byte("value"))
+			})
+			if err != nil {
+				t.Fatal("Put failed: ", err)
+			}
+
+			var value []byte
+			err = store.View(func(tx Tx) error {
+				var err error
+				value, err = tx.Get("bucket", "key")
+				return err
+			})
+			if err != nil || string(value) != "value" {
+				t.Fatalf("Get = %q, %v, want \"value\"", value, err)
+			}
+
+			// deleting twice is fine
+			for range 2 {
+				err = store.Update(func(tx Tx) error {
+					return tx.Delete("bucket", "key")
+				})
+				if err != nil {
+					t.Fatal("Delete failed: ", err)
+				}
+			}
+
+			err = store.View(func(tx Tx) error {
+				_, err := tx.Get("bucket", "key")
+				return err
+			})
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+			}
+
+			err = store.Update(func(tx Tx) error {
+				return tx.Delete("missing", "key")
+			})
+			if err != nil {
+				t.Fatal("Delete in a missing bucket failed: ", err)
+			}
+		})
+	}
+}
+
+func TestValuesAreCopies(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			input := []byte("value")
+			err := store.Update(func(tx Tx) error {
+				return tx.Put("bucket", "key", input)
+			})
+			if err != nil {
+				t.Fatal("Put failed: ", err)
+			}
+			input[0] = 'X'
+
+			var value []byte
+			store.View(func(tx Tx) error {
+				value, _ = tx.Get("bucket", "key")
+				return nil
+			})
+			value[0] = 'Y'
+
+			store.View(func(tx Tx) error {
+				value, _ = tx.Get("bucket", "key")
+				return nil
+			})
+			if string(value) != "value" {
+				t.Fatalf("stored value = %q, want \"value\"", value)
+			}
+		})
+	}
+}
+
+func TestViewIsReadOnly(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			err := store.View(func(tx Tx) error {
+				return tx.Put("bucket", "key", []byte("value"))
+			})
+			if !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("Put in View = %v, want ErrReadOnly", err)
+			}
+
+			err = store.View(func(tx Tx) error {
+				return tx.Delete("bucket", "key")
+			})
+			if !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("Delete in View = %v, want ErrReadOnly", err)
+			}
+		})
+	}
+}
+
+func TestForEach(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			err := store.Update(func(tx Tx) error {
+				for _, key := range []string{Key("b", "2"), Key("a", "2"), Key("a", "1"), Key("ab", "1"), "a"} {
+					if err := tx.Put("bucket", key, []byte(key)); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal("Put failed: ", err)
+			}
+
+			collect := func(prefix string) []string {
+				var keys []string
+				err := store.View(func(tx Tx) error {
+					return tx.ForEach("bucket", prefix, func(key string, value []byte) error {
+						if string(value) != key {
+							t.Errorf("value of %q = %q", key, value)
+						}
+						keys = append(keys, key)
+						return nil
+					})
+				})
+				if err != nil {
+					t.Fatal("ForEach failed: ", err)
+				}
+				return keys
+			}
+
+			tests := []struct {
+				prefix string
+				want   []string
+			}{
+				{"", []string{"a", "a/1", "a/2", "ab/1", "b/2"}},
+				{Prefix("a"), []string{"a/1", "a/2"}},
+				{"a", []string{"a", "a/1", "a/2", "ab/1"}},
+				{Prefix("c"), nil},
+			}
+			for _, test := range tests {
+				if got := collect(test.prefix); !slices.Equal(got, test.want) {
+					t.Errorf("ForEach(%q) = %q, want %q", test.prefix, got, test.want)
+				}
+			}
+
+			// errors stop the iteration
+			stop := errors.New("stop")
+			calls := 0
+			err = store.View(func(tx Tx) error {
+				return tx.ForEach("bucket", "", func(key string, value []byte) error {
+					calls++
+					return stop
+				})
+			})
+			if !errors.Is(err, stop) || calls != 1 {
+				t.Fatalf("ForEach returning an error = %v after %d calls, want stop after 1", err, calls)
+			}
+
+			err = store.View(func(tx Tx) error {
+				return tx.ForEach("missing", "", func(key string, value []byte) error {
+					t.Error("ForEach called fn for a missing bucket")
+					return nil
+				})
+			})
+			if err != nil {
+				t.Fatal("ForEach of a missing bucket failed: ", err)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			err := store.Update(func(tx Tx) error {
+				return tx.Put("bucket", "kept", []byte("old"))
+			})
+			if err != nil {
+				t.Fatal("Put failed: ", err)
+			}
+
+			failure := errors.New("failure")
+			err = store.Update(func(tx Tx) error {
+				if err := tx.Put("bucket", "kept", []byte("new")); err != nil {
+					return err
+				}
+				if err := tx.Put("bucket", "added", []byte("new")); err != nil {
+					return err
+				}
+				if err := tx.Put("other", "added", []byte("new")); err != nil {
+					return err
+				}
+
+				// the transaction sees its own writes
+				value, err := tx.Get("bucket", "kept")
+				if err != nil || string(value) != "new" {
+					t.Errorf("Get inside the transaction = %q, %v, want \"new\"", value, err)
+				}
+				return failure
+			})
+			if !errors.Is(err, failure) {
+				t.Fatalf("Update = %v, want the error of fn", err)
+			}
+
+			store.View(func(tx Tx) error {
+				if value, err := tx.Get("bucket", "kept"); err != nil || string(value) != "old" {
+					t.Errorf("kept = %q, %v after rollback, want \"old\"", value, err)
+				}
+				if _, err := tx.Get("bucket", "added"); !errors.Is(err, ErrNotFound) {
+					t.Errorf("added exists after rollback")
+				}
+				if _, err := tx.Get("other", "added"); !errors.Is(err, ErrNotFound) {
+					t.Errorf("other/added exists after rollback")
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestJSONHelpers(t *testing.T) {
+	type value struct {
+		Name  string
+		Count int
+	}
+
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			err := store.View(func(tx Tx) error {
+				empty, err := IsEmpty(tx, "bucket")
+				if err != nil || !empty {
+					t.Errorf("IsEmpty of a new bucket = %v, %v, want true", empty, err)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = store.Update(func(tx Tx) error {
+				return PutJSON(tx, "bucket", Key("guild", "user"), value{Name: "kok", Count: 3})
+			})
+			if err != nil {
+				t.Fatal("PutJSON failed: ", err)
+			}
+
+			store.View(func(tx Tx) error {
+				var got value
+				if err := GetJSON(tx, "bucket", "guild/user", &got); err != nil || got != (value{Name: "kok", Count: 3}) {
+					t.Errorf("GetJSON = %+v, %v", got, err)
+				}
+				if err := GetJSON(tx, "bucket", "missing", &got); !errors.Is(err, ErrNotFound) {
+					t.Errorf("GetJSON of a missing key = %v, want ErrNotFound", err)
+				}
+				if empty, err := IsEmpty(tx, "bucket"); err != nil || empty {
+					t.Errorf("IsEmpty = %v, %v, want false", empty, err)
+				}
+				return nil
+			})
+		})
+	}
+}
@@ -0,0 +1,329 @@
+// Package timeparse resolves English and German time phrases like "in 2h 30m",
+// "tomorrow at 8", "next friday 18:00" or "morgen um 9" to absolute times.
+package timeparse
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultHour is used for phrases that name a day but no time.
+const defaultHour = 9
+
+var (
+	ErrEmpty = errors.New("no time given")
+	ErrPast  = errors.New("that time is in the past")
+)
+
+var (
+	durationRegex = regexp.MustCompile(`(\d+(?:[.,]\d+)?)\s*([a-zäöü]+)|\b(einer|einem|einen|eine|ein|one|an|a)\s+([a-zäöü]+)`)
+	clockRegex    = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(?::(\d{2}))?(am|pm|uhr|h)?$`)
+	isoDateRegex  = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})$`)
+	dotDateRegex  = regexp.MustCompile(`^(\d{1,2})\.(\d{1,2})\.(\d{4})?$`)
+	// decimalRegex matches German decimals like "1,5", which aren't lists
+	decimalRegex = regexp.MustCompile(`(\d),(\d)`)
+
+	durationUnits = unitsByName(map[time.Duration][]string{
+		time.Second:        {"s", "sec", "secs", "second", "seconds", "sek", "sekunde", "sekunden"},
+		time.Minute:        {"m", "min", "mins", "minute", "minutes", "minuten"},
+		time.Hour:          {"h", "hr", "hrs", "hour", "hours", "std", "stunde", "stunden"},
+		24 * time.Hour:     {"d", "day", "days", "tag", "tage", "tagen"},
+		7 * 24 * time.Hour: {"w", "week", "weeks", "woche", "wochen"},
+	})
+
+	weekdays = map[string]time.Weekday{
+		"monday": time.Monday, "mon": time.Monday, "montag": time.Monday, "mo": time.Monday,
+		"tuesday": time.Tuesday, "tue": time.Tuesday, "dienstag": time.Tuesday, "di": time.Tuesday,
+		"wednesday": time.Wednesday, "wed": time.Wednesday, "mittwoch": time.Wednesday, "mi": time.Wednesday,
+		"thursday": time.Thursday, "thu": time.Thursday, "donnerstag": time.Thursday, "do": time.Thursday,
+		"friday": time.Friday, "fri": time.Friday, "freitag": time.Friday, "fr": time.Friday,
+		"saturday": time.Saturday, "sat": time.Saturday, "samstag": time.Saturday, "sa": time.Saturday,
+		"sunday": time.Sunday, "sun": time.Sunday, "sonntag": time.Sunday,
+	}
+
+	// dayTimes are the hours of words like "evening". Hours given together
+	// with them are moved into that part of the day ("abends um 7" is 19:00).
+	dayTimes = map[string]int{
+		"morning": 9, "morgens": 9, "früh": 9, "frueh": 9, "vormittag": 10, "vormittags": 10,
+		"noon": 12, "mittag": 12, "mittags": 12,
+		"afternoon": 15, "nachmittag": 15, "nachmittags": 15,
+		"evening": 19, "tonight": 19, "abend": 19, "abends": 19,
+		"night": 22, "nacht": 22, "nachts": 22,
+		"midnight": 0, "mitternacht": 0,
+	}
+
+	nextWords = map[string]bool{
+		"next": true, "nächste": true, "nächsten": true, "nächster": true, "naechste": true,
+		"naechsten": true, "kommende": true, "kommenden": true,
+	}
+
+	fillerWords = map[string]bool{
+		"at": true, "on": true, "um": true, "am": true, "the": true, "this": true,
+		"o'clock": true, "uhr": true, "den": true, "der": true, "diesen": true,
+	}
+)
+
+// Parse resolves input relative to now. The result is in the location of now
+// and always lies in the future.
+func Parse(input string, now time.Time) (time.Time, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	input = strings.ReplaceAll(decimalRegex.ReplaceAllString(input, "$1.$2"), ",", " ")
+	if input == "" {
+		return time.Time{}, ErrEmpty
+	}
+
+	var result time.Time
+	if strings.HasPrefix(input, "in ") {
+		duration, err := parseDuration(strings.TrimPrefix(input, "in "))
+		if err != nil {
+			return time.Time{}, err
+		}
+		result = now.Add(duration)
+	} else if duration, err := parseDuration(input); err == nil {
+		result = now.Add(duration)
+	} else {
+		result, err = parseAbsolute(strings.Fields(input), now)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	if !result.After(now) {
+		return time.Time{}, ErrPast
+	}
+	return result, nil
+}
+
+// parseDuration parses durations like "2h 30m", "2 hours and 30 minutes" or
+// "eine stunde".
+func parseDuration(input string) (time.Duration, error) {
+	matches := durationRegex.FindAllStringSubmatchIndex(input, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("%q is not a duration", input)
+	}
+
+	var total time.Duration
+	rest := input
+	for _, match := range matches {
+		// "2 hours" or "an hour"
+		amountText, unitText := "1", ""
+		if match[2] != -1 {
+			amountText = input[match[2]:match[3]]
+			unitText = input[match[4]:match[5]]
+		} else {
+			unitText = input[match[8]:match[9]]
+		}
+
+		unit, exists := durationUnits[unitText]
+		if !exists {
+			return 0, fmt.Errorf("unknown unit %q", unitText)
+		}
+
+		amount, _ := strconv.ParseFloat(strings.ReplaceAll(amountText, ",", "."), 64)
+		total += time.Duration(amount * float64(unit))
+
+		rest = strings.Replace(rest, input[match[0]:match[1]], "", 1)
+	}
+
+	// only joining words may be left
+	for _, word := range strings.Fields(rest) {
+		if word != "and" && word != "und" {
+			return 0, fmt.Errorf("unknown word %q", word)
+		}
+	}
+
+	if total <= 0 {
+		return 0, fmt.Errorf("%q is not a duration", input)
+	}
+	return total, nil
+}
+
+// parseAbsolute parses a day ("tomorrow", "friday", "2025-05-01") and a time
+// of day ("18:00", "8pm", "abends") in any order.
+func parseAbsolute(tokens []string, now time.Time) (time.Time, error) {
+	loc := now.Location()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	hour, minute, second := -1, 0, 0
+	dayTime := -1
+	next := false
+	explicitDay := false
+	var weekday *time.Weekday
+
+	for index := 0; index < len(tokens); index++ {
+		token := tokens[index]
+		previous := ""
+		if index > 0 {
+			previous = tokens[index-1]
+		}
+
+		switch {
+		case token == "today" || token == "heute":
+			explicitDay = true
+
+		case token == "tomorrow" || (token == "morgen" && previous != "heute" && previous != "am"):
+			day = day.AddDate(0, 0, 1)
+			explicitDay = true
+
+		case token == "übermorgen" || token == "uebermorgen":
+			day = day.AddDate(0, 0, 2)
+			explicitDay = true
+
+		case token == "day" && index+2 < len(tokens) && tokens[index+1] == "after" && tokens[index+2] == "tomorrow":
+			day = day.AddDate(0, 0, 2)
+			explicitDay = true
+			index += 2
+
+		case nextWords[token]:
+			next = true
+
+		case isWeekday(token):
+			w := weekdays[token]
+			weekday = &w
+			explicitDay = true
+
+		case token == "morgen":
+			// "heute morgen", "am morgen"
+			dayTime = dayTimes["morning"]
+
+		case isDayTime(token):
+			dayTime = dayTimes[token]
+
+		case isoDateRegex.MatchString(token):
+			match := isoDateRegex.FindStringSubmatch(token)
+			year, _ := strconv.Atoi(match[1])
+			month, _ := strconv.Atoi(match[2])
+			date, _ := strconv.Atoi(match[3])
+			if !validDate(year, month, date) {
+				return time.Time{}, fmt.Errorf("%q is not a date", token)
+			}
+			day = time.Date(year, time.Month(month), date, 0, 0, 0, 0, loc)
+			explicitDay = true
+
+		case dotDateRegex.MatchString(token):
+			match := dotDateRegex.FindStringSubmatch(token)
+			date, _ := strconv.Atoi(match[1])
+			month, _ := strconv.Atoi(match[2])
+			year := now.Year()
+			if match[3] != "" {
+				year, _ = strconv.Atoi(match[3])
+			}
+			if !validDate(year, month, date) {
+				return time.Time{}, fmt.Errorf("%q is not a date", token)
+			}
+			day = time.Date(year, time.Month(month), date, 0, 0, 0, 0, loc)
+			// dates without a year are the next one
+			if match[3] == "" && day.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)) {
+				day = day.AddDate(1, 0, 0)
+			}
+			explicitDay = true
+
+		case clockRegex.MatchString(token):
+			match := clockRegex.FindStringSubmatch(token)
+			hour, _ = strconv.Atoi(match[1])
+			minute, _ = strconv.Atoi(match[2])
+			second, _ = strconv.Atoi(match[3])
+
+			meridiem := match[4]
+			// "8 pm", "8 am"
+			if meridiem == "" && index+1 < len(tokens) && (tokens[index+1] == "pm" || (tokens[index+1] == "am" && !isDayAt(tokens, index+2))) {
+				meridiem = tokens[index+1]
+				index++
+			}
+			if meridiem != "" && (hour == 0 || hour > 12) {
+				return time.Time{}, fmt.Errorf("%q is not a time", token)
+			}
+			if meridiem == "pm" && hour < 12 {
+				hour += 12
+			} else if meridiem == "am" && hour == 12 {
+				hour = 0
+			}
+
+			if hour > 23 || minute > 59 || second > 59 {
+				return time.Time{}, fmt.Errorf("%q is not a time", token)
+			}
+
+		case fillerWords[token]:
+
+		default:
+			return time.Time{}, fmt.Errorf("unknown word %q", token)
+		}
+	}
+
+	// move hours into the named part of the day
+	if dayTime >= 0 {
+		if hour == -1 {
+			hour = dayTime
+		} else if dayTime >= 12 && hour < 12 {
+			hour += 12
+		}
+	}
+
+	if weekday != nil {
+		days := (int(*weekday) - int(day.Weekday()) + 7) % 7
+		if next && days == 0 {
+			days = 7
+		}
+		day = day.AddDate(0, 0, days)
+	}
+
+	if hour == -1 {
+		if !explicitDay {
+			return time.Time{}, ErrEmpty
+		}
+		hour = defaultHour
+	}
+
+	result := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, second, 0, loc)
+
+	// a time that already passed today means the next day (or week)
+	if !result.After(now) && !explicitDay {
+		result = result.AddDate(0, 0, 1)
+	} else if !result.After(now) && weekday != nil {
+		result = result.AddDate(0, 0, 7)
+	}
+
+	return result, nil
+}
+
+func unitsByName(names map[time.Duration][]string) map[string]time.Duration {
+	units := map[string]time.Duration{}
+	for unit, unitNames := range names {
+		for _, name := range unitNames {
+			units[name] = unit
+		}
+	}
+	return units
+}
+
+func isWeekday(token string) bool {
+	_, exists := weekdays[token]
+	return exists
+}
+
+// isDayAt reports whether tokens[index] is a weekday or a date, to tell the
+// German "am" in "um 8 am freitag" and "um 20 am 1.5." from the English
+// "8 am".
+func isDayAt(tokens []string, index int) bool {
+	if index >= len(tokens) {
+		return false
+	}
+	token := tokens[index]
+	return isWeekday(token) || dotDateRegex.MatchString(token) || isoDateRegex.MatchString(token)
+}
+
+func isDayTime(token string) bool {
+	_, exists := dayTimes[token]
+	return exists
+}
+
+func validDate(year int, month int, day int) bool {
+	if month < 1 || month > 12 || day < 1 {
+		return false
+	}
+	return day <= time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,99 @@
+package timeparse
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal("failed to load timezone: ", err)
+	}
+	// a wednesday
+	now := time.Date(2025, 3, 5, 10, 0, 0, 0, berlin)
+	at := func(month time.Month, day int, hour int, minute int) time.Time {
+		return time.Date(2025, month, day, hour, minute, 0, 0, berlin)
+	}
+
+	tests := []struct {
+		input string
+		want  time.Time
+	}{
+		// relative
+		{"in 2h 30m", now.Add(2*time.Hour + 30*time.Minute)},
+		{"2 hours and 30 minutes", now.Add(2*time.Hour + 30*time.Minute)},
+		{"in an hour", now.Add(time.Hour)},
+		{"in 1.5 days", now.Add(36 * time.Hour)},
+		{"in 2 weeks", now.Add(14 * 24 * time.Hour)},
+		{"45 sec", now.Add(45 * time.Second)},
+
+		// absolute
+		{"tomorrow at 8", at(3, 6, 8, 0)},
+		{"tomorrow", at(3, 6, defaultHour, 0)},
+		{"day after tomorrow 18:30", at(3, 7, 18, 30)},
+		{"friday 8pm", at(3, 7, 20, 0)},
+		{"next friday 18:00", at(3, 7, 18, 0)},
+		{"wednesday", at(3, 12, defaultHour, 0)},
+		{"today at 12:30:15", time.Date(2025, 3, 5, 12, 30, 15, 0, berlin)},
+		{"this evening", at(3, 5, 19, 0)},
+		{"2025-05-01 14:30", at(5, 1, 14, 30)},
+		{"12 am", at(3, 6, 0, 0)},
+		{"11", at(3, 5, 11, 0)},
+		{"8", at(3, 6, 8, 0)},
+
+		// german
+		{"in einer stunde", now.Add(time.Hour)},
+		{"in 1,5 stunden", now.Add(90 * time.Minute)},
+		{"2 tage und 3 stunden", now.Add(51 * time.Hour)},
+		{"morgen um 9", at(3, 6, 9, 0)},
+		{"morgen früh", at(3, 6, 9, 0)},
+		{"übermorgen abends", at(3, 7, 19, 0)},
+		{"heute abend um 7", at(3, 5, 19, 0)},
+		{"am freitag um 8 uhr", at(3, 7, 8, 0)},
+		{"um 8 am freitag", at(3, 7, 8, 0)},
+		{"um 20 am 1.5.", at(5, 1, 20, 0)},
+		{"um 8 am 24.12.2025", at(12, 24, 8, 0)},
+		{"nächsten montag", at(3, 10, defaultHour, 0)},
+		{"1.5.", at(5, 1, defaultHour, 0)},
+		{"1.2.", time.Date(2026, 2, 1, defaultHour, 0, 0, 0, berlin)},
+		{"24.12.2025 18:00", at(12, 24, 18, 0)},
+
+		// "8h" alone is a duration, "um 8h" the time of day
+		{"8h", now.Add(8 * time.Hour)},
+		{"um 8h", at(3, 6, 8, 0)},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.input, now)
+		if err != nil || !got.Equal(test.want) {
+			t.Errorf("Parse(%q) = %v, %v, want %v", test.input, got, err, test.want)
+		}
+	}
+
+	failures := []struct {
+		input string
+		want  error // nil for any error
+	}{
+		{"", ErrEmpty},
+		{"   ", ErrEmpty},
+		{"next", ErrEmpty},
+		{"today at 8", ErrPast},
+		{"heute morgen", ErrPast},
+		{"2024-12-24", ErrPast},
+		{"1.3.2025", ErrPast},
+		{"soon", nil},
+		{"in 2 lightyears", nil},
+		{"in 0 minutes", nil},
+		{"25:00", nil},
+		{"13pm", nil},
+		{"2025-02-30", nil},
+		{"31.4.", nil},
+	}
+	for _, test := range failures {
+		got, err := Parse(test.input, now)
+		if err == nil || (test.want != nil && !errors.Is(err, test.want)) {
+			t.Errorf("Parse(%q) = %v, %v, want error %v", test.input, got, err, test.want)
+		}
+	}
+}